@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/fredyranthun/db/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// benchStats collects the timings of one latency measured by bench.
+type benchStats []time.Duration
+
+func (b benchStats) String() string {
+	if len(b) == 0 {
+		return "min=- avg=- max=-"
+	}
+	lo, hi, total := b[0], b[0], time.Duration(0)
+	for _, d := range b {
+		lo = min(lo, d)
+		hi = max(hi, d)
+		total += d
+	}
+	avg := total / time.Duration(len(b))
+	return fmt.Sprintf("min=%s avg=%s max=%s", lo.Round(time.Millisecond), avg.Round(time.Millisecond), hi.Round(time.Millisecond))
+}
+
+// newBenchCmd repeatedly connects and stops the first forward of an env and
+// reports how long startup and teardown took.
+func (a *app) newBenchCmd() *cobra.Command {
+	var count int
+	var concurrency int
+
+	cmd := &cobra.Command{
+		Use:   "bench <service>/<env> | <service> <env>",
+		Short: "Measure connect and stop latency of a target",
+		Long: "Connect and stop a target --count times, --concurrency at a time, and print min/avg/max startup and teardown latency.\n" +
+			"Each concurrent worker uses its own session key, so a session already running for the target is left alone.",
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			serviceName, envName, err := parseSessionArgs(args, "dbx bench <service>/<env> | <service> <env>")
+			if err != nil {
+				return err
+			}
+			if count < 1 {
+				return fmt.Errorf("--count must be at least 1")
+			}
+			if concurrency < 1 {
+				return fmt.Errorf("--concurrency must be at least 1")
+			}
+
+			cfg, err := a.loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+			envCfg, err := findEnvConfig(cfg, serviceName, envName)
+			if err != nil {
+				return err
+			}
+			return a.bench(cmd.OutOrStdout(), cmd.ErrOrStderr(), cfg.EffectiveDefaults(), serviceName, envName, envCfg, count, min(concurrency, count))
+		},
+	}
+
+	cmd.Flags().IntVar(&count, "count", 5, "Number of connect/stop runs")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 1, "Number of runs in flight at once")
+
+	return cmd
+}
+
+// bench runs count connect/stop cycles over concurrency workers. Every
+// session it starts is stopped, or killed when stopping fails, before the
+// next run of its worker.
+func (a *app) bench(out, errOut io.Writer, defaults config.Defaults, serviceName, envName string, envCfg config.EnvConfig, count, concurrency int) error {
+	forwards := envCfg.Forwards()
+	if len(forwards) == 0 {
+		return fmt.Errorf("%s/%s: env has no ports to forward", serviceName, envName)
+	}
+	fwd := forwards[0]
+	base, err := a.sessionOptions(defaults, serviceName, envName, envCfg, fwd)
+	if err != nil {
+		return err
+	}
+	if !config.IsLoopbackBind(base.Bind) && !a.allowPublicBind {
+		return fmt.Errorf("%s/%s: bind %s is not a loopback address and would expose the database to the network; pass --allow-public-bind to proceed", serviceName, envName, base.Bind)
+	}
+	// A pinned port cannot be shared between workers, and idle or TTL
+	// reaping would only skew the numbers.
+	base.LocalPort = 0
+	base.NoPortReuse = true
+	base.IdleTimeout = 0
+	base.TTL = 0
+
+	// Bench runs are not connections anyone made, so keep them out of the
+	// history log.
+	manager := a.manager
+	if h, ok := manager.(*historyManager); ok {
+		manager = h.appSessionManager
+	}
+
+	runs := make(chan int)
+	var (
+		mu       sync.Mutex
+		startup  benchStats
+		teardown benchStats
+		failed   int
+		wg       sync.WaitGroup
+	)
+	fail := func(run int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed++
+		fmt.Fprintf(errOut, "run %d: %v\n", run, err)
+	}
+
+	for w := 1; w <= concurrency; w++ {
+		opts := base
+		opts.Env = fmt.Sprintf("%s.bench%d", fwd.EnvName(envName), w)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for run := range runs {
+				begin := time.Now()
+				s, err := manager.Start(opts)
+				if err != nil {
+					fail(run, err)
+					continue
+				}
+				// The manager measures readiness from the aws process
+				// start; fall back to wall time when it skipped readiness.
+				ready := s.StartupLatency
+				if ready == 0 {
+					ready = time.Since(begin)
+				}
+
+				begin = time.Now()
+				if err := manager.Stop(s.Key); err != nil {
+					_ = manager.Kill(s.Key)
+					fail(run, fmt.Errorf("stop %s: %w", s.Key, err))
+					continue
+				}
+				took := time.Since(begin)
+
+				mu.Lock()
+				startup = append(startup, ready)
+				teardown = append(teardown, took)
+				mu.Unlock()
+			}
+		}()
+	}
+	for run := 1; run <= count; run++ {
+		runs <- run
+	}
+	close(runs)
+	wg.Wait()
+
+	fmt.Fprintf(out, "service=%s env=%s runs=%d concurrency=%d failed=%d\n", serviceName, envName, count, concurrency, failed)
+	fmt.Fprintf(out, "startup  %s\n", startup)
+	fmt.Fprintf(out, "teardown %s\n", teardown)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d runs failed", failed, count)
+	}
+	return nil
+}
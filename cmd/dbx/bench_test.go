@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/fredyranthun/db/internal/session"
+)
+
+func TestBenchStartsAndStopsEveryRun(t *testing.T) {
+	manager := &fakeAppManager{}
+
+	var out bytes.Buffer
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(&out)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", writeTestConfig(t), "bench", "service1/dev", "--count", "3"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("bench failed: %v", err)
+	}
+
+	if len(manager.startCalls) != 3 || len(manager.stopCalls) != 3 {
+		t.Fatalf("expected 3 starts and stops, got %d and %d", len(manager.startCalls), len(manager.stopCalls))
+	}
+	for _, opts := range manager.startCalls {
+		if opts.Env != "dev.bench1" || opts.LocalPort != 0 || !opts.NoPortReuse {
+			t.Fatalf("expected a fresh-port bench session, got %+v", opts)
+		}
+	}
+	for _, want := range []string{"runs=3 concurrency=1 failed=0", "startup  min=", "teardown min="} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %q in output, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestBenchKillsSessionsThatFailToStop(t *testing.T) {
+	manager := &fakeAppManager{
+		stopErrs: map[session.SessionKey]error{"service1/dev.bench1": errors.New("stuck")},
+	}
+
+	var out, errOut bytes.Buffer
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(&out)
+	root.SetErr(&errOut)
+	root.SetArgs([]string{"--config", writeTestConfig(t), "bench", "service1", "dev", "--count", "2"})
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), "2 of 2 runs failed") {
+		t.Fatalf("expected every run to fail, got %v", err)
+	}
+	if len(manager.killCalls) != 2 {
+		t.Fatalf("expected each stuck session to be killed, got %v", manager.killCalls)
+	}
+	if !strings.Contains(out.String(), "startup  min=- avg=- max=-") {
+		t.Fatalf("expected an empty summary, got:\n%s", out.String())
+	}
+	if !strings.Contains(errOut.String(), "run 1: stop service1/dev.bench1: stuck") {
+		t.Fatalf("expected the failure to be reported, got:\n%s", errOut.String())
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// addCompletionInstallCmd attaches `install` to cobra's default completion
+// command, keeping the generated `completion <shell>` subcommands intact.
+func addCompletionInstallCmd(rootCmd *cobra.Command) {
+	rootCmd.InitDefaultCompletionCmd()
+	for _, cmd := range rootCmd.Commands() {
+		if cmd.Name() == "completion" {
+			cmd.AddCommand(newCompletionInstallCmd(rootCmd))
+			return
+		}
+	}
+}
+
+func newCompletionInstallCmd(rootCmd *cobra.Command) *cobra.Command {
+	var shell string
+	var printOnly bool
+
+	cmd := &cobra.Command{
+		Use:   "install",
+		Short: "Install the completion script for your shell",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if shell == "" {
+				shell = filepath.Base(os.Getenv("SHELL"))
+			}
+			shell = strings.TrimSpace(shell)
+
+			var script bytes.Buffer
+			if err := genCompletion(rootCmd, shell, &script); err != nil {
+				return err
+			}
+			if printOnly {
+				_, err := cmd.OutOrStdout().Write(script.Bytes())
+				return err
+			}
+
+			path, hint, err := completionInstallPath(shell)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return fmt.Errorf("create completion directory: %w", err)
+			}
+			if err := os.WriteFile(path, script.Bytes(), 0o644); err != nil {
+				return fmt.Errorf("write completion script: %w", err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "installed %s completion to %s\n", shell, path)
+			if hint != "" {
+				fmt.Fprintln(cmd.OutOrStdout(), hint)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&shell, "shell", "", "Shell to install for: bash, zsh or fish (default: from $SHELL)")
+	cmd.Flags().BoolVar(&printOnly, "print", false, "Print the completion script to stdout instead of installing it")
+
+	return cmd
+}
+
+func genCompletion(rootCmd *cobra.Command, shell string, buf *bytes.Buffer) error {
+	switch shell {
+	case "bash":
+		return rootCmd.GenBashCompletionV2(buf, true)
+	case "zsh":
+		return rootCmd.GenZshCompletion(buf)
+	case "fish":
+		return rootCmd.GenFishCompletion(buf, true)
+	case "", ".":
+		return fmt.Errorf("could not detect shell from $SHELL; pass --shell bash|zsh|fish")
+	default:
+		return fmt.Errorf("unsupported shell %q; expected bash, zsh or fish", shell)
+	}
+}
+
+// completionInstallPath returns where the script for shell goes and an
+// optional hint for any manual step the user still has to take.
+func completionInstallPath(shell string) (string, string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", fmt.Errorf("resolve home directory: %w", err)
+	}
+
+	switch shell {
+	case "bash":
+		dir := filepath.Join(homeDir, ".bash_completion.d")
+		return filepath.Join(dir, "dbx"), fmt.Sprintf("make sure your ~/.bashrc sources files in %s", dir), nil
+	case "zsh":
+		dir := filepath.Join(homeDir, ".zsh", "completions")
+		return filepath.Join(dir, "_dbx"), fmt.Sprintf("make sure ~/.zshrc has fpath=(%s $fpath) before compinit", dir), nil
+	case "fish":
+		configDir := os.Getenv("XDG_CONFIG_HOME")
+		if configDir == "" {
+			configDir = filepath.Join(homeDir, ".config")
+		}
+		return filepath.Join(configDir, "fish", "completions", "dbx.fish"), "", nil
+	default:
+		return "", "", fmt.Errorf("unsupported shell %q; expected bash, zsh or fish", shell)
+	}
+}
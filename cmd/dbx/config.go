@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fredyranthun/db/internal/config"
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
+)
+
+func (a *app) newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the dbx configuration",
+	}
+	cmd.AddCommand(a.newConfigShowCmd())
+	return cmd
+}
+
+func (a *app) newConfigShowCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Print the resolved config after merging files and applying defaults to each env",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "yaml" && format != "json" {
+				return fmt.Errorf("--format must be yaml or json")
+			}
+
+			cfg, err := a.loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+			resolved := resolveConfig(cfg)
+
+			out := cmd.OutOrStdout()
+			if format == "json" {
+				return writeJSON(out, resolved)
+			}
+			if len(a.configPaths) > 0 {
+				fmt.Fprintf(out, "# merged from: %s\n", strings.Join(a.configPaths, ", "))
+			}
+			enc := yaml.NewEncoder(out)
+			enc.SetIndent(2)
+			if err := enc.Encode(resolved); err != nil {
+				return err
+			}
+			return enc.Close()
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "yaml", "Output format: yaml or json")
+
+	return cmd
+}
+
+// resolveConfig returns cfg with its effective defaults and each env's bind,
+// session TTL, hooks and process env resolved the way connect resolves them.
+// cfg is not modified.
+func resolveConfig(cfg *config.Config) config.Config {
+	resolved := *cfg
+	resolved.Defaults = cfg.EffectiveDefaults()
+	resolved.Services = make([]config.Service, len(cfg.Services))
+	for i, svc := range cfg.Services {
+		envs := make(map[string]config.EnvConfig, len(svc.Envs))
+		for name, env := range svc.Envs {
+			env.Bind = env.BindAddress(resolved.Defaults)
+			ttl := env.TTL(resolved.Defaults)
+			env.SessionTTL = ""
+			if ttl > 0 {
+				env.SessionTTL = ttl.String()
+			}
+			env.PreConnectHook, env.PostStopHook = env.Hooks(resolved.Defaults)
+			env.Env = env.ProcessEnv(resolved.Defaults, nil)
+			envs[name] = env
+		}
+		svc.Envs = envs
+		resolved.Services[i] = svc
+	}
+	return resolved
+}
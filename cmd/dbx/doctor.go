@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const proxyCheckTimeout = 5 * time.Second
+
+var (
+	lookPath = exec.LookPath
+	// probeSSMEndpoint sends one request to endpoint through proxy. Any HTTP
+	// response counts as reachable; only transport errors fail.
+	probeSSMEndpoint = func(ctx context.Context, endpoint string, proxy *url.URL) error {
+		client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxy)}}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+)
+
+// newDoctorCmd checks that the aws CLI, Session Manager plugin and any
+// command_wrapper are installed, that the config loads, and, when a proxy is
+// configured, that the SSM endpoint of the region is reachable through it.
+func (a *app) newDoctorCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check dependencies, config and proxy reachability",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := cmd.OutOrStdout()
+			failed := 0
+			report := func(status, name, detail string) {
+				if status == "FAIL" {
+					failed++
+				}
+				fmt.Fprintf(out, "%-5s %s: %s\n", status, name, detail)
+			}
+
+			for _, bin := range []string{"aws", "session-manager-plugin"} {
+				if path, err := lookPath(bin); err != nil {
+					report("FAIL", bin, "not found in PATH")
+				} else {
+					report("ok", bin, path)
+				}
+			}
+
+			cfg, cfgPaths, err := a.readConfig()
+			if err != nil {
+				report("FAIL", "config", err.Error())
+				return fmt.Errorf("%d check(s) failed", failed)
+			}
+			report("ok", "config", strings.Join(cfgPaths, ", "))
+
+			defaults := cfg.EffectiveDefaults()
+			if len(defaults.CommandWrapper) > 0 {
+				if path, err := lookPath(defaults.CommandWrapper[0]); err != nil {
+					report("FAIL", "command_wrapper", defaults.CommandWrapper[0]+" not found in PATH")
+				} else {
+					report("ok", "command_wrapper", path)
+				}
+			}
+			env := processEnviron(defaults.Env, a.envVars)
+			switch proxy, err := checkProxy(cmd.Context(), defaults.Region, env); {
+			case err != nil:
+				report("FAIL", "proxy", err.Error())
+			case proxy == "":
+				report("skip", "proxy", "no HTTPS_PROXY set")
+			default:
+				report("ok", "proxy", proxy)
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d check(s) failed", failed)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&a.envFile, "env-file", "", "Load KEY=VALUE pairs into the checked environment, as connect does")
+	return cmd
+}
+
+// processEnviron is dbx's own environment with the aws process variables
+// (config env, then --env-file) applied, as the aws CLI will see it.
+func processEnviron(layers ...map[string]string) map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		env[key] = value
+	}
+	for _, layer := range layers {
+		for key, value := range layer {
+			env[strings.ToUpper(key)] = value
+		}
+	}
+	return env
+}
+
+// checkProxy probes the SSM endpoint of region through the HTTPS proxy set in
+// env. It returns "" when no proxy applies, and a description of the
+// successful probe otherwise.
+func checkProxy(ctx context.Context, region string, env map[string]string) (string, error) {
+	if region == "" {
+		region = firstNonEmpty(env["AWS_REGION"], env["AWS_DEFAULT_REGION"])
+	}
+	if region == "" {
+		if proxyValue(env) == "" {
+			return "", nil
+		}
+		return "", fmt.Errorf("a proxy is set but no region is configured to check against")
+	}
+
+	host := fmt.Sprintf("ssm.%s.amazonaws.com", region)
+	proxy, err := proxyFor(env, host)
+	if err != nil || proxy == nil {
+		return "", err
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, proxyCheckTimeout)
+	defer cancel()
+	if err := probeSSMEndpoint(ctx, "https://"+host+"/", proxy); err != nil {
+		return "", fmt.Errorf("%s is not reachable through %s: %w", host, proxy.Redacted(), err)
+	}
+	return fmt.Sprintf("%s reachable through %s", host, proxy.Redacted()), nil
+}
+
+// proxyFor returns the HTTPS proxy the aws CLI would use for host, or nil
+// when none is set or NO_PROXY excludes host.
+func proxyFor(env map[string]string, host string) (*url.URL, error) {
+	raw := proxyValue(env)
+	if raw == "" {
+		return nil, nil
+	}
+	for _, entry := range strings.Split(firstNonEmpty(env["NO_PROXY"], env["no_proxy"]), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "*" {
+			return nil, nil
+		}
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		if entry != "" && (host == entry || strings.HasSuffix(host, "."+entry)) {
+			return nil, nil
+		}
+	}
+
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	proxy, err := url.Parse(raw)
+	if err != nil || proxy.Host == "" {
+		// The value may carry credentials, so it is not echoed.
+		return nil, fmt.Errorf("HTTPS_PROXY is not a valid URL")
+	}
+	return proxy, nil
+}
+
+func proxyValue(env map[string]string) string {
+	return firstNonEmpty(env["HTTPS_PROXY"], env["https_proxy"])
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// preflight runs the proxy check before connecting and fails fast when the
+// SSM endpoint is unreachable through it.
+func preflight(ctx context.Context, region string, env map[string]string, warnOut io.Writer) error {
+	result, err := checkProxy(ctx, region, env)
+	if err != nil {
+		return fmt.Errorf("preflight: %w", err)
+	}
+	if result != "" && warnOut != nil {
+		fmt.Fprintf(warnOut, "preflight: %s\n", result)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// newEnvCmd prints one variable per running session holding its local port,
+// e.g. after `dbx up`, for tooling to eval.
+func (a *app) newEnvCmd() *cobra.Command {
+	var prefix string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "env",
+		Short: "Print export lines with the local port of every running session",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			line, err := envLineFormat(format)
+			if err != nil {
+				return err
+			}
+
+			// Check every name before printing, so a collision never leaves
+			// a partial set of exports behind.
+			summaries := a.manager.List()
+			names := make([]string, len(summaries))
+			seen := make(map[string]string, len(summaries))
+			for i, summary := range summaries {
+				name := envVarName(prefix, summary.Service, summary.Env)
+				if other, ok := seen[name]; ok {
+					return fmt.Errorf("%s and %s both map to %s; rename one or pass a different --prefix", other, summary.Key, name)
+				}
+				seen[name] = string(summary.Key)
+				names[i] = name
+			}
+
+			out := cmd.OutOrStdout()
+			for i, summary := range summaries {
+				fmt.Fprintf(out, line, names[i], summary.LocalPort)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&prefix, "prefix", "DBX", "Variable name prefix")
+	cmd.Flags().StringVar(&format, "format", "sh", "Output syntax: sh, fish or powershell")
+	return cmd
+}
+
+// envLineFormat returns the Printf format of one variable assignment for
+// the given shell syntax.
+func envLineFormat(format string) (string, error) {
+	switch format {
+	case "sh":
+		return "export %s=%d\n", nil
+	case "fish":
+		return "set -gx %s %d\n", nil
+	case "powershell":
+		return "$env:%s = \"%d\"\n", nil
+	default:
+		return "", fmt.Errorf("unsupported --format %q; expected sh, fish or powershell", format)
+	}
+}
+
+// envVarName builds PREFIX_SERVICE_ENV_PORT, upper-cased, with anything that
+// is not a letter or digit (such as "-" or the ":" of a named forward)
+// replaced by "_".
+func envVarName(prefix, service, env string) string {
+	parts := []string{service, env, "port"}
+	if prefix != "" {
+		parts = append([]string{prefix}, parts...)
+	}
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, strings.Join(parts, "_"))
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
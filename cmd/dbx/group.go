@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fredyranthun/db/internal/config"
+	"github.com/fredyranthun/db/internal/session"
+	"github.com/spf13/cobra"
+)
+
+func (a *app) newUpCmd() *cobra.Command {
+	var overrides connectOverrides
+
+	cmd := &cobra.Command{
+		Use:   "up <group>",
+		Short: "Connect every member of a configured group",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := a.loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			refs, err := groupRefs(cfg, args[0])
+			if err != nil {
+				return err
+			}
+			overrides.warnOut = cmd.ErrOrStderr()
+			if a.verbose {
+				overrides.verboseOut = cmd.ErrOrStderr()
+			}
+			return a.connectMany(cmd.OutOrStdout(), cfg, refs, overrides)
+		},
+	}
+
+	cmd.Flags().StringVar(&overrides.bind, "bind", "", "Local bind address override")
+	cmd.Flags().StringVar(&overrides.profile, "profile", "", "AWS profile override")
+	cmd.Flags().StringVar(&overrides.region, "region", "", "AWS region override")
+	cmd.Flags().BoolVar(&overrides.noPortReuse, "no-port-reuse", false, "Ignore pinned local_port values and pick a fresh port from the range")
+
+	return cmd
+}
+
+func (a *app) newDownCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "down <group>",
+		Short: "Stop every member of a configured group",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := a.loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			refs, err := groupRefs(cfg, args[0])
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			summaries := a.manager.List()
+			running := make(map[session.SessionKey]struct{}, len(summaries))
+			for _, summary := range summaries {
+				running[summary.Key] = struct{}{}
+			}
+
+			var errs []error
+			for _, ref := range refs {
+				key := session.NewSessionKey(ref.service, ref.env)
+				keys := forwardGroupKeys(summaries, key)
+				if _, ok := running[key]; ok {
+					keys = append([]session.SessionKey{key}, keys...)
+				}
+				if len(keys) == 0 {
+					fmt.Fprintf(out, "%s not running\n", key)
+					continue
+				}
+				for _, k := range keys {
+					if err := a.manager.Stop(k); err != nil {
+						errs = append(errs, err)
+						continue
+					}
+					fmt.Fprintf(out, "stopped %s\n", k)
+				}
+			}
+			return errors.Join(errs...)
+		},
+	}
+}
+
+// groupRefs resolves a group's "service/env" members from config. Group names
+// match case-insensitively: the config loader lower-cases map keys, so a group
+// written as "Staging" is stored as "staging".
+func groupRefs(cfg *config.Config, name string) ([]envRef, error) {
+	name = strings.TrimSpace(name)
+	members, ok := cfg.Groups[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%s: group not found in config", name)
+	}
+
+	refs := make([]envRef, 0, len(members))
+	for _, member := range members {
+		serviceName, envName, err := parseServiceEnvPair(member)
+		if err != nil {
+			return nil, fmt.Errorf("group %s: %w", name, err)
+		}
+		refs = append(refs, envRef{service: serviceName, env: envName})
+	}
+	return refs, nil
+}
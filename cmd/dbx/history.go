@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fredyranthun/db/internal/history"
+	"github.com/fredyranthun/db/internal/session"
+	"github.com/spf13/cobra"
+)
+
+const defaultHistoryLimit = 20
+
+// historyEventBuffer is the event subscription buffer of the history
+// recorder. Log lines share the bus, so it leaves room for bursts.
+const historyEventBuffer = 1024
+
+// historyManager records successful connects to the history log while
+// delegating everything else to the wrapped manager. A Start that reused a
+// running session is not a connect. Stops are recorded from the manager's
+// events by recordEvents, so sessions that end on their own are logged too.
+type historyManager struct {
+	appSessionManager
+	log *history.Log
+	// warn reports the first failed write; nil discards it.
+	warn     func(string)
+	warnOnce sync.Once
+
+	mu        sync.Mutex
+	connected map[session.SessionKey]bool
+}
+
+func newHistoryManager(inner appSessionManager, log *history.Log, warn func(string)) *historyManager {
+	return &historyManager{
+		appSessionManager: inner,
+		log:               log,
+		warn:              warn,
+		connected:         make(map[session.SessionKey]bool),
+	}
+}
+
+func (h *historyManager) Start(opts session.StartOptions) (session.SessionSnapshot, error) {
+	s, err := h.appSessionManager.Start(opts)
+	if err != nil || s.Reused {
+		return s, err
+	}
+	h.mu.Lock()
+	h.connected[s.Key] = true
+	h.mu.Unlock()
+	h.append(history.Entry{
+		Event:    history.EventConnect,
+		Key:      string(s.Key),
+		Service:  s.Service,
+		Env:      s.Env,
+		Endpoint: fmt.Sprintf("%s:%d", s.Bind, s.LocalPort),
+		Profile:  opts.Profile,
+		Region:   opts.Region,
+	})
+	return s, nil
+}
+
+// follow records stops from m's events until the returned func is called.
+// That func waits until the events already delivered are written.
+func (h *historyManager) follow(m *session.Manager) func() {
+	id, events := m.Subscribe(historyEventBuffer)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.recordEvents(events)
+	}()
+	return func() {
+		m.Unsubscribe(id)
+		<-done
+	}
+}
+
+// recordEvents logs a stop for each connected session that ends, whether it
+// was stopped or killed, timed out, failed its health check or exited. Stops
+// of sessions Start did not log as connects (failed starts, bench runs) are
+// skipped. It returns once events is closed.
+func (h *historyManager) recordEvents(events <-chan session.Event) {
+	for e := range events {
+		if e.Type != session.EventSessionStopped && e.Type != session.EventSessionError {
+			continue
+		}
+		h.mu.Lock()
+		connected := h.connected[e.Key]
+		delete(h.connected, e.Key)
+		h.mu.Unlock()
+		if !connected {
+			continue
+		}
+		h.append(history.Entry{
+			Event:    history.EventStop,
+			Key:      string(e.Key),
+			Service:  e.Service,
+			Env:      e.Env,
+			Endpoint: e.Endpoint,
+		})
+	}
+}
+
+// append writes e, reporting only the first failure so a broken history
+// file does not repeat on every connect.
+func (h *historyManager) append(e history.Entry) {
+	err := h.log.Append(e)
+	if err == nil || h.warn == nil {
+		return
+	}
+	h.warnOnce.Do(func() {
+		h.warn(fmt.Sprintf("history: %v", err))
+	})
+}
+
+func (a *app) newHistoryCmd() *cobra.Command {
+	var limit int
+	var service string
+
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Show recent connects and stops",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if limit < 0 {
+				return fmt.Errorf("limit must be >= 0")
+			}
+
+			entries, err := a.history.Read()
+			if err != nil {
+				return err
+			}
+			entries = filterHistory(entries, service, limit)
+			if len(entries) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "no history")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TIME\tEVENT\tKEY\tENDPOINT\tPROFILE\tREGION")
+			for _, e := range entries {
+				fmt.Fprintf(
+					w,
+					"%s\t%s\t%s\t%s\t%s\t%s\n",
+					e.Time.Local().Format(time.DateTime),
+					e.Event,
+					e.Key,
+					e.Endpoint,
+					e.Profile,
+					e.Region,
+				)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().IntVar(&limit, "limit", defaultHistoryLimit, "Number of most recent entries to show (0 for all)")
+	cmd.Flags().StringVar(&service, "service", "", "Only show entries for this service")
+
+	return cmd
+}
+
+// filterHistory keeps entries for service (all when empty) and returns the
+// last limit of them, oldest first.
+func filterHistory(entries []history.Entry, service string, limit int) []history.Entry {
+	filtered := entries
+	if service != "" {
+		filtered = make([]history.Entry, 0, len(entries))
+		for _, e := range entries {
+			if e.Service == service {
+				filtered = append(filtered, e)
+			}
+		}
+	}
+	if limit > 0 && len(filtered) > limit {
+		filtered = filtered[len(filtered)-limit:]
+	}
+	return filtered
+}
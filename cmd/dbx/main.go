@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
@@ -12,14 +16,27 @@ import (
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/term"
 	"github.com/fredyranthun/db/internal/config"
+	"github.com/fredyranthun/db/internal/history"
 	"github.com/fredyranthun/db/internal/session"
 	"github.com/fredyranthun/db/internal/ui"
+	"github.com/fredyranthun/db/internal/uistate"
+	"github.com/fredyranthun/db/internal/webhook"
 	"github.com/spf13/cobra"
 )
 
 const defaultLogLines = 100
 
+// allLogLines is the --lines value that shows the whole log buffer.
+const allLogLines = -1
+
+// logStreamBuffer is the subscriber buffer for `logs --follow`.
+const logStreamBuffer = 256
+
+// webhookFlushTimeout bounds how long dbx waits on exit for pending webhooks.
+const webhookFlushTimeout = 3 * time.Second
+
 var (
 	version = "dev"
 	commit  = "none"
@@ -27,35 +44,103 @@ var (
 )
 
 type app struct {
-	configPath string
-	verbose    bool
-	noCleanup  bool
+	configPath   string
+	configPaths  []string
+	strictConfig bool
+	verbose      bool
+	noCleanup    bool
+	// allowPublicBind permits sessions on non-loopback bind addresses.
+	allowPublicBind bool
+	// allowHooks runs config hooks even when allow_hooks is not set, e.g.
+	// those of a project config, which may not set it itself.
+	allowHooks bool
+	// envFile is the --env-file of connect and ui; envVars are its variables,
+	// passed to every aws process over the config's env.
+	envFile string
+	envVars map[string]string
 
-	manager appSessionManager
+	manager  appSessionManager
+	history  *history.Log
+	webhooks *webhook.Notifier
+	// flushHistory stops recording session events to history once those
+	// already delivered are written; nil without a history log.
+	flushHistory func()
+
+	// uiMu guards the running UI, which signal cleanup asks to quit before
+	// stopping sessions so the terminal is restored.
+	uiMu     sync.Mutex
+	uiSender teaSender
+	uiDone   chan struct{}
+	uiReload bool
+
+	// exit and terminalAttached default to os.Exit and a stdin terminal
+	// check; tests replace them.
+	exit             func(code int)
+	terminalAttached func() bool
 }
 
 type appSessionManager interface {
-	Start(opts session.StartOptions) (*session.Session, error)
+	Start(opts session.StartOptions) (session.SessionSnapshot, error)
 	Stop(key session.SessionKey) error
+	Kill(key session.SessionKey) error
 	StopAll() error
+	StopAllWithTimeout(d time.Duration) error
+	Close() error
 	List() []session.SessionSummary
-	Get(key session.SessionKey) (*session.Session, bool)
-	LastLogs(key session.SessionKey, n int) ([]string, error)
-	SubscribeLogs(key session.SessionKey, buffer int) (uint64, <-chan string, error)
+	RecentlyStopped() []session.SessionSummary
+	Summary(key session.SessionKey) (session.SessionSummary, bool)
+	Get(key session.SessionKey) (session.SessionSnapshot, bool)
+	LastLogs(key session.SessionKey, n int) ([]session.LogEntry, error)
+	SubscribeLogsWithReplay(key session.SessionKey, n, buffer int, policy session.DropPolicy) (uint64, <-chan session.LogEntry, error)
 	UnsubscribeLogs(key session.SessionKey, id uint64)
+	SubscriberStats(key session.SessionKey, id uint64) (session.SubscriberStats, error)
+	Orphans(min, max int) ([]session.PortOwner, error)
 }
 
 type teaRunner interface {
 	Run() (tea.Model, error)
 }
 
+type teaSender interface {
+	Send(msg tea.Msg)
+}
+
 var newTeaRunner = func(model tea.Model) teaRunner {
 	return tea.NewProgram(model)
 }
 
+// uiQuitTimeout bounds how long signal cleanup waits for the UI to exit.
+const uiQuitTimeout = 2 * time.Second
+
+// signalCleanupTimeout bounds how long signal cleanup waits for sessions to
+// stop, so a port that never releases cannot keep dbx from exiting.
+const signalCleanupTimeout = 10 * time.Second
+
+// outputIsTTY picks human output over the stable piped format.
+var outputIsTTY = isTTY
+
+// isTTY reports whether w is a terminal.
+func isTTY(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(f.Fd())
+}
+
 func main() {
+	sessions := session.NewManager()
 	a := &app{
-		manager: session.NewManager(),
+		manager:  sessions,
+		webhooks: webhook.NewNotifier(),
+	}
+	a.webhooks.OnError = func(e session.Event, err error) {
+		a.warn(os.Stderr, fmt.Sprintf("webhook for %s %s failed: %v", e.Type, e.Key, err))
+	}
+	sessions.SetEventHandler(a.webhooks.Handle)
+	defer a.webhooks.Wait(webhookFlushTimeout)
+	if path, err := history.DefaultPath(); err == nil {
+		a.history = history.NewLog(path)
+		recorder := newHistoryManager(a.manager, a.history, func(text string) { a.warn(os.Stderr, text) })
+		a.flushHistory = recorder.follow(sessions)
+		a.manager = recorder
 	}
 
 	rootCmd := newRootCmd(a)
@@ -63,9 +148,11 @@ func main() {
 	defer stopSignalCleanup()
 
 	if err := rootCmd.Execute(); err != nil {
+		a.webhooks.Wait(webhookFlushTimeout)
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		a.exitProcess(1)
 	}
+	a.finishHistory()
 }
 
 func newRootCmd(a *app) *cobra.Command {
@@ -78,15 +165,31 @@ func newRootCmd(a *app) *cobra.Command {
 	}
 
 	rootCmd.PersistentFlags().StringVar(&a.configPath, "config", "", "Path to config file")
+	rootCmd.PersistentFlags().BoolVar(&a.strictConfig, "strict-config", false, "Reject unknown config keys (also $DBX_STRICT_CONFIG)")
 	rootCmd.PersistentFlags().BoolVar(&a.verbose, "verbose", false, "Enable verbose output")
 	rootCmd.PersistentFlags().BoolVar(&a.noCleanup, "no-cleanup", false, "Skip stopping sessions on exit")
+	rootCmd.PersistentFlags().BoolVar(&a.allowPublicBind, "allow-public-bind", false, "Allow binding sessions to non-loopback addresses")
+	rootCmd.PersistentFlags().BoolVar(&a.allowHooks, "allow-hooks", false, "Run the hooks of every loaded config, including project configs")
 
 	rootCmd.AddCommand(a.newConnectCmd())
 	rootCmd.AddCommand(a.newLsCmd())
+	rootCmd.AddCommand(a.newTargetsCmd())
+	rootCmd.AddCommand(a.newEnvCmd())
+	rootCmd.AddCommand(a.newPortCmd())
+	rootCmd.AddCommand(a.newStatusCmd())
 	rootCmd.AddCommand(a.newLogsCmd())
 	rootCmd.AddCommand(a.newStopCmd())
+	rootCmd.AddCommand(a.newKillCmd())
+	rootCmd.AddCommand(a.newReapCmd())
+	rootCmd.AddCommand(a.newDoctorCmd())
+	rootCmd.AddCommand(a.newBenchCmd())
+	rootCmd.AddCommand(a.newUpCmd())
+	rootCmd.AddCommand(a.newDownCmd())
 	rootCmd.AddCommand(a.newUICmd())
+	rootCmd.AddCommand(a.newHistoryCmd())
+	rootCmd.AddCommand(a.newConfigCmd())
 	rootCmd.AddCommand(newVersionCmd())
+	addCompletionInstallCmd(rootCmd)
 
 	return rootCmd
 }
@@ -107,61 +210,237 @@ func buildVersionString() string {
 }
 
 func (a *app) newUICmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "ui",
 		Short: "Launch terminal UI",
 		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, cfgPath, err := config.LoadConfig(a.configPath)
+			cfg, err := a.loadConfig(cmd)
 			if err != nil {
 				return err
 			}
-			if err := config.Validate(cfg); err != nil {
-				return err
-			}
-			if a.verbose {
-				fmt.Fprintf(cmd.ErrOrStderr(), "using config: %s\n", cfgPath)
-			}
 
-			if err := a.runUI(cfg); err != nil {
-				return err
+			// Clean up even when the UI exits with an error (e.g. its
+			// terminal went away) so no aws process outlives dbx.
+			err = a.runUI(cfg)
+			if cleanupErr := a.cleanupSessions(); err == nil {
+				err = cleanupErr
 			}
-			return a.cleanupSessions()
+			return err
 		},
 	}
+
+	cmd.Flags().StringVar(&a.envFile, "env-file", "", "Load KEY=VALUE pairs (e.g. AWS credentials) into the aws process environment")
+	return cmd
+}
+
+func (a *app) loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	cfg, cfgPaths, err := a.readConfig()
+	if err != nil {
+		return nil, err
+	}
+	if a.verbose {
+		fmt.Fprintf(cmd.ErrOrStderr(), "using config: %s\n", strings.Join(cfgPaths, ", "))
+	}
+	a.configPaths = cfgPaths
+	return cfg, nil
+}
+
+func (a *app) readConfig() (*config.Config, []string, error) {
+	cfg, cfgPaths, err := config.LoadConfigWithOptions(a.configPath, config.LoadOptions{Strict: a.strictConfig, AllowHooks: a.allowHooks})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := config.ValidateWithOptions(cfg, config.ValidateOptions{Strict: a.strictConfig}); err != nil {
+		return nil, nil, err
+	}
+	if _, err := ui.NewKeyMap(cfg.UI.Keys); err != nil {
+		return nil, nil, err
+	}
+	if a.envFile != "" {
+		vars, err := config.LoadEnvFile(a.envFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		config.ApplyEnvFile(cfg, vars)
+		a.envVars = vars
+	}
+	if a.webhooks != nil {
+		a.webhooks.SetURL(cfg.EffectiveDefaults().WebhookURL)
+	}
+	return cfg, cfgPaths, nil
 }
 
 func (a *app) runUI(cfg *config.Config) error {
-	runner := newTeaRunner(ui.NewModel(a.manager, cfg))
+	model := ui.NewModel(a.manager, cfg).WithPublicBind(a.allowPublicBind).WithEnvFile(a.envVars)
+	if statePath, err := uistate.DefaultPath(); err == nil {
+		model = model.WithStateFile(statePath)
+	}
+	if len(a.configPaths) > 0 {
+		editPath := a.configPaths[len(a.configPaths)-1]
+		model = model.WithConfigReload(editPath, func() (*config.Config, error) {
+			cfg, _, err := a.readConfig()
+			return cfg, err
+		})
+	}
+	runner := newTeaRunner(model)
+	sender, ok := runner.(teaSender)
+	reload := ok && len(a.configPaths) > 0
+	if reload {
+		stopReload := installReloadSignal(func() {
+			sender.Send(ui.ReloadConfigMsg{})
+		})
+		defer stopReload()
+	}
+
+	done := make(chan struct{})
+	a.uiMu.Lock()
+	a.uiSender, a.uiDone, a.uiReload = sender, done, reload
+	a.uiMu.Unlock()
+	defer func() {
+		a.uiMu.Lock()
+		a.uiSender, a.uiDone, a.uiReload = nil, nil, false
+		a.uiMu.Unlock()
+		close(done)
+	}()
+
 	_, err := runner.Run()
 	return err
 }
 
-func (a *app) installSignalCleanup(errOut io.Writer) func() {
+// reloadsOnHangup reports whether SIGHUP means "reload the config" rather than
+// "the terminal is gone": only while the UI runs with a config and stdin is
+// still attached.
+func (a *app) reloadsOnHangup() bool {
+	a.uiMu.Lock()
+	reload := a.uiReload
+	a.uiMu.Unlock()
+	return reload && a.stdinAttached()
+}
+
+// stdinAttached reports whether stdin is still a live terminal; it turns
+// false once the terminal hangs up.
+func (a *app) stdinAttached() bool {
+	if a.terminalAttached != nil {
+		return a.terminalAttached()
+	}
+	return term.IsTerminal(os.Stdin.Fd())
+}
+
+func (a *app) exitProcess(code int) {
+	a.finishHistory()
+	if a.exit != nil {
+		a.exit(code)
+		return
+	}
+	os.Exit(code)
+}
+
+// finishHistory writes the stops still queued for the history log. It is
+// safe to call more than once.
+func (a *app) finishHistory() {
+	if a.flushHistory != nil {
+		a.flushHistory()
+	}
+}
+
+// warn reports text on errOut, or in the status line of a running UI, where
+// a write to stderr would corrupt the screen.
+func (a *app) warn(errOut io.Writer, text string) {
+	a.uiMu.Lock()
+	sender, done := a.uiSender, a.uiDone
+	a.uiMu.Unlock()
+	if done != nil {
+		if sender != nil {
+			sender.Send(ui.WarningMsg{Text: text})
+		}
+		return
+	}
+	fmt.Fprintf(errOut, "dbx: %s\n", text)
+}
+
+// quitUI asks a running UI to exit and waits briefly for it to restore the
+// terminal. It is a no-op outside UI mode.
+func (a *app) quitUI() {
+	a.uiMu.Lock()
+	sender, done := a.uiSender, a.uiDone
+	a.uiMu.Unlock()
+	if done == nil {
+		return
+	}
+	if sender != nil {
+		sender.Send(tea.Quit())
+	}
+	select {
+	case <-done:
+	case <-time.After(uiQuitTimeout):
+	}
+}
+
+// installReloadSignal calls reload on every SIGHUP until the returned func is
+// called. Sessions are untouched; only the UI's config is swapped.
+func installReloadSignal(reload func()) func() {
 	sigCh := make(chan os.Signal, 1)
 	done := make(chan struct{})
-	var once sync.Once
 
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(sigCh, syscall.SIGHUP)
 
 	go func() {
-		select {
-		case <-done:
-			return
-		case <-sigCh:
+		for {
+			select {
+			case <-done:
+				return
+			case <-sigCh:
+				reload()
+			}
 		}
+	}()
 
-		once.Do(func() {
-			if err := a.cleanupSessions(); err != nil {
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+	}
+}
+
+// installSignalCleanup stops every session and exits when dbx receives
+// SIGINT, SIGTERM or SIGHUP, so the aws children (which run in their own
+// process group) never outlive it. In UI mode the UI is told to quit first;
+// a SIGHUP while its terminal is still attached is left to the config reload.
+//
+// The returned func stops listening and waits for the handler goroutine to
+// return, so nothing it reads outlives the call.
+func (a *app) installSignalCleanup(errOut io.Writer) func() {
+	sigCh := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	exited := make(chan struct{})
+
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+	go func() {
+		defer close(exited)
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-sigCh:
+				if sig == syscall.SIGHUP && a.reloadsOnHangup() {
+					continue
+				}
+			}
+
+			a.quitUI()
+			if err := a.cleanupSessionsWithin(signalCleanupTimeout); err != nil {
 				fmt.Fprintf(errOut, "cleanup failed: %v\n", err)
 			}
-			os.Exit(130)
-		})
+			a.exitProcess(130)
+			return
+		}
 	}()
 
 	return func() {
-		close(done)
 		signal.Stop(sigCh)
+		close(done)
+		<-exited
 	}
 }
 
@@ -169,194 +448,878 @@ func (a *app) cleanupSessions() error {
 	if a.noCleanup || a.manager == nil {
 		return nil
 	}
-	if err := a.manager.StopAll(); err != nil {
+	if err := a.manager.Close(); err != nil {
 		return err
 	}
 	return nil
 }
 
+// cleanupSessionsWithin is cleanupSessions for the signal path: it gives up
+// after d instead of waiting for every session to release its port.
+func (a *app) cleanupSessionsWithin(d time.Duration) error {
+	if a.noCleanup || a.manager == nil {
+		return nil
+	}
+	return a.manager.StopAllWithTimeout(d)
+}
+
+// connectOverrides holds the per-invocation flags that override config defaults.
+type connectOverrides struct {
+	localPort   int
+	bind        string
+	profile     string
+	region      string
+	noPortReuse bool
+	// targetInstance, remoteHost and remotePort replace the env's target.
+	targetInstance string
+	remoteHost     string
+	remotePort     int
+	// refreshTarget looks a target_tag up again instead of using the cache.
+	refreshTarget bool
+	// startupTimeout replaces defaults.startup_timeout_seconds.
+	startupTimeout time.Duration
+	// reuse returns an already running session instead of failing.
+	reuse bool
+	// preflight checks the SSM endpoint through the configured proxy first.
+	preflight bool
+	// verboseOut, when set, receives the aws output live while connecting.
+	verboseOut io.Writer
+	// warnOut receives warnings such as a non-loopback bind.
+	warnOut io.Writer
+}
+
 func (a *app) newConnectCmd() *cobra.Command {
-	var localPort int
-	var bindOverride string
-	var profileOverride string
-	var regionOverride string
+	var overrides connectOverrides
+	var allEnvs bool
+	var jsonOut bool
+
+	connect := func(cmd *cobra.Command, args []string) error {
+		if allEnvs {
+			if len(args) != 1 {
+				return fmt.Errorf("--all-envs takes exactly one service")
+			}
+			if overrides.localPort > 0 {
+				return fmt.Errorf("--port cannot be used with --all-envs")
+			}
+			if jsonOut {
+				return fmt.Errorf("--json cannot be used with --all-envs")
+			}
+			for _, name := range []string{"target-instance", "remote-host", "remote-port"} {
+				if cmd.Flags().Changed(name) {
+					return fmt.Errorf("--%s cannot be used with --all-envs", name)
+				}
+			}
+		} else if len(args) != 2 {
+			return fmt.Errorf("service and env are required")
+		}
+		if overrides.noPortReuse && overrides.localPort > 0 {
+			return fmt.Errorf("--port cannot be used with --no-port-reuse")
+		}
+		if cmd.Flags().Changed("target-instance") {
+			overrides.targetInstance = strings.TrimSpace(overrides.targetInstance)
+			if overrides.targetInstance == "" {
+				return fmt.Errorf("--target-instance must not be empty")
+			}
+		}
+		if cmd.Flags().Changed("remote-host") {
+			overrides.remoteHost = strings.TrimSpace(overrides.remoteHost)
+			if overrides.remoteHost == "" {
+				return fmt.Errorf("--remote-host must not be empty")
+			}
+		}
+		if cmd.Flags().Changed("remote-port") && (overrides.remotePort < 1 || overrides.remotePort > 65535) {
+			return fmt.Errorf("--remote-port must be between 1 and 65535")
+		}
+		if cmd.Flags().Changed("timeout") && overrides.startupTimeout <= 0 {
+			return fmt.Errorf("--timeout must be positive")
+		}
+
+		serviceName := strings.TrimSpace(args[0])
+		if serviceName == "" {
+			return fmt.Errorf("service and env are required")
+		}
+
+		cfg, err := a.loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		if len(cfg.Services) == 0 {
+			return a.noServicesError()
+		}
+		overrides.warnOut = cmd.ErrOrStderr()
+		if a.verbose {
+			overrides.verboseOut = cmd.ErrOrStderr()
+		}
+		if allEnvs {
+			return a.connectAllEnvs(cmd.OutOrStdout(), cfg, serviceName, overrides)
+		}
+
+		envName := strings.TrimSpace(args[1])
+		if envName == "" {
+			return fmt.Errorf("service and env are required")
+		}
+		envCfg, err := findEnvConfig(cfg, serviceName, envName)
+		if err != nil {
+			return err
+		}
+
+		started, err := a.connectEnv(cfg.EffectiveDefaults(), serviceName, envName, envCfg, overrides)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		forwards := envCfg.Forwards()
+		if jsonOut {
+			return writeJSON(out, newConnectResult(started, forwards))
+		}
+		if outputIsTTY(out) {
+			return writeConnectSummary(out, serviceName, envName, started, forwards)
+		}
+		writeConnectKeyValues(out, serviceName, envName, started, forwards)
+		return nil
+	}
 
 	cmd := &cobra.Command{
 		Use:   "connect <service> <env>",
 		Short: "Start a port-forward session",
-		Args:  cobra.ExactArgs(2),
+		Long:  "Start a port-forward session. With --all-envs, pass only <service> to connect every env it defines.",
+		Args:  cobra.RangeArgs(1, 2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			serviceName := strings.TrimSpace(args[0])
-			envName := strings.TrimSpace(args[1])
-			if serviceName == "" || envName == "" {
-				return fmt.Errorf("service and env are required")
+			err := connect(cmd, args)
+			if err != nil && jsonOut {
+				_ = writeJSON(cmd.OutOrStdout(), connectErrorJSON{Error: err.Error()})
 			}
+			return err
+		},
+	}
 
-			cfg, cfgPath, err := config.LoadConfig(a.configPath)
-			if err != nil {
-				return err
-			}
-			if err := config.Validate(cfg); err != nil {
-				return err
-			}
-			if a.verbose {
-				fmt.Fprintf(cmd.ErrOrStderr(), "using config: %s\n", cfgPath)
-			}
+	cmd.Flags().IntVar(&overrides.localPort, "port", 0, "Local bind port override")
+	cmd.Flags().StringVar(&overrides.bind, "bind", "", "Local bind address override")
+	cmd.Flags().StringVar(&overrides.profile, "profile", "", "AWS profile override")
+	cmd.Flags().StringVar(&overrides.region, "region", "", "AWS region override")
+	cmd.Flags().StringVar(&overrides.targetInstance, "target-instance", "", "Target (jumpbox) instance ID override")
+	cmd.Flags().DurationVar(&overrides.startupTimeout, "timeout", 0, "Startup timeout override, e.g. 30s or 2m")
+	cmd.Flags().BoolVar(&overrides.refreshTarget, "refresh", false, "Look up a target_tag instance again instead of using the cached one")
+	cmd.Flags().StringVar(&overrides.remoteHost, "remote-host", "", "Remote host override, e.g. a replica endpoint")
+	cmd.Flags().IntVar(&overrides.remotePort, "remote-port", 0, "Remote port override")
+	cmd.Flags().BoolVar(&allEnvs, "all-envs", false, "Connect every env of the given service")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Print the result as JSON")
+	cmd.Flags().BoolVar(&overrides.noPortReuse, "no-port-reuse", false, "Ignore pinned local_port values and pick a fresh port from the range")
+	cmd.Flags().BoolVar(&overrides.reuse, "reuse", false, "Succeed with the existing endpoint when the session is already running")
+	cmd.Flags().StringVar(&a.envFile, "env-file", "", "Load KEY=VALUE pairs (e.g. AWS credentials) into the aws process environment")
+	cmd.Flags().BoolVar(&overrides.preflight, "preflight", false, "When HTTPS_PROXY is set, check the SSM endpoint is reachable through it before connecting")
 
-			defaults := cfg.EffectiveDefaults()
-			envCfg, err := findEnvConfig(cfg, serviceName, envName)
-			if err != nil {
-				return err
-			}
+	return cmd
+}
 
-			bind := defaults.Bind
-			if bindOverride != "" {
-				bind = bindOverride
-			}
-			profile := defaults.Profile
-			if profileOverride != "" {
-				profile = profileOverride
-			}
-			region := defaults.Region
-			if regionOverride != "" {
-				region = regionOverride
-			}
+// connectResult is the --json output of a successful connect. Forwards lists
+// every forward of a multi-port env; the top-level fields describe the first.
+type connectResult struct {
+	Service    string             `json:"service"`
+	Env        string             `json:"env"`
+	Bind       string             `json:"bind"`
+	LocalPort  int                `json:"local_port"`
+	RemoteHost string             `json:"remote_host"`
+	RemotePort int                `json:"remote_port"`
+	PID        int                `json:"pid"`
+	State      string             `json:"state"`
+	Forwards   []connectedForward `json:"forwards,omitempty"`
+}
 
-			opts := session.StartOptions{
-				Service:          serviceName,
-				Env:              envName,
-				Bind:             bind,
-				PortMin:          defaults.PortRange[0],
-				PortMax:          defaults.PortRange[1],
-				TargetInstanceID: envCfg.TargetInstanceID,
-				RemoteHost:       envCfg.RemoteHost,
-				RemotePort:       envCfg.RemotePort,
-				Region:           region,
-				Profile:          profile,
-				StartupTimeout:   time.Duration(defaults.StartupTimeoutSeconds) * time.Second,
-			}
-			if envCfg.LocalPort > 0 {
-				opts.LocalPort = envCfg.LocalPort
-			}
-			if localPort > 0 {
-				opts.LocalPort = localPort
-			}
+type connectedForward struct {
+	Name       string `json:"name"`
+	Bind       string `json:"bind"`
+	LocalPort  int    `json:"local_port"`
+	RemotePort int    `json:"remote_port"`
+	PID        int    `json:"pid"`
+	State      string `json:"state"`
+}
 
-			s, err := a.manager.Start(opts)
-			if err != nil {
-				return err
+type connectErrorJSON struct {
+	Error string `json:"error"`
+}
+
+func newConnectResult(started []session.SessionSnapshot, forwards []config.PortConfig) connectResult {
+	first := started[0]
+	result := connectResult{
+		Service:    first.Service,
+		Env:        strings.TrimSuffix(first.Env, ":"+forwards[0].Name),
+		Bind:       first.Bind,
+		LocalPort:  first.LocalPort,
+		RemoteHost: first.RemoteHost,
+		RemotePort: first.RemotePort,
+		PID:        first.PID,
+		State:      string(first.State),
+	}
+	if len(started) > 1 {
+		for i, s := range started {
+			result.Forwards = append(result.Forwards, connectedForward{
+				Name:       forwards[i].Name,
+				Bind:       s.Bind,
+				LocalPort:  s.LocalPort,
+				RemotePort: s.RemotePort,
+				PID:        s.PID,
+				State:      string(s.State),
+			})
+		}
+	}
+	return result
+}
+
+// writeConnectKeyValues prints the result of connect as key=value lines, the
+// stable format scripts parse when stdout is not a terminal.
+func writeConnectKeyValues(out io.Writer, serviceName, envName string, started []session.SessionSnapshot, forwards []config.PortConfig) {
+	first := started[0]
+	fmt.Fprintf(out, "service=%s env=%s\n", serviceName, envName)
+	if len(forwards) == 1 {
+		fmt.Fprintf(out, "remote=%s:%d\n", first.RemoteHost, first.RemotePort)
+	} else {
+		for i, s := range started {
+			name := strings.ToUpper(forwards[i].Name)
+			fmt.Fprintf(out, "remote_%s=%s:%d\n", forwards[i].Name, s.RemoteHost, s.RemotePort)
+			fmt.Fprintf(out, "ENDPOINT_%s=%s:%d\n", name, s.Bind, s.LocalPort)
+		}
+	}
+	fmt.Fprintf(out, "ENDPOINT=%s:%d\n", first.Bind, first.LocalPort)
+}
+
+// writeConnectSummary prints the result of connect for a person at a
+// terminal: one line per forward, local endpoint first.
+func writeConnectSummary(out io.Writer, serviceName, envName string, started []session.SessionSnapshot, forwards []config.PortConfig) error {
+	fmt.Fprintf(out, "Connected %s\n", session.NewSessionKey(serviceName, envName))
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for i, s := range started {
+		name := forwards[i].Name
+		if name == "" {
+			name = "endpoint"
+		}
+		fmt.Fprintf(w, "  %s\t%s:%d -> %s:%d\n", name, s.Bind, s.LocalPort, s.RemoteHost, s.RemotePort)
+	}
+	return w.Flush()
+}
+
+func writeJSON(out io.Writer, v any) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// connectEnv starts one session per forward of envCfg. If any forward fails,
+// the ones already started are stopped again.
+func (a *app) connectEnv(defaults config.Defaults, serviceName, envName string, envCfg config.EnvConfig, o connectOverrides) ([]session.SessionSnapshot, error) {
+	bind := envCfg.BindAddress(defaults)
+	if o.bind != "" {
+		bind = o.bind
+	}
+	profile := defaults.Profile
+	if o.profile != "" {
+		profile = o.profile
+	}
+	region := defaults.Region
+	if o.region != "" {
+		region = o.region
+	}
+
+	if !config.IsLoopbackBind(bind) {
+		if !a.allowPublicBind {
+			return nil, fmt.Errorf("%s/%s: bind %s is not a loopback address and would expose the database to the network; pass --allow-public-bind to proceed", serviceName, envName, bind)
+		}
+		if o.warnOut != nil {
+			fmt.Fprintf(o.warnOut, "WARNING: %s/%s binds to %s; the database is reachable from the network\n", serviceName, envName, bind)
+		}
+	}
+
+	processEnv := envCfg.ProcessEnv(defaults, a.envVars)
+	if o.preflight {
+		if err := preflight(context.Background(), region, processEnviron(processEnv), o.warnOut); err != nil {
+			return nil, fmt.Errorf("%s/%s: %w", serviceName, envName, err)
+		}
+	}
+
+	forwards := envCfg.Forwards()
+	if o.localPort > 0 && len(forwards) > 1 {
+		return nil, fmt.Errorf("%s/%s: --port cannot be used with a multi-port env", serviceName, envName)
+	}
+	if o.remotePort > 0 && len(forwards) > 1 {
+		return nil, fmt.Errorf("%s/%s: --remote-port cannot be used with a multi-port env", serviceName, envName)
+	}
+
+	preHook, postHook := envCfg.Hooks(defaults)
+	logTap := newLogTap(o.verboseOut)
+	started := make([]session.SessionSnapshot, 0, len(forwards))
+	for i, fwd := range forwards {
+		opts, err := a.sessionOptions(defaults, serviceName, envName, envCfg, fwd)
+		if err != nil {
+			return nil, err
+		}
+		opts.Bind = bind
+		opts.Region = region
+		opts.Profile = profile
+		opts.NoPortReuse = (o.noPortReuse || defaults.PortReuseDisabled()) && o.localPort == 0
+		opts.ReuseExisting = o.reuse
+		if o.startupTimeout > 0 {
+			opts.StartupTimeout = o.startupTimeout
+			opts.SkipReadiness = false
+		}
+		if o.targetInstance != "" {
+			opts.TargetInstanceID = o.targetInstance
+		}
+		if o.remoteHost != "" {
+			opts.RemoteHost = o.remoteHost
+		}
+		if o.remotePort > 0 {
+			opts.RemotePort = o.remotePort
+		}
+		// Hooks belong to the env, so only its first forward runs them.
+		// Its lookup also refreshes the target the other forwards reuse.
+		if i == 0 {
+			opts.PreConnectHook = preHook
+			opts.PostStopHook = postHook
+			opts.RefreshTarget = o.refreshTarget
+		}
+		if logTap != nil {
+			key := session.NewSessionKey(opts.Service, opts.Env)
+			opts.LogTap = func(line string) { logTap(key, line) }
+		}
+		if o.localPort > 0 {
+			opts.LocalPort = o.localPort
+		}
+
+		s, err := a.manager.Start(opts)
+		if err != nil {
+			// Sessions that were already running before this connect are
+			// left alone.
+			for _, prev := range started {
+				if !prev.Reused {
+					_ = a.manager.Stop(prev.Key)
+				}
 			}
+			return nil, err
+		}
+		started = append(started, s)
+	}
+	return started, nil
+}
 
-			fmt.Fprintf(cmd.OutOrStdout(), "service=%s env=%s\n", s.Service, s.Env)
-			fmt.Fprintf(cmd.OutOrStdout(), "remote=%s:%d\n", s.RemoteHost, s.RemotePort)
-			fmt.Fprintf(cmd.OutOrStdout(), "ENDPOINT=%s:%d\n", s.Bind, s.LocalPort)
-			return nil
-		},
+// sessionOptions builds the StartOptions of one forward of envCfg from the
+// config alone. Callers layer their command-line overrides on top.
+func (a *app) sessionOptions(defaults config.Defaults, serviceName, envName string, envCfg config.EnvConfig, fwd config.PortConfig) (session.StartOptions, error) {
+	readyBanner, err := defaults.ReadyBannerPattern()
+	if err != nil {
+		return session.StartOptions{}, fmt.Errorf("defaults.ready_banner: %w", err)
 	}
 
-	cmd.Flags().IntVar(&localPort, "port", 0, "Local bind port override")
-	cmd.Flags().StringVar(&bindOverride, "bind", "", "Local bind address override")
-	cmd.Flags().StringVar(&profileOverride, "profile", "", "AWS profile override")
-	cmd.Flags().StringVar(&regionOverride, "region", "", "AWS region override")
+	return session.StartOptions{
+		Service:               serviceName,
+		Env:                   fwd.EnvName(envName),
+		Bind:                  envCfg.BindAddress(defaults),
+		LocalPort:             fwd.LocalPort,
+		PortMin:               defaults.PortRange[0],
+		PortMax:               defaults.PortRange[1],
+		TargetInstanceID:      envCfg.TargetInstanceID,
+		TargetTag:             envCfg.TargetTag,
+		TargetCacheTTL:        defaults.TargetCacheTTLDuration(),
+		RemoteHost:            envCfg.RemoteHost,
+		RemotePort:            fwd.RemotePort,
+		Region:                defaults.Region,
+		Profile:               defaults.Profile,
+		StartupTimeout:        defaults.StartupTimeout(),
+		ReadinessPollInterval: defaults.ReadyPollIntervalDuration(),
+		ReadinessRetries:      defaults.ReadyRetryLimit(),
+		SSMAssignedPort:       defaults.AutoPort == config.AutoPortSSM,
+		SkipReadiness:         defaults.StartupTimeout() == 0,
+		ReadyBanner:           readyBanner,
+		BannerOnly:            defaults.ReadyCheck == config.ReadyCheckBanner,
+		NoPortReuse:           defaults.PortReuseDisabled(),
+		PortStrategy:          session.PortStrategy(defaults.PortStrategy),
+		IdleTimeout:           defaults.IdleTimeoutDuration(),
+		TTL:                   envCfg.TTL(defaults),
+		ProcessEnv:            envCfg.ProcessEnv(defaults, a.envVars),
+		RedactLogs:            defaults.LogRedactionEnabled(),
+		CommandWrapper:        defaults.CommandWrapper,
+		StopSignal:            session.StopSignal(defaults.StopSignal),
+	}, nil
+}
 
-	return cmd
+// newLogTap returns a func that echoes session log lines to out, or nil when
+// out is nil. Lines from the stdout and stderr readers are serialized.
+func newLogTap(out io.Writer) func(key session.SessionKey, line string) {
+	if out == nil {
+		return nil
+	}
+	var mu sync.Mutex
+	return func(key session.SessionKey, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(out, "[%s] %s\n", key, line)
+	}
+}
+
+// connectAllEnvs connects every env of serviceName, printing one row per
+// forward. A failing env is reported without aborting the rest.
+func (a *app) connectAllEnvs(out io.Writer, cfg *config.Config, serviceName string, o connectOverrides) error {
+	var svc *config.Service
+	for i := range cfg.Services {
+		if cfg.Services[i].Name == serviceName {
+			svc = &cfg.Services[i]
+			break
+		}
+	}
+	if svc == nil {
+		return fmt.Errorf("%s: service not found in config", serviceName)
+	}
+
+	envNames := make([]string, 0, len(svc.Envs))
+	for name := range svc.Envs {
+		envNames = append(envNames, name)
+	}
+	sort.Strings(envNames)
+
+	refs := make([]envRef, 0, len(envNames))
+	for _, envName := range envNames {
+		refs = append(refs, envRef{service: serviceName, env: envName})
+	}
+	return a.connectMany(out, cfg, refs, o)
+}
+
+// envRef names one configured service/env pair.
+type envRef struct {
+	service string
+	env     string
+}
+
+// connectMany connects each ref in order and prints a KEY/ENDPOINT/STATUS
+// table. Failures are collected and returned together once all refs ran.
+func (a *app) connectMany(out io.Writer, cfg *config.Config, refs []envRef, o connectOverrides) error {
+	defaults := cfg.EffectiveDefaults()
+	var errs []error
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tENDPOINT\tSTATUS")
+	for _, ref := range refs {
+		started, err := a.connectRef(defaults, cfg, ref, o)
+		if err != nil {
+			fmt.Fprintf(w, "%s\t-\tfailed: %v\n", session.NewSessionKey(ref.service, ref.env), err)
+			errs = append(errs, err)
+			continue
+		}
+		for _, s := range started {
+			fmt.Fprintf(w, "%s\t%s:%d\tconnected\n", s.Key, s.Bind, s.LocalPort)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d envs failed to connect: %w", len(errs), len(refs), errors.Join(errs...))
+	}
+	return nil
+}
+
+func (a *app) connectRef(defaults config.Defaults, cfg *config.Config, ref envRef, o connectOverrides) ([]session.SessionSnapshot, error) {
+	envCfg, err := findEnvConfig(cfg, ref.service, ref.env)
+	if err != nil {
+		return nil, err
+	}
+	return a.connectEnv(defaults, ref.service, ref.env, envCfg, o)
+}
+
+// sessionListEntry is one session of ls --json.
+type sessionListEntry struct {
+	Key              string     `json:"key"`
+	Service          string     `json:"service"`
+	Env              string     `json:"env"`
+	Bind             string     `json:"bind"`
+	LocalPort        int        `json:"local_port"`
+	State            string     `json:"state"`
+	PID              int        `json:"pid"`
+	StartTime        time.Time  `json:"start_time"`
+	Reconnects       int        `json:"reconnects"`
+	LastReconnect    *time.Time `json:"last_reconnect,omitempty"`
+	LastError        string     `json:"last_error,omitempty"`
+	LastHealthyAt    *time.Time `json:"last_healthy_at,omitempty"`
+	StoppedAt        *time.Time `json:"stopped_at,omitempty"`
+	StartupLatencyMS int64      `json:"startup_latency_ms,omitempty"`
+	// Reachable is set by ls --probe for sessions with a local endpoint.
+	Reachable *bool `json:"reachable,omitempty"`
+}
+
+func newSessionListEntry(summary session.SessionSummary) sessionListEntry {
+	entry := sessionListEntry{
+		Key:              string(summary.Key),
+		Service:          summary.Service,
+		Env:              summary.Env,
+		Bind:             summary.Bind,
+		LocalPort:        summary.LocalPort,
+		State:            string(summary.State),
+		PID:              summary.PID,
+		StartTime:        summary.StartTime,
+		Reconnects:       summary.Reconnects,
+		LastError:        summary.LastError,
+		StartupLatencyMS: summary.StartupLatency.Milliseconds(),
+	}
+	if !summary.LastReconnect.IsZero() {
+		entry.LastReconnect = &summary.LastReconnect
+	}
+	if !summary.LastHealthyAt.IsZero() {
+		entry.LastHealthyAt = &summary.LastHealthyAt
+	}
+	if !summary.StoppedAt.IsZero() {
+		entry.StoppedAt = &summary.StoppedAt
+	}
+	return entry
+}
+
+// lsProbeTimeout bounds the endpoint dial of ls --probe per session.
+const lsProbeTimeout = 300 * time.Millisecond
+
+var probeEndpointFn = session.WaitForPort
+
+// probeEndpoints dials the local endpoint of every summary concurrently. The
+// result is nil for sessions without one, such as stopped sessions.
+func probeEndpoints(summaries []session.SessionSummary) []*bool {
+	results := make([]*bool, len(summaries))
+	var wg sync.WaitGroup
+	for i, summary := range summaries {
+		if summary.LocalPort == 0 || summary.State == session.SessionStateStopped {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reachable := probeEndpointFn(summary.Bind, summary.LocalPort, lsProbeTimeout) == nil
+			results[i] = &reachable
+		}()
+	}
+	wg.Wait()
+	return results
 }
 
 func (a *app) newLsCmd() *cobra.Command {
-	return &cobra.Command{
+	var all bool
+	var asJSON bool
+	var probe bool
+
+	cmd := &cobra.Command{
 		Use:   "ls",
 		Short: "List running sessions",
 		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			summaries := a.manager.List()
+			if all {
+				summaries = append(summaries, a.manager.RecentlyStopped()...)
+			}
+			var reachable []*bool
+			if probe {
+				reachable = probeEndpoints(summaries)
+			}
+			if asJSON {
+				entries := make([]sessionListEntry, 0, len(summaries))
+				for i, summary := range summaries {
+					entry := newSessionListEntry(summary)
+					if probe {
+						entry.Reachable = reachable[i]
+					}
+					entries = append(entries, entry)
+				}
+				return writeJSON(cmd.OutOrStdout(), entries)
+			}
 			if len(summaries) == 0 {
 				fmt.Fprintln(cmd.OutOrStdout(), "no sessions")
 				return nil
 			}
 
 			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
-			fmt.Fprintln(w, "KEY\tENDPOINT\tSTATE\tUPTIME\tPID\tERROR")
-			for _, summary := range summaries {
+			header := "KEY\tENDPOINT\tSTATE\tUPTIME\tRESTARTS\tPID\tHEALTHY\t"
+			if probe {
+				header += "REACHABLE\t"
+			}
+			fmt.Fprintln(w, header+"ERROR")
+			now := time.Now()
+			for i, summary := range summaries {
+				healthy := "-"
+				if !summary.LastHealthyAt.IsZero() {
+					healthy = formatUptime(now.Sub(summary.LastHealthyAt)) + " ago"
+				}
 				fmt.Fprintf(
 					w,
-					"%s\t%s:%d\t%s\t%s\t%d\t%s\n",
+					"%s\t%s:%d\t%s\t%s\t%d\t%d\t%s\t",
 					summary.Key,
 					summary.Bind,
 					summary.LocalPort,
 					summary.State,
-					formatUptime(summary.Uptime),
+					formatLsUptime(summary, now),
+					summary.Reconnects,
 					summary.PID,
-					summary.LastError,
+					healthy,
 				)
+				if probe {
+					fmt.Fprintf(w, "%s\t", formatReachable(reachable[i]))
+				}
+				fmt.Fprintf(w, "%s\n", summary.LastError)
 			}
 			return w.Flush()
 		},
 	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Also list sessions that ended in the last 10 minutes")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print sessions as JSON")
+	cmd.Flags().BoolVar(&probe, "probe", false, "Dial each session's local endpoint and show whether it is reachable")
+	return cmd
+}
+
+func formatReachable(reachable *bool) string {
+	switch {
+	case reachable == nil:
+		return "-"
+	case *reachable:
+		return "yes"
+	default:
+		return "no"
+	}
+}
+
+// followLogs prints the last backlog lines of the session and then every new
+// line as it arrives, until the session ends or the user interrupts.
+//
+// A slow terminal or pipe must not hold up the session's log piping, so the
+// oldest unread lines are dropped when the buffer is full; errOut gets a note
+// with the count.
+func (a *app) followLogs(out, errOut io.Writer, key session.SessionKey, backlog int, format logFormat) error {
+	id, lines, err := a.manager.SubscribeLogsWithReplay(key, backlog, logStreamBuffer, session.DropOldest)
+	if err != nil {
+		return err
+	}
+	defer a.manager.UnsubscribeLogs(key, id)
+
+	var reported uint64
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case entry, ok := <-lines:
+			if !ok {
+				return nil
+			}
+			if stats, err := a.manager.SubscriberStats(key, id); err == nil && stats.Dropped > reported {
+				fmt.Fprintf(errOut, "%s: dropped %d log lines the output could not keep up with\n", key, stats.Dropped-reported)
+				reported = stats.Dropped
+			}
+			if err := format.write(out, entry); err != nil {
+				return err
+			}
+		case <-sigCh:
+			return nil
+		}
+	}
+}
+
+// newPortCmd prints only the local port of a running session, for use in
+// shell substitutions like `psql -p $(dbx port svc/dev)`.
+func (a *app) newPortCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "port <service>/<env> | <service> <env>",
+		Short: "Print the local port of a running session",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			serviceName, envName, err := parseSessionArgs(args, "dbx port <service>/<env> | <service> <env>")
+			if err != nil {
+				return err
+			}
+			key := session.NewSessionKey(serviceName, envName)
+
+			s, ok := a.manager.Get(key)
+			if !ok {
+				return a.sessionNotFound(key)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), s.LocalPort)
+			return nil
+		},
+	}
+}
+
+type sessionStatus struct {
+	Key              string    `json:"key"`
+	Service          string    `json:"service"`
+	Env              string    `json:"env"`
+	Bind             string    `json:"bind"`
+	LocalPort        int       `json:"local_port"`
+	RemoteHost       string    `json:"remote_host"`
+	RemotePort       int       `json:"remote_port"`
+	TargetInstanceID string    `json:"target_instance_id"`
+	Region           string    `json:"region,omitempty"`
+	Profile          string    `json:"profile,omitempty"`
+	PID              int       `json:"pid"`
+	State            string    `json:"state"`
+	StartTime        time.Time `json:"start_time"`
+	LastError        string    `json:"last_error,omitempty"`
+	Args             []string  `json:"args"`
+	// StartupLatencyMS is how long the session took to become ready.
+	StartupLatencyMS int64 `json:"startup_latency_ms,omitempty"`
+}
+
+// newStatusCmd prints the details of one session, including the exact aws
+// argv it was started with.
+func (a *app) newStatusCmd() *cobra.Command {
+	var jsonOut bool
+
+	cmd := &cobra.Command{
+		Use:   "status <service>/<env> | <service> <env>",
+		Short: "Show the details of a running session",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			serviceName, envName, err := parseSessionArgs(args, "dbx status <service>/<env> | <service> <env>")
+			if err != nil {
+				return err
+			}
+			key := session.NewSessionKey(serviceName, envName)
+
+			s, ok := a.manager.Get(key)
+			if !ok {
+				return a.sessionNotFound(key)
+			}
+
+			status := sessionStatus{
+				Key:              string(s.Key),
+				Service:          s.Service,
+				Env:              s.Env,
+				Bind:             s.Bind,
+				LocalPort:        s.LocalPort,
+				RemoteHost:       s.RemoteHost,
+				RemotePort:       s.RemotePort,
+				TargetInstanceID: s.TargetInstanceID,
+				Region:           s.Region,
+				Profile:          s.Profile,
+				PID:              s.PID,
+				State:            string(s.State),
+				StartTime:        s.StartTime,
+				LastError:        s.LastError,
+				Args:             s.StartedArgs,
+				StartupLatencyMS: s.StartupLatency.Milliseconds(),
+			}
+			out := cmd.OutOrStdout()
+			if jsonOut {
+				return writeJSON(out, status)
+			}
+			fmt.Fprintf(out, "key=%s\n", status.Key)
+			fmt.Fprintf(out, "state=%s\n", status.State)
+			fmt.Fprintf(out, "endpoint=%s:%d\n", status.Bind, status.LocalPort)
+			fmt.Fprintf(out, "remote=%s:%d\n", status.RemoteHost, status.RemotePort)
+			fmt.Fprintf(out, "target=%s\n", status.TargetInstanceID)
+			fmt.Fprintf(out, "pid=%d\n", status.PID)
+			if s.StartupLatency > 0 {
+				fmt.Fprintf(out, "startup=%s\n", s.StartupLatency.Round(time.Millisecond))
+			}
+			if status.LastError != "" {
+				fmt.Fprintf(out, "error=%s\n", status.LastError)
+			}
+			fmt.Fprintf(out, "args=%s\n", strings.Join(status.Args, " "))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Print the session as JSON")
+	return cmd
+}
+
+// formatLsUptime is the UPTIME cell of ls, with the TTL left when one is set,
+// or how long ago the session ended for ls --all.
+func formatLsUptime(summary session.SessionSummary, now time.Time) string {
+	if !summary.StoppedAt.IsZero() {
+		return fmt.Sprintf("ended %s ago", formatUptime(now.Sub(summary.StoppedAt)))
+	}
+	if summary.ExpiresAt.IsZero() {
+		return formatUptime(summary.Uptime)
+	}
+	return fmt.Sprintf("%s (ttl %s)", formatUptime(summary.Uptime), formatUptime(summary.TTLRemaining))
+}
+
+// logFormat is how dbx logs prints entries: plain lines, lines tagged [out]
+// or [err] (showSource), or one JSON object per line.
+type logFormat struct {
+	showSource bool
+	json       bool
+}
+
+type logJSONLine struct {
+	TS     time.Time `json:"ts"`
+	Source string    `json:"source"`
+	Line   string    `json:"line"`
+}
+
+func (f logFormat) write(out io.Writer, entry session.LogEntry) error {
+	switch {
+	case f.json:
+		source := "dbx"
+		switch entry.Source {
+		case session.LogSourceStdout:
+			source = "stdout"
+		case session.LogSourceStderr:
+			source = "stderr"
+		}
+		return json.NewEncoder(out).Encode(logJSONLine{TS: entry.Time, Source: source, Line: entry.Line})
+	case f.showSource:
+		_, err := fmt.Fprintln(out, entry.String())
+		return err
+	default:
+		_, err := fmt.Fprintln(out, entry.Line)
+		return err
+	}
 }
 
 func (a *app) newLogsCmd() *cobra.Command {
 	var follow bool
+	var all bool
+	var format logFormat
 	var lines int
 
 	cmd := &cobra.Command{
-		Use:   "logs <service>/<env>",
+		Use:   "logs <service>/<env> | <service> <env>",
 		Short: "Show session logs",
-		Args:  cobra.ExactArgs(1),
+		Args:  cobra.RangeArgs(1, 2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if lines < 0 {
-				return fmt.Errorf("lines must be >= 0")
+			if all && cmd.Flags().Changed("lines") {
+				return fmt.Errorf("--lines cannot be used with --all")
+			}
+			if lines < allLogLines {
+				return fmt.Errorf("lines must be >= 0, or -1 for the whole buffer")
+			}
+			if all || lines == allLogLines {
+				lines = session.DefaultRingBufferLines
 			}
 
-			serviceName, envName, err := parseServiceEnvPair(args[0])
+			serviceName, envName, err := parseSessionArgs(args, "dbx logs <service>/<env> | <service> <env>")
 			if err != nil {
 				return err
 			}
 			key := session.NewSessionKey(serviceName, envName)
 
 			s, ok := a.manager.Get(key)
-			if !ok || s == nil {
-				return fmt.Errorf("%s: session not found", key)
+			if !ok {
+				return a.sessionNotFound(key)
 			}
 
-			for _, line := range s.LastLogs(lines) {
-				fmt.Fprintln(cmd.OutOrStdout(), line)
-			}
 			if !follow {
-				return nil
-			}
-
-			sigCh := make(chan os.Signal, 1)
-			signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
-			defer signal.Stop(sigCh)
-
-			lastPrinted := len(s.LastLogs(session.DefaultRingBufferLines))
-			ticker := time.NewTicker(500 * time.Millisecond)
-			defer ticker.Stop()
-
-			for {
-				select {
-				case <-ticker.C:
-					current, ok := a.manager.Get(key)
-					if !ok || current == nil {
-						return nil
-					}
-					all := current.LastLogs(session.DefaultRingBufferLines)
-					if lastPrinted > len(all) {
-						lastPrinted = len(all)
-					}
-					for _, line := range all[lastPrinted:] {
-						fmt.Fprintln(cmd.OutOrStdout(), line)
+				for _, entry := range s.LastLogEntries(lines) {
+					if err := format.write(cmd.OutOrStdout(), entry); err != nil {
+						return err
 					}
-					lastPrinted = len(all)
-				case <-sigCh:
-					return nil
 				}
+				return nil
 			}
+			return a.followLogs(cmd.OutOrStdout(), cmd.ErrOrStderr(), key, lines, format)
 		},
 	}
 
 	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Follow log output")
-	cmd.Flags().IntVar(&lines, "lines", defaultLogLines, "Number of lines to show from the end")
+	cmd.Flags().BoolVar(&format.showSource, "show-source", false, "Prefix aws output with [out] or [err]")
+	cmd.Flags().BoolVar(&format.json, "json", false, `Print one JSON object per line: {"ts", "source", "line"}`)
+	cmd.Flags().IntVar(&lines, "lines", defaultLogLines, "Number of lines to show from the end (-1 for the whole buffer)")
+	cmd.Flags().BoolVar(&all, "all", false, "Show the whole log buffer")
 
 	return cmd
 }
@@ -379,17 +1342,12 @@ func (a *app) newStopCmd() *cobra.Command {
 				return nil
 			}
 
-			serviceName, envName, err := parseStopArgs(args)
+			serviceName, envName, err := parseSessionArgs(args, "dbx stop <service>/<env> | <service> <env> | --all")
 			if err != nil {
 				return err
 			}
 
-			key := session.NewSessionKey(serviceName, envName)
-			if err := a.manager.Stop(key); err != nil {
-				return err
-			}
-			fmt.Fprintf(cmd.OutOrStdout(), "stopped %s\n", key)
-			return nil
+			return a.stopGroup(cmd.OutOrStdout(), session.NewSessionKey(serviceName, envName), a.manager.Stop, "stopped")
 		},
 	}
 
@@ -398,6 +1356,51 @@ func (a *app) newStopCmd() *cobra.Command {
 	return cmd
 }
 
+func (a *app) newKillCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "kill <service>/<env> | <service> <env>",
+		Short: "Stop a session immediately with SIGKILL, skipping the grace period",
+		Long: "Kill sends SIGKILL to a wedged session instead of interrupting it and waiting,\n" +
+			"then waits for its local port to be released. The remote SSM session may\n" +
+			"linger briefly until AWS notices the client is gone.",
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			serviceName, envName, err := parseSessionArgs(args, "dbx kill <service>/<env> | <service> <env>")
+			if err != nil {
+				return err
+			}
+			return a.stopGroup(cmd.OutOrStdout(), session.NewSessionKey(serviceName, envName), a.manager.Kill, "killed")
+		},
+	}
+}
+
+// stopGroup runs stop for key, or for each of its forwards when key names a
+// multi-port env, printing "<verb> <key>" for each one that succeeded.
+func (a *app) stopGroup(out io.Writer, key session.SessionKey, stop func(session.SessionKey) error, verb string) error {
+	group := forwardGroupKeys(a.manager.List(), key)
+	if len(group) == 0 {
+		group = []session.SessionKey{key}
+	}
+	var errs []error
+	for _, k := range group {
+		if err := stop(k); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Fprintf(out, "%s %s\n", verb, k)
+	}
+	return errors.Join(errs...)
+}
+
+// noServicesError names the loaded config files so an empty config is not
+// mistaken for a typo in the service name.
+func (a *app) noServicesError() error {
+	if len(a.configPaths) == 0 {
+		return config.ErrNoServices
+	}
+	return fmt.Errorf("%w in %s", config.ErrNoServices, strings.Join(a.configPaths, ", "))
+}
+
 func findEnvConfig(cfg *config.Config, serviceName, envName string) (config.EnvConfig, error) {
 	for _, svc := range cfg.Services {
 		if svc.Name != serviceName {
@@ -413,7 +1416,36 @@ func findEnvConfig(cfg *config.Config, serviceName, envName string) (config.EnvC
 	return config.EnvConfig{}, fmt.Errorf("%s/%s: service not found in config", serviceName, envName)
 }
 
-func parseStopArgs(args []string) (string, string, error) {
+// sessionNotFound reports a missing session. When key names a multi-port env,
+// the error lists its forwards so the caller can pick one by name.
+func (a *app) sessionNotFound(key session.SessionKey) error {
+	group := forwardGroupKeys(a.manager.List(), key)
+	if len(group) == 0 {
+		return fmt.Errorf("%s: session not found", key)
+	}
+	names := make([]string, 0, len(group))
+	for _, k := range group {
+		names = append(names, strings.TrimPrefix(string(k), string(key)+":"))
+	}
+	return fmt.Errorf("%s has %d forwards (%s); pick one, e.g. %s", key, len(group), strings.Join(names, ", "), group[0])
+}
+
+// forwardGroupKeys returns the keys of the named forwards ("service/env:name")
+// started for a multi-port env key.
+func forwardGroupKeys(summaries []session.SessionSummary, key session.SessionKey) []session.SessionKey {
+	var keys []session.SessionKey
+	prefix := string(key) + ":"
+	for _, summary := range summaries {
+		if strings.HasPrefix(string(summary.Key), prefix) {
+			keys = append(keys, summary.Key)
+		}
+	}
+	return keys
+}
+
+// parseSessionArgs accepts either "<service>/<env>" or "<service> <env>". The
+// two-arg form works for service names that contain slashes.
+func parseSessionArgs(args []string, usage string) (string, string, error) {
 	switch len(args) {
 	case 1:
 		return parseServiceEnvPair(args[0])
@@ -425,7 +1457,7 @@ func parseStopArgs(args []string) (string, string, error) {
 		}
 		return serviceName, envName, nil
 	default:
-		return "", "", fmt.Errorf("usage: dbx stop <service>/<env> | <service> <env> | --all")
+		return "", "", fmt.Errorf("usage: %s", usage)
 	}
 }
 
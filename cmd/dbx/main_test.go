@@ -2,33 +2,79 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/fredyranthun/db/internal/config"
+	"github.com/fredyranthun/db/internal/history"
 	"github.com/fredyranthun/db/internal/session"
+	"github.com/fredyranthun/db/internal/ui"
+	"github.com/fredyranthun/db/sessiontest"
 )
 
 type fakeAppManager struct {
 	stopAllCalls int
+	closeCalls   int
 	startCalls   []session.StartOptions
+	startErrs    map[string]error
+	// reused marks the envs whose Start returns a running session.
+	reused    map[string]bool
+	stopCalls []session.SessionKey
+	stopErrs  map[session.SessionKey]error
+	killCalls []session.SessionKey
+	// stopAllTimeouts records the deadline of each StopAllWithTimeout call.
+	stopAllTimeouts []time.Duration
+	orphans         []session.PortOwner
+	listSessions    []session.SessionSummary
+	recentlyStopped []session.SessionSummary
+	// sessions are returned by Get as they are, ahead of listSessions.
+	sessions []*session.Session
+	// bufferedLogs are already in each session's log; streamedLogs arrive
+	// through SubscribeLogs.
+	bufferedLogs []string
+	streamedLogs []string
+	subscribed   int
+	// followPolicy is the drop policy of the last log subscription;
+	// dropped is what SubscriberStats reports for it.
+	followPolicy session.DropPolicy
+	dropped      uint64
 }
 
-func (f *fakeAppManager) Start(opts session.StartOptions) (*session.Session, error) {
+func (f *fakeAppManager) Start(opts session.StartOptions) (session.SessionSnapshot, error) {
 	f.startCalls = append(f.startCalls, opts)
+	if err := f.startErrs[opts.Env]; err != nil {
+		return session.SessionSnapshot{}, err
+	}
 	s := session.NewSession(opts.Service, opts.Env)
 	s.Bind = opts.Bind
+	s.RemoteHost, s.RemotePort = opts.RemoteHost, opts.RemotePort
 	if opts.LocalPort == 0 {
 		s.LocalPort = 5500
 	} else {
 		s.LocalPort = opts.LocalPort
 	}
-	return s, nil
+	snap := s.Snapshot()
+	snap.Reused = f.reused[opts.Env]
+	return snap, nil
 }
 
 func (f *fakeAppManager) Stop(key session.SessionKey) error {
+	f.stopCalls = append(f.stopCalls, key)
+	return f.stopErrs[key]
+}
+
+func (f *fakeAppManager) Kill(key session.SessionKey) error {
+	f.killCalls = append(f.killCalls, key)
 	return nil
 }
 
@@ -37,32 +83,110 @@ func (f *fakeAppManager) StopAll() error {
 	return nil
 }
 
-func (f *fakeAppManager) List() []session.SessionSummary {
+func (f *fakeAppManager) StopAllWithTimeout(d time.Duration) error {
+	f.stopAllTimeouts = append(f.stopAllTimeouts, d)
+	return nil
+}
+
+func (f *fakeAppManager) Orphans(min, max int) ([]session.PortOwner, error) {
+	return f.orphans, nil
+}
+
+func (f *fakeAppManager) Close() error {
+	f.closeCalls++
 	return nil
 }
 
-func (f *fakeAppManager) Get(key session.SessionKey) (*session.Session, bool) {
-	return nil, false
+func (f *fakeAppManager) List() []session.SessionSummary {
+	return f.listSessions
+}
+
+func (f *fakeAppManager) RecentlyStopped() []session.SessionSummary {
+	return f.recentlyStopped
+}
+
+func (f *fakeAppManager) Summary(key session.SessionKey) (session.SessionSummary, bool) {
+	for _, summary := range f.listSessions {
+		if summary.Key == key {
+			return summary, true
+		}
+	}
+	return session.SessionSummary{}, false
+}
+
+func (f *fakeAppManager) Get(key session.SessionKey) (session.SessionSnapshot, bool) {
+	for _, s := range f.sessions {
+		if s.Key == key {
+			return s.Snapshot(), true
+		}
+	}
+	for _, summary := range f.listSessions {
+		if summary.Key == key {
+			s := session.NewSession(summary.Service, summary.Env)
+			s.Bind = summary.Bind
+			s.LocalPort = summary.LocalPort
+			for _, line := range f.bufferedLogs {
+				s.AppendLog(line)
+			}
+			return s.Snapshot(), true
+		}
+	}
+	return session.SessionSnapshot{}, false
 }
 
-func (f *fakeAppManager) LastLogs(key session.SessionKey, n int) ([]string, error) {
+func (f *fakeAppManager) LastLogs(key session.SessionKey, n int) ([]session.LogEntry, error) {
 	return nil, nil
 }
 
-func (f *fakeAppManager) SubscribeLogs(key session.SessionKey, buffer int) (uint64, <-chan string, error) {
-	ch := make(chan string)
+func (f *fakeAppManager) SubscribeLogsWithReplay(key session.SessionKey, n, buffer int, policy session.DropPolicy) (uint64, <-chan session.LogEntry, error) {
+	f.subscribed++
+	f.followPolicy = policy
+	replay := f.bufferedLogs
+	if n < len(replay) {
+		replay = replay[len(replay)-n:]
+	}
+	ch := make(chan session.LogEntry, len(replay)+len(f.streamedLogs))
+	for _, line := range append(append([]string(nil), replay...), f.streamedLogs...) {
+		ch <- session.LogEntry{Time: time.Now(), Source: session.LogSourceStdout, Line: line}
+	}
 	close(ch)
 	return 1, ch, nil
 }
 
 func (f *fakeAppManager) UnsubscribeLogs(key session.SessionKey, id uint64) {}
 
+func (f *fakeAppManager) SubscriberStats(key session.SessionKey, id uint64) (session.SubscriberStats, error) {
+	return session.SubscriberStats{Dropped: f.dropped}, nil
+}
+
 type fakeTeaRunner struct{}
 
 func (f fakeTeaRunner) Run() (tea.Model, error) {
 	return nil, nil
 }
 
+// sendingTeaRunner records the messages sent to it and calls run while it
+// runs.
+type sendingTeaRunner struct {
+	run  func()
+	sent *[]tea.Msg
+}
+
+func (f sendingTeaRunner) Run() (tea.Model, error) {
+	f.run()
+	return nil, nil
+}
+
+func (f sendingTeaRunner) Send(msg tea.Msg) {
+	*f.sent = append(*f.sent, msg)
+}
+
+type failingTeaRunner struct{}
+
+func (f failingTeaRunner) Run() (tea.Model, error) {
+	return nil, errors.New("read /dev/stdin: input/output error")
+}
+
 func writeTestConfig(t *testing.T) string {
 	t.Helper()
 	dir := t.TempDir()
@@ -129,8 +253,55 @@ func TestUICmdQuitTriggersCleanupByDefault(t *testing.T) {
 		t.Fatalf("ui command failed: %v", err)
 	}
 
-	if manager.stopAllCalls != 1 {
-		t.Fatalf("expected StopAll to be called once, got %d", manager.stopAllCalls)
+	if manager.closeCalls != 1 {
+		t.Fatalf("expected Close to be called once, got %d", manager.closeCalls)
+	}
+}
+
+func TestUICmdErrorStillTriggersCleanup(t *testing.T) {
+	manager := &fakeAppManager{}
+	a := &app{manager: manager, configPath: writeTestConfig(t)}
+
+	prevRunner := newTeaRunner
+	newTeaRunner = func(model tea.Model) teaRunner {
+		return failingTeaRunner{}
+	}
+	defer func() { newTeaRunner = prevRunner }()
+
+	cmd := a.newUICmd()
+	if err := cmd.RunE(cmd, nil); err == nil || !strings.Contains(err.Error(), "input/output error") {
+		t.Fatalf("expected the UI error, got %v", err)
+	}
+	if manager.closeCalls != 1 {
+		t.Fatalf("expected Close after a failed UI, got %d calls", manager.closeCalls)
+	}
+}
+
+func TestWarnGoesToTheRunningUIInsteadOfStderr(t *testing.T) {
+	a := &app{manager: &fakeAppManager{}, configPath: writeTestConfig(t)}
+	var errOut bytes.Buffer
+	var sent []tea.Msg
+
+	prevRunner := newTeaRunner
+	newTeaRunner = func(model tea.Model) teaRunner {
+		return sendingTeaRunner{run: func() { a.warn(&errOut, "webhook failed") }, sent: &sent}
+	}
+	defer func() { newTeaRunner = prevRunner }()
+
+	cmd := a.newUICmd()
+	if err := cmd.RunE(cmd, nil); err != nil {
+		t.Fatalf("ui command failed: %v", err)
+	}
+	if errOut.Len() != 0 {
+		t.Fatalf("expected nothing on stderr while the UI runs, got %q", errOut.String())
+	}
+	if len(sent) != 1 || sent[0] != (ui.WarningMsg{Text: "webhook failed"}) {
+		t.Fatalf("expected the warning to be sent to the UI, got %v", sent)
+	}
+
+	a.warn(&errOut, "webhook failed")
+	if errOut.String() != "dbx: webhook failed\n" {
+		t.Fatalf("expected the warning on stderr once the UI exited, got %q", errOut.String())
 	}
 }
 
@@ -149,8 +320,8 @@ func TestUICmdQuitSkipsCleanupWhenNoCleanupEnabled(t *testing.T) {
 		t.Fatalf("ui command failed: %v", err)
 	}
 
-	if manager.stopAllCalls != 0 {
-		t.Fatalf("expected StopAll to be skipped, got %d calls", manager.stopAllCalls)
+	if manager.closeCalls != 0 {
+		t.Fatalf("expected Close to be skipped, got %d calls", manager.closeCalls)
 	}
 }
 
@@ -208,6 +379,138 @@ func TestConnectUsesEnvLocalPortWhenNoFlag(t *testing.T) {
 	}
 }
 
+func TestConnectOutputDependsOnTTY(t *testing.T) {
+	prev := outputIsTTY
+	t.Cleanup(func() { outputIsTTY = prev })
+
+	for _, tty := range []bool{false, true} {
+		outputIsTTY = func(io.Writer) bool { return tty }
+		var out bytes.Buffer
+		root := newRootCmd(&app{manager: &fakeAppManager{}})
+		root.SetOut(&out)
+		root.SetErr(io.Discard)
+		root.SetArgs([]string{"--config", writeTestConfig(t), "connect", "service1", "dev"})
+		if err := root.Execute(); err != nil {
+			t.Fatalf("connect command failed: %v", err)
+		}
+
+		want := "service=service1 env=dev\nremote=db.internal:5432\nENDPOINT=127.0.0.1:55432\n"
+		if tty {
+			want = "Connected service1/dev\n  endpoint  127.0.0.1:55432 -> db.internal:5432\n"
+		}
+		if out.String() != want {
+			t.Fatalf("tty=%v: expected %q, got %q", tty, want, out.String())
+		}
+	}
+}
+
+func TestConnectTargetOverrides(t *testing.T) {
+	manager := &fakeAppManager{}
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", writeTestConfig(t), "connect", "service1", "dev", "--target-instance", "i-0aaaabbbbccccdddd", "--remote-host", "replica.internal", "--remote-port", "5433"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("connect command failed: %v", err)
+	}
+	if len(manager.startCalls) != 1 {
+		t.Fatalf("expected one start call, got %d", len(manager.startCalls))
+	}
+	if opts := manager.startCalls[0]; opts.TargetInstanceID != "i-0aaaabbbbccccdddd" || opts.RemoteHost != "replica.internal" || opts.RemotePort != 5433 {
+		t.Fatalf("expected the target overrides, got %s %s:%d", opts.TargetInstanceID, opts.RemoteHost, opts.RemotePort)
+	}
+
+	for _, args := range [][]string{
+		{"--remote-port", "0"},
+		{"--remote-port", "70000"},
+		{"--remote-host", " "},
+		{"--target-instance", ""},
+	} {
+		manager := &fakeAppManager{}
+		root := newRootCmd(&app{manager: manager})
+		root.SetOut(io.Discard)
+		root.SetErr(io.Discard)
+		root.SetArgs(append([]string{"--config", writeTestConfig(t), "connect", "service1", "dev"}, args...))
+		if err := root.Execute(); err == nil {
+			t.Fatalf("expected %v to be rejected", args)
+		}
+		if len(manager.startCalls) != 0 {
+			t.Fatalf("expected no start for %v, got %d", args, len(manager.startCalls))
+		}
+	}
+}
+
+func TestConnectTimeoutOverridesStartupTimeout(t *testing.T) {
+	manager := &fakeAppManager{}
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", writeTestConfig(t), "connect", "service1", "dev", "--timeout", "2m"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("connect command failed: %v", err)
+	}
+	if opts := manager.startCalls[0]; opts.StartupTimeout != 2*time.Minute || opts.SkipReadiness {
+		t.Fatalf("expected a 2m readiness wait, got timeout=%s skip=%v", opts.StartupTimeout, opts.SkipReadiness)
+	}
+
+	for _, value := range []string{"0s", "-5s"} {
+		manager := &fakeAppManager{}
+		root := newRootCmd(&app{manager: manager})
+		root.SetOut(io.Discard)
+		root.SetErr(io.Discard)
+		root.SetArgs([]string{"--config", writeTestConfig(t), "connect", "service1", "dev", "--timeout", value})
+		if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "--timeout must be positive") {
+			t.Fatalf("expected --timeout %s to be rejected, got %v", value, err)
+		}
+		if len(manager.startCalls) != 0 {
+			t.Fatalf("expected no start for --timeout %s", value)
+		}
+	}
+}
+
+func TestConnectRefreshBypassesTargetCache(t *testing.T) {
+	manager := &fakeAppManager{}
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", writeTestConfig(t), "connect", "service1", "dev", "--refresh"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("connect command failed: %v", err)
+	}
+	if opts := manager.startCalls[0]; !opts.RefreshTarget || opts.TargetCacheTTL != time.Minute {
+		t.Fatalf("expected a refresh with the default 1m cache TTL, got refresh=%v ttl=%s", opts.RefreshTarget, opts.TargetCacheTTL)
+	}
+}
+
+func TestConnectEnvFilePassesVarsAndProfile(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "ci.env")
+	content := "# CI credentials\nexport AWS_ACCESS_KEY_ID=AKIAEXAMPLE\nAWS_SECRET_ACCESS_KEY=\"secret\"\nAWS_REGION=us-east-1\n"
+	if err := os.WriteFile(envFile, []byte(content), 0o600); err != nil {
+		t.Fatalf("write env file: %v", err)
+	}
+
+	manager := &fakeAppManager{}
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", writeTestConfig(t), "connect", "service1", "dev", "--env-file", envFile})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+
+	opts := manager.startCalls[0]
+	want := map[string]string{"AWS_ACCESS_KEY_ID": "AKIAEXAMPLE", "AWS_SECRET_ACCESS_KEY": "secret", "AWS_REGION": "us-east-1"}
+	if !maps.Equal(opts.ProcessEnv, want) {
+		t.Fatalf("expected %v in the aws environment, got %v", want, opts.ProcessEnv)
+	}
+	if opts.Profile != "" || opts.Region != "us-east-1" {
+		t.Fatalf("expected static credentials to drop the config profile and set the region, got profile %q region %q", opts.Profile, opts.Region)
+	}
+	if _, ok := os.LookupEnv("AWS_ACCESS_KEY_ID"); ok {
+		t.Fatal("expected dbx's own environment untouched")
+	}
+}
+
 func TestConnectPortFlagOverridesEnvLocalPort(t *testing.T) {
 	manager := &fakeAppManager{}
 	a := &app{manager: manager}
@@ -249,3 +552,1305 @@ func TestConnectLeavesLocalPortUnsetWhenConfigAndFlagAreAbsent(t *testing.T) {
 		t.Fatalf("expected local port unset (0), got %d", got)
 	}
 }
+
+func TestConnectZeroStartupTimeoutSkipsReadiness(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := `defaults:
+  startup_timeout_seconds: 0
+services:
+  - name: service1
+    envs:
+      dev:
+        target_instance_id: "i-0123456789abcdef0"
+        remote_host: "db.internal"
+        remote_port: 5432
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	manager := &fakeAppManager{}
+	a := &app{manager: manager}
+	root := newRootCmd(a)
+
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetErr(&out)
+	root.SetArgs([]string{"--config", path, "connect", "service1", "dev"})
+
+	if err := root.Execute(); err != nil {
+		t.Fatalf("connect command failed: %v", err)
+	}
+	if len(manager.startCalls) != 1 {
+		t.Fatalf("expected one start call, got %d", len(manager.startCalls))
+	}
+	if !manager.startCalls[0].SkipReadiness {
+		t.Fatal("expected explicit zero startup timeout to skip readiness")
+	}
+}
+
+func TestCompletionInstallPrintsScript(t *testing.T) {
+	root := newRootCmd(&app{manager: &fakeAppManager{}})
+
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetErr(&out)
+	root.SetArgs([]string{"completion", "install", "--shell", "bash", "--print"})
+
+	if err := root.Execute(); err != nil {
+		t.Fatalf("completion install failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "bash completion") {
+		t.Fatalf("expected bash completion script on stdout, got %q", out.String())
+	}
+}
+
+func TestCompletionInstallWritesScript(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("SHELL", "/usr/bin/fish")
+
+	root := newRootCmd(&app{manager: &fakeAppManager{}})
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetErr(&out)
+	root.SetArgs([]string{"completion", "install"})
+
+	if err := root.Execute(); err != nil {
+		t.Fatalf("completion install failed: %v", err)
+	}
+
+	path := filepath.Join(home, ".config", "fish", "completions", "dbx.fish")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected completion script at %s: %v", path, err)
+	}
+	if !strings.Contains(string(data), "complete") {
+		t.Fatalf("unexpected fish completion content: %q", string(data))
+	}
+	if !strings.Contains(out.String(), path) {
+		t.Fatalf("expected output to mention %s, got %q", path, out.String())
+	}
+}
+
+func TestConnectMultiPortEnvStartsOneSessionPerPort(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := `services:
+  - name: service1
+    envs:
+      dev:
+        target_instance_id: "i-0123456789abcdef0"
+        remote_host: "db.internal"
+        ports:
+          - name: db
+            remote_port: 5432
+            local_port: 55432
+          - name: metrics
+            remote_port: 9187
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	manager := &fakeAppManager{}
+	root := newRootCmd(&app{manager: manager})
+
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetErr(&out)
+	root.SetArgs([]string{"--config", path, "connect", "service1", "dev"})
+
+	if err := root.Execute(); err != nil {
+		t.Fatalf("connect command failed: %v", err)
+	}
+	if len(manager.startCalls) != 2 {
+		t.Fatalf("expected two start calls, got %d", len(manager.startCalls))
+	}
+	if got := manager.startCalls[0]; got.Env != "dev:db" || got.RemotePort != 5432 || got.LocalPort != 55432 {
+		t.Fatalf("unexpected first forward: %+v", got)
+	}
+	if got := manager.startCalls[1]; got.Env != "dev:metrics" || got.RemotePort != 9187 || got.LocalPort != 0 {
+		t.Fatalf("unexpected second forward: %+v", got)
+	}
+	for _, want := range []string{"ENDPOINT_DB=127.0.0.1:55432", "ENDPOINT_METRICS=127.0.0.1:5500", "ENDPOINT=127.0.0.1:55432"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected output to contain %q, got %q", want, out.String())
+		}
+	}
+}
+
+func TestConnectMultiPortRollbackSparesReusedSessions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := `services:
+  - name: service1
+    envs:
+      dev:
+        target_instance_id: "i-0123456789abcdef0"
+        remote_host: "db.internal"
+        ports:
+          - name: db
+            remote_port: 5432
+          - name: cache
+            remote_port: 6379
+          - name: metrics
+            remote_port: 9187
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	manager := &fakeAppManager{
+		reused:    map[string]bool{"dev:db": true},
+		startErrs: map[string]error{"dev:metrics": errors.New("no free port")},
+	}
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", path, "connect", "--reuse", "service1", "dev"})
+
+	if err := root.Execute(); err == nil {
+		t.Fatal("expected connect to fail")
+	}
+	if want := []session.SessionKey{"service1/dev:cache"}; !slices.Equal(manager.stopCalls, want) {
+		t.Fatalf("expected rollback to stop only %v, got %v", want, manager.stopCalls)
+	}
+}
+
+func TestConnectAllEnvsReportsFailuresWithoutAborting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := `services:
+  - name: service1
+    envs:
+      dev:
+        target_instance_id: "i-0123456789abcdef0"
+        remote_host: "dev.internal"
+        remote_port: 5432
+      prod:
+        target_instance_id: "i-0123456789abcdef0"
+        remote_host: "prod.internal"
+        remote_port: 5432
+      qa:
+        target_instance_id: "i-0123456789abcdef0"
+        remote_host: "qa.internal"
+        remote_port: 5432
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	manager := &fakeAppManager{startErrs: map[string]error{"prod": errors.New("service1/prod: no free port")}}
+	root := newRootCmd(&app{manager: manager})
+
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetErr(&out)
+	root.SetArgs([]string{"--config", path, "connect", "--all-envs", "service1"})
+
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 envs failed") {
+		t.Fatalf("expected aggregated failure, got %v", err)
+	}
+	if len(manager.startCalls) != 3 {
+		t.Fatalf("expected every env to be attempted, got %d start calls", len(manager.startCalls))
+	}
+	for i, want := range []string{"dev", "prod", "qa"} {
+		if got := manager.startCalls[i].Env; got != want {
+			t.Fatalf("expected start %d for %s, got %s", i, want, got)
+		}
+	}
+	for _, want := range []string{"service1/dev", "service1/prod", "failed: service1/prod: no free port", "service1/qa", "connected"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected output to contain %q, got %q", want, out.String())
+		}
+	}
+}
+
+func TestConnectAllEnvsRejectsEnvArgAndPort(t *testing.T) {
+	for _, args := range [][]string{
+		{"connect", "--all-envs", "service1", "dev"},
+		{"connect", "--all-envs", "--port", "5500", "service1"},
+	} {
+		root := newRootCmd(&app{manager: &fakeAppManager{}})
+		root.SetOut(io.Discard)
+		root.SetErr(io.Discard)
+		root.SetArgs(append([]string{"--config", writeTestConfig(t)}, args...))
+		if err := root.Execute(); err == nil {
+			t.Fatalf("expected %v to fail", args)
+		}
+	}
+}
+
+func writeGroupConfig(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := `services:
+  - name: service1
+    envs:
+      dev:
+        target_instance_id: "i-0123456789abcdef0"
+        remote_host: "dev.internal"
+        remote_port: 5432
+  - name: service2
+    envs:
+      qa:
+        target_instance_id: "i-0123456789abcdef0"
+        remote_host: "qa.internal"
+        remote_port: 3306
+groups:
+  Local-Stack:
+    - service1/dev
+    - service2/qa
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestUpConnectsGroupMembers(t *testing.T) {
+	manager := &fakeAppManager{}
+	root := newRootCmd(&app{manager: manager})
+
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetErr(&out)
+	root.SetArgs([]string{"--config", writeGroupConfig(t), "up", "local-stack"})
+
+	if err := root.Execute(); err != nil {
+		t.Fatalf("up command failed: %v", err)
+	}
+	if len(manager.startCalls) != 2 {
+		t.Fatalf("expected two start calls, got %d", len(manager.startCalls))
+	}
+	if got := manager.startCalls[1]; got.Service != "service2" || got.Env != "qa" || got.RemotePort != 3306 {
+		t.Fatalf("unexpected second member: %+v", got)
+	}
+	for _, want := range []string{"service1/dev", "service2/qa", "connected"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected output to contain %q, got %q", want, out.String())
+		}
+	}
+}
+
+func TestDownStopsRunningGroupMembers(t *testing.T) {
+	manager := &fakeAppManager{listSessions: []session.SessionSummary{
+		{Key: session.NewSessionKey("service1", "dev")},
+		{Key: session.NewSessionKey("service3", "dev")},
+	}}
+	root := newRootCmd(&app{manager: manager})
+
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetErr(&out)
+	root.SetArgs([]string{"--config", writeGroupConfig(t), "down", "local-stack"})
+
+	if err := root.Execute(); err != nil {
+		t.Fatalf("down command failed: %v", err)
+	}
+	if len(manager.stopCalls) != 1 || manager.stopCalls[0] != "service1/dev" {
+		t.Fatalf("expected only service1/dev to be stopped, got %v", manager.stopCalls)
+	}
+	if !strings.Contains(out.String(), "service2/qa not running") {
+		t.Fatalf("expected not-running note, got %q", out.String())
+	}
+}
+
+func TestUpMatchesMixedCaseGroupName(t *testing.T) {
+	manager := &fakeAppManager{}
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", writeGroupConfig(t), "up", "Local-Stack"})
+
+	if err := root.Execute(); err != nil {
+		t.Fatalf("expected the group written as Local-Stack to be found, got %v", err)
+	}
+	if len(manager.startCalls) != 2 {
+		t.Fatalf("expected two start calls, got %d", len(manager.startCalls))
+	}
+}
+
+func TestUpUnknownGroupFails(t *testing.T) {
+	root := newRootCmd(&app{manager: &fakeAppManager{}})
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", writeGroupConfig(t), "up", "missing"})
+
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), "group not found") {
+		t.Fatalf("expected group not found error, got %v", err)
+	}
+}
+
+func TestConnectNoPortReuse(t *testing.T) {
+	manager := &fakeAppManager{}
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", writeTestConfig(t), "connect", "--no-port-reuse", "service1", "dev"})
+
+	if err := root.Execute(); err != nil {
+		t.Fatalf("connect command failed: %v", err)
+	}
+	if len(manager.startCalls) != 1 || !manager.startCalls[0].NoPortReuse {
+		t.Fatalf("expected start with NoPortReuse, got %+v", manager.startCalls)
+	}
+
+	root = newRootCmd(&app{manager: &fakeAppManager{}})
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", writeTestConfig(t), "connect", "--no-port-reuse", "--port", "5501", "service1", "dev"})
+	if err := root.Execute(); err == nil {
+		t.Fatal("expected --port with --no-port-reuse to fail")
+	}
+}
+
+func TestConnectVerboseTapsAWSOutput(t *testing.T) {
+	manager := &fakeAppManager{}
+	root := newRootCmd(&app{manager: manager})
+
+	var stdout, stderr bytes.Buffer
+	root.SetOut(&stdout)
+	root.SetErr(&stderr)
+	root.SetArgs([]string{"--config", writeTestConfig(t), "--verbose", "connect", "service1", "dev"})
+
+	if err := root.Execute(); err != nil {
+		t.Fatalf("connect command failed: %v", err)
+	}
+	if len(manager.startCalls) != 1 || manager.startCalls[0].LogTap == nil {
+		t.Fatalf("expected verbose connect to set a log tap, got %+v", manager.startCalls)
+	}
+	manager.startCalls[0].LogTap("SessionManagerPlugin is not found")
+	if !strings.Contains(stderr.String(), "[service1/dev] SessionManagerPlugin is not found") {
+		t.Fatalf("expected tapped line on stderr, got %q", stderr.String())
+	}
+}
+
+func TestHistoryRecordsConnectAndStop(t *testing.T) {
+	log := history.NewLog(filepath.Join(t.TempDir(), "history.jsonl"))
+	recorder := newHistoryManager(&fakeAppManager{}, log, nil)
+	a := &app{history: log, manager: recorder}
+
+	root := newRootCmd(a)
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", writeTestConfig(t), "connect", "service1", "dev"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+
+	// The session ends on its own (e.g. idle timeout); a failed start and a
+	// session that was never logged as connected are not stops.
+	events := make(chan session.Event, 3)
+	events <- session.Event{Type: session.EventSessionError, Key: "service2/qa", Service: "service2", Env: "qa", Error: "no free port"}
+	events <- session.Event{Type: session.EventSessionStopped, Key: "service1/dev", Service: "service1", Env: "dev", Endpoint: "127.0.0.1:55432"}
+	events <- session.Event{Type: session.EventSessionStopped, Key: "service1/dev", Service: "service1", Env: "dev"}
+	close(events)
+	recorder.recordEvents(events)
+
+	entries, err := log.Read()
+	if err != nil {
+		t.Fatalf("read history: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 history entries, got %+v", entries)
+	}
+	if e := entries[0]; e.Event != history.EventConnect || e.Key != "service1/dev" || e.Endpoint != "127.0.0.1:55432" || e.Profile != "corp" || e.Region != "sa-east-1" {
+		t.Fatalf("unexpected connect entry: %+v", e)
+	}
+	if e := entries[1]; e.Event != history.EventStop || e.Service != "service1" || e.Env != "dev" || e.Endpoint != "127.0.0.1:55432" {
+		t.Fatalf("unexpected stop entry: %+v", e)
+	}
+
+	root = newRootCmd(a)
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetErr(&out)
+	root.SetArgs([]string{"history", "--limit", "1", "--service", "service1"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if strings.Contains(out.String(), "connect") || !strings.Contains(out.String(), "stop") {
+		t.Fatalf("expected only the most recent entry, got %q", out.String())
+	}
+
+	reusing := newHistoryManager(&fakeAppManager{reused: map[string]bool{"dev": true}}, log, nil)
+	if _, err := reusing.Start(session.StartOptions{Service: "service1", Env: "dev", ReuseExisting: true}); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if entries, _ := log.Read(); len(entries) != 2 {
+		t.Fatalf("expected a reused session not to be logged, got %d entries", len(entries))
+	}
+}
+
+func TestHistoryFollowRecordsSessionsThatEndOnTheirOwn(t *testing.T) {
+	manager := session.NewManager()
+	manager.SetExecutor(sessiontest.FakeExecutor{})
+	log := history.NewLog(filepath.Join(t.TempDir(), "history.jsonl"))
+	recorder := newHistoryManager(manager, log, nil)
+	finish := recorder.follow(manager)
+
+	if _, err := recorder.Start(session.StartOptions{
+		Service:          "service1",
+		Env:              "dev",
+		TargetInstanceID: "i-0123456789abcdef0",
+		RemoteHost:       "db.internal",
+		RemotePort:       5432,
+		StartupTimeout:   5 * time.Second,
+		TTL:              200 * time.Millisecond,
+	}); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if _, err := manager.WaitForStop("service1/dev", 5*time.Second); err != nil {
+		t.Fatalf("expected the TTL to stop the session: %v", err)
+	}
+	_ = manager.Close()
+	finish()
+
+	entries, err := log.Read()
+	if err != nil {
+		t.Fatalf("read history: %v", err)
+	}
+	if len(entries) != 2 || entries[1].Event != history.EventStop || entries[1].Key != "service1/dev" {
+		t.Fatalf("expected a stop for the exited session, got %+v", entries)
+	}
+}
+
+func TestHistoryReportsWriteFailureOnce(t *testing.T) {
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var warnings []string
+	recorder := newHistoryManager(&fakeAppManager{}, history.NewLog(filepath.Join(blocker, "history.jsonl")), func(text string) {
+		warnings = append(warnings, text)
+	})
+
+	for _, env := range []string{"dev", "qa"} {
+		if _, err := recorder.Start(session.StartOptions{Service: "service1", Env: env}); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+	}
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "history: ") {
+		t.Fatalf("expected one history warning, got %q", warnings)
+	}
+}
+
+func TestConnectJSONPrintsResult(t *testing.T) {
+	manager := &fakeAppManager{}
+	root := newRootCmd(&app{manager: manager})
+
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", writeTestConfig(t), "connect", "service1", "dev", "--json"})
+
+	if err := root.Execute(); err != nil {
+		t.Fatalf("connect command failed: %v", err)
+	}
+
+	var got connectResult
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", out.String(), err)
+	}
+	if got.Service != "service1" || got.Env != "dev" || got.Bind != "127.0.0.1" || got.LocalPort != 55432 {
+		t.Fatalf("unexpected result: %+v", got)
+	}
+	if len(got.Forwards) != 0 {
+		t.Fatalf("expected no forwards for a single-port env, got %v", got.Forwards)
+	}
+}
+
+func TestConnectJSONPrintsErrorObject(t *testing.T) {
+	manager := &fakeAppManager{startErrs: map[string]error{"dev": errors.New("no free port")}}
+	root := newRootCmd(&app{manager: manager})
+
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", writeTestConfig(t), "connect", "service1", "dev", "--json"})
+
+	if err := root.Execute(); err == nil {
+		t.Fatal("expected connect to fail")
+	}
+
+	var got connectErrorJSON
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("expected JSON error output, got %q: %v", out.String(), err)
+	}
+	if !strings.Contains(got.Error, "no free port") {
+		t.Fatalf("expected start error in JSON, got %q", got.Error)
+	}
+}
+
+func TestConnectWithNoServicesNamesConfigPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte("defaults:\n  region: us-east-1\n"), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	root := newRootCmd(&app{manager: &fakeAppManager{}})
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", path, "connect", "service1", "dev"})
+
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), "no services configured in "+path) {
+		t.Fatalf("expected no services error naming %s, got %v", path, err)
+	}
+}
+
+func TestConfigShowPrintsEffectiveDefaults(t *testing.T) {
+	path := writeTestConfig(t)
+	root := newRootCmd(&app{manager: &fakeAppManager{}})
+
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", path, "config", "show"})
+
+	if err := root.Execute(); err != nil {
+		t.Fatalf("config show failed: %v", err)
+	}
+	for _, want := range []string{"# merged from: " + path, "profile: corp", "ready_check: tcp", "name: service1"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	root.SetArgs([]string{"--config", path, "config", "show", "--format", "json"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("config show --format json failed: %v", err)
+	}
+	var cfg config.Config
+	if err := json.Unmarshal(out.Bytes(), &cfg); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", out.String(), err)
+	}
+	if cfg.Defaults.Bind != "127.0.0.1" || len(cfg.Services) != 1 {
+		t.Fatalf("unexpected resolved config: %+v", cfg)
+	}
+}
+
+func TestConfigShowResolvesEachEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := `defaults:
+  bind: "127.0.0.2"
+  session_ttl: 1h
+  allow_hooks: true
+  pre_connect_hook: "echo pre"
+services:
+  - name: service1
+    envs:
+      dev:
+        target_instance_id: "i-0123456789abcdef0"
+        remote_host: "db.internal"
+        remote_port: 5432
+      qa:
+        target_instance_id: "i-0123456789abcdef0"
+        remote_host: "db.internal"
+        remote_port: 5432
+        bind: "127.0.0.3"
+        session_ttl: 30m
+        pre_connect_hook: "echo qa"
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	var out bytes.Buffer
+	root := newRootCmd(&app{manager: &fakeAppManager{}})
+	root.SetOut(&out)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", path, "config", "show", "--format", "json"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("config show failed: %v", err)
+	}
+
+	var cfg config.Config
+	if err := json.Unmarshal(out.Bytes(), &cfg); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", out.String(), err)
+	}
+	want := map[string][3]string{
+		"dev": {"127.0.0.2", "1h0m0s", "echo pre"},
+		"qa":  {"127.0.0.3", "30m0s", "echo qa"},
+	}
+	for name, w := range want {
+		env := cfg.Services[0].Envs[name]
+		if got := [3]string{env.Bind, env.SessionTTL, env.PreConnectHook}; got != w {
+			t.Fatalf("%s: expected bind, ttl and hook %v, got %v", name, w, got)
+		}
+	}
+}
+
+func TestConnectReuseFlagSetsStartOption(t *testing.T) {
+	manager := &fakeAppManager{}
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", writeTestConfig(t), "connect", "service1", "dev", "--reuse"})
+
+	if err := root.Execute(); err != nil {
+		t.Fatalf("connect command failed: %v", err)
+	}
+	if len(manager.startCalls) != 1 || !manager.startCalls[0].ReuseExisting {
+		t.Fatalf("expected ReuseExisting start, got %+v", manager.startCalls)
+	}
+}
+
+func TestPortPrintsOnlyTheLocalPort(t *testing.T) {
+	manager := &fakeAppManager{listSessions: []session.SessionSummary{
+		{Key: "service1/dev", Service: "service1", Env: "dev", Bind: "127.0.0.1", LocalPort: 5512},
+		{Key: "service2/qa:db", Service: "service2", Env: "qa:db", Bind: "127.0.0.1", LocalPort: 5513},
+	}}
+
+	var out bytes.Buffer
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(&out)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"port", "service1/dev"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("port failed: %v", err)
+	}
+	if out.String() != "5512\n" {
+		t.Fatalf("expected bare port, got %q", out.String())
+	}
+
+	for _, tt := range []struct {
+		arg  string
+		want string
+	}{
+		{arg: "service1/prod", want: "session not found"},
+		{arg: "service2/qa", want: "has 1 forwards (db); pick one, e.g. service2/qa:db"},
+	} {
+		out.Reset()
+		root.SetArgs([]string{"port", tt.arg})
+		err := root.Execute()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Fatalf("%s: expected error containing %q, got %v", tt.arg, tt.want, err)
+		}
+		if out.Len() != 0 {
+			t.Fatalf("%s: expected nothing on stdout, got %q", tt.arg, out.String())
+		}
+	}
+}
+
+func TestLsAllIncludesRecentlyStoppedSessions(t *testing.T) {
+	manager := &fakeAppManager{
+		listSessions: []session.SessionSummary{
+			{Key: "service1/dev", Bind: "127.0.0.1", LocalPort: 5512, State: session.SessionStateRunning},
+		},
+		recentlyStopped: []session.SessionSummary{
+			{Key: "service2/qa", Bind: "127.0.0.1", LocalPort: 5513, State: session.SessionStateError, LastError: "process exited: exit status 255", StoppedAt: time.Now().Add(-time.Minute)},
+		},
+	}
+
+	var out bytes.Buffer
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(&out)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"ls"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("ls failed: %v", err)
+	}
+	if strings.Contains(out.String(), "service2/qa") {
+		t.Fatalf("expected plain ls to skip stopped sessions, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	root.SetArgs([]string{"ls", "--all"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("ls --all failed: %v", err)
+	}
+	for _, want := range []string{"service1/dev", "service2/qa", "error", "ended 1m", "exit status 255"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %q in ls --all output, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestLsJSON(t *testing.T) {
+	healthy := time.Now().Add(-time.Minute)
+	manager := &fakeAppManager{
+		listSessions: []session.SessionSummary{
+			{Key: "service1/dev", Service: "service1", Env: "dev", Bind: "127.0.0.1", LocalPort: 5512, State: session.SessionStateRunning, LastHealthyAt: healthy, StartupLatency: 2 * time.Second, Reconnects: 2, LastReconnect: healthy},
+		},
+	}
+
+	var out bytes.Buffer
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(&out)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"ls", "--json"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("ls --json failed: %v", err)
+	}
+
+	var got []sessionListEntry
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("decode ls: %v\n%s", err, out.String())
+	}
+	if len(got) != 1 || got[0].Key != "service1/dev" || got[0].LocalPort != 5512 || got[0].StartupLatencyMS != 2000 {
+		t.Fatalf("unexpected ls entries: %+v", got)
+	}
+	if got[0].LastHealthyAt == nil || got[0].StoppedAt != nil {
+		t.Fatalf("expected last_healthy_at and no stopped_at, got %+v", got[0])
+	}
+	if got[0].Reconnects != 2 || got[0].LastReconnect == nil || !got[0].LastReconnect.Equal(healthy) {
+		t.Fatalf("expected reconnects with last_reconnect, got %+v", got[0])
+	}
+
+	manager.listSessions = nil
+	out.Reset()
+	if err := root.Execute(); err != nil {
+		t.Fatalf("ls --json failed: %v", err)
+	}
+	if strings.TrimSpace(out.String()) != "[]" {
+		t.Fatalf("expected an empty JSON list, got %q", out.String())
+	}
+}
+
+func TestLsProbe(t *testing.T) {
+	prev := probeEndpointFn
+	probeEndpointFn = func(bind string, port int, timeout time.Duration) error {
+		if port == 5513 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	t.Cleanup(func() { probeEndpointFn = prev })
+
+	manager := &fakeAppManager{
+		listSessions: []session.SessionSummary{
+			{Key: "service1/dev", Bind: "127.0.0.1", LocalPort: 5512, State: session.SessionStateRunning},
+			{Key: "service1/stg", Bind: "127.0.0.1", LocalPort: 5513, State: session.SessionStateRunning},
+		},
+		recentlyStopped: []session.SessionSummary{
+			{Key: "service1/qa", Bind: "127.0.0.1", LocalPort: 5514, State: session.SessionStateStopped},
+		},
+	}
+
+	var out bytes.Buffer
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(&out)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"ls", "--all", "--probe"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("ls --probe failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[0], "REACHABLE") {
+		t.Fatalf("expected a REACHABLE column, got:\n%s", out.String())
+	}
+	for i, want := range []string{"yes", "no", "-"} {
+		if fields := strings.Fields(lines[i+1]); fields[len(fields)-1] != want {
+			t.Fatalf("expected %q for %s, got %q", want, fields[0], lines[i+1])
+		}
+	}
+
+	out.Reset()
+	root = newRootCmd(&app{manager: manager})
+	root.SetOut(&out)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"ls", "--probe", "--json"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("ls --probe --json failed: %v", err)
+	}
+	var got []sessionListEntry
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("decode ls: %v\n%s", err, out.String())
+	}
+	if len(got) != 2 || got[0].Reachable == nil || !*got[0].Reachable || got[1].Reachable == nil || *got[1].Reachable {
+		t.Fatalf("unexpected reachability: %+v", got)
+	}
+}
+
+func TestStatusJSONIncludesStartedArgs(t *testing.T) {
+	s := session.NewSession("service1", "dev")
+	s.Bind, s.LocalPort, s.State, s.Region = "127.0.0.1", 5512, session.SessionStateRunning, "sa-east-1"
+	s.StartedArgs = session.BuildSSMPortForwardArgs("i-1", "db.internal", 5432, 5512, "sa-east-1", "corp")
+	s.StartupLatency = 1500 * time.Millisecond
+	manager := &fakeAppManager{sessions: []*session.Session{s}}
+
+	var out bytes.Buffer
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(&out)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"status", "service1/dev", "--json"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+
+	var got sessionStatus
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("decode status: %v\n%s", err, out.String())
+	}
+	if got.Key != "service1/dev" || got.LocalPort != 5512 || got.State != "running" {
+		t.Fatalf("unexpected status: %+v", got)
+	}
+	if strings.Join(got.Args, " ") != strings.Join(s.StartedArgs, " ") {
+		t.Fatalf("expected args %v, got %v", s.StartedArgs, got.Args)
+	}
+	if got.StartupLatencyMS != 1500 {
+		t.Fatalf("expected startup_latency_ms 1500, got %d", got.StartupLatencyMS)
+	}
+
+	root.SetArgs([]string{"status", "service1/prod"})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "session not found") {
+		t.Fatalf("expected session not found, got %v", err)
+	}
+}
+
+func TestKillKillsEveryForwardOfAnEnv(t *testing.T) {
+	manager := &fakeAppManager{listSessions: []session.SessionSummary{
+		{Key: "service1/dev:db", Service: "service1", Env: "dev:db"},
+		{Key: "service1/dev:metrics", Service: "service1", Env: "dev:metrics"},
+		{Key: "service2/qa", Service: "service2", Env: "qa"},
+	}}
+
+	var out bytes.Buffer
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(&out)
+	root.SetArgs([]string{"kill", "service1", "dev"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("kill failed: %v", err)
+	}
+	if len(manager.killCalls) != 2 || len(manager.stopCalls) != 0 {
+		t.Fatalf("expected both forwards killed without a graceful stop, got kill=%v stop=%v", manager.killCalls, manager.stopCalls)
+	}
+	if !strings.Contains(out.String(), "killed service1/dev:db") {
+		t.Fatalf("expected killed lines, got %q", out.String())
+	}
+}
+
+func TestReapListsOrphansAndKillsWithFlag(t *testing.T) {
+	manager := &fakeAppManager{orphans: []session.PortOwner{
+		{Port: 5510, PID: 4141, Command: "session-manager-plugin"},
+	}}
+	var killed []int
+	prev := killOrphanFn
+	killOrphanFn = func(o session.PortOwner) error {
+		killed = append(killed, o.PID)
+		return nil
+	}
+	defer func() { killOrphanFn = prev }()
+
+	var out bytes.Buffer
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(&out)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", writeTestConfig(t), "reap"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("reap failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "5510") || !strings.Contains(out.String(), "4141") || len(killed) != 0 {
+		t.Fatalf("expected a listing without kills, got %q (killed %v)", out.String(), killed)
+	}
+
+	out.Reset()
+	root.SetArgs([]string{"--config", writeTestConfig(t), "reap", "--kill"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("reap --kill failed: %v", err)
+	}
+	if len(killed) != 1 || killed[0] != 4141 || !strings.Contains(out.String(), "killed session-manager-plugin pid=4141 port=5510") {
+		t.Fatalf("expected pid 4141 killed, got %q (killed %v)", out.String(), killed)
+	}
+}
+
+func TestLogsAcceptsTwoArgFormForSlashedServiceNames(t *testing.T) {
+	manager := &fakeAppManager{listSessions: []session.SessionSummary{
+		{Key: "team/api/dev", Service: "team/api", Env: "dev", Bind: "127.0.0.1", LocalPort: 5512},
+	}}
+
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"logs", "team/api", "dev"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("expected two-arg logs to find team/api/dev, got %v", err)
+	}
+
+	root.SetArgs([]string{"logs", "team/api/dev"})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "expected <service>/<env>") {
+		t.Fatalf("expected the slash form to reject a slashed service name, got %v", err)
+	}
+}
+
+func TestLogsListsForwardsForMultiPortEnv(t *testing.T) {
+	manager := &fakeAppManager{listSessions: []session.SessionSummary{
+		{Key: "service1/dev:db", Service: "service1", Env: "dev:db", Bind: "127.0.0.1", LocalPort: 5512},
+		{Key: "service1/dev:metrics", Service: "service1", Env: "dev:metrics", Bind: "127.0.0.1", LocalPort: 5513},
+	}}
+
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"logs", "service1/dev"})
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), "service1/dev has 2 forwards (db, metrics); pick one, e.g. service1/dev:db") {
+		t.Fatalf("expected the forwards to be listed, got %v", err)
+	}
+
+	root.SetArgs([]string{"logs", "service1/dev:metrics"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("expected logs for a named forward, got %v", err)
+	}
+}
+
+func TestConnectUsesEnvBindUnlessFlagOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := `services:
+  - name: service1
+    envs:
+      dev:
+        target_instance_id: "i-0123456789abcdef0"
+        remote_host: "db.internal"
+        remote_port: 5432
+        bind: "127.0.0.2"
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"connect", "service1", "dev"}, want: "127.0.0.2"},
+		{args: []string{"connect", "service1", "dev", "--bind", "127.0.0.3"}, want: "127.0.0.3"},
+	} {
+		manager := &fakeAppManager{}
+		root := newRootCmd(&app{manager: manager})
+		root.SetOut(io.Discard)
+		root.SetErr(io.Discard)
+		root.SetArgs(append([]string{"--config", path}, tt.args...))
+		if err := root.Execute(); err != nil {
+			t.Fatalf("%v: connect failed: %v", tt.args, err)
+		}
+		if got := manager.startCalls[0].Bind; got != tt.want {
+			t.Fatalf("%v: expected bind %s, got %s", tt.args, tt.want, got)
+		}
+	}
+}
+
+func TestConnectPublicBindRequiresFlagAndWarns(t *testing.T) {
+	manager := &fakeAppManager{}
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", writeTestConfig(t), "connect", "service1", "dev", "--bind", "0.0.0.0"})
+
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), "--allow-public-bind") {
+		t.Fatalf("expected public bind to be refused, got %v", err)
+	}
+	if len(manager.startCalls) != 0 {
+		t.Fatalf("expected no start calls, got %d", len(manager.startCalls))
+	}
+
+	var stderr bytes.Buffer
+	root = newRootCmd(&app{manager: manager})
+	root.SetOut(io.Discard)
+	root.SetErr(&stderr)
+	root.SetArgs([]string{"--config", writeTestConfig(t), "--allow-public-bind", "connect", "service1", "dev", "--bind", "0.0.0.0"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("connect with --allow-public-bind failed: %v", err)
+	}
+	if !strings.Contains(stderr.String(), "WARNING: service1/dev binds to 0.0.0.0") {
+		t.Fatalf("expected public bind warning on stderr, got %q", stderr.String())
+	}
+}
+
+func TestLogsShowSourceTagsAwsOutput(t *testing.T) {
+	s := session.NewSession("service1", "dev")
+	s.AppendLogFrom(session.LogSourceStdout, "Starting session")
+	s.AppendLogFrom(session.LogSourceStderr, "An error occurred")
+	s.AppendLog("readiness: ready")
+	manager := &fakeAppManager{sessions: []*session.Session{s}}
+
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"logs", "service1/dev"}, want: "Starting session\nAn error occurred\nreadiness: ready\n"},
+		{args: []string{"logs", "service1/dev", "--show-source"}, want: "[out] Starting session\n[err] An error occurred\nreadiness: ready\n"},
+	} {
+		var out bytes.Buffer
+		root := newRootCmd(&app{manager: manager})
+		root.SetOut(&out)
+		root.SetErr(io.Discard)
+		root.SetArgs(tt.args)
+		if err := root.Execute(); err != nil {
+			t.Fatalf("%v failed: %v", tt.args, err)
+		}
+		if out.String() != tt.want {
+			t.Fatalf("%v: expected %q, got %q", tt.args, tt.want, out.String())
+		}
+	}
+}
+
+func TestLogsAllDumpsWholeBuffer(t *testing.T) {
+	s := session.NewSession("service1", "dev")
+	for i := 0; i < session.DefaultRingBufferLines+10; i++ {
+		s.AppendLog("line " + strconv.Itoa(i))
+	}
+	manager := &fakeAppManager{sessions: []*session.Session{s}}
+
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		root := newRootCmd(&app{manager: manager})
+		root.SetOut(&out)
+		root.SetErr(io.Discard)
+		root.SetArgs(append([]string{"logs", "service1/dev"}, args...))
+		err := root.Execute()
+		return out.String(), err
+	}
+
+	for _, args := range [][]string{{"--all"}, {"--lines", "-1"}} {
+		out, err := run(args...)
+		if err != nil {
+			t.Fatalf("%v failed: %v", args, err)
+		}
+		got := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+		if len(got) != session.DefaultRingBufferLines || got[0] != "line 10" {
+			t.Fatalf("%v: expected the last %d lines from \"line 10\", got %d from %q", args, session.DefaultRingBufferLines, len(got), got[0])
+		}
+	}
+
+	if out, err := run(); err != nil || strings.Count(out, "\n") != defaultLogLines {
+		t.Fatalf("expected the default %d lines, got %d (%v)", defaultLogLines, strings.Count(out, "\n"), err)
+	}
+	if _, err := run("--lines", "-2"); err == nil {
+		t.Fatal("expected --lines -2 to be rejected")
+	}
+	if _, err := run("--all", "--lines", "5"); err == nil || !strings.Contains(err.Error(), "--all") {
+		t.Fatalf("expected --all with --lines to be rejected, got %v", err)
+	}
+}
+
+func TestLogsJSONEmitsOneObjectPerLine(t *testing.T) {
+	manager := &fakeAppManager{
+		listSessions: []session.SessionSummary{{Key: "service1/dev", Service: "service1", Env: "dev"}},
+		bufferedLogs: []string{"old-1"},
+		streamedLogs: []string{"new-1"},
+	}
+
+	for _, tt := range []struct {
+		args       []string
+		wantSource string
+		wantLine   string
+	}{
+		{args: []string{"logs", "service1/dev", "--json"}, wantSource: "dbx", wantLine: "old-1"},
+		{args: []string{"logs", "service1/dev", "--json", "--lines", "0", "--follow"}, wantSource: "stdout", wantLine: "new-1"},
+	} {
+		var out bytes.Buffer
+		root := newRootCmd(&app{manager: manager})
+		root.SetOut(&out)
+		root.SetErr(io.Discard)
+		root.SetArgs(tt.args)
+		if err := root.Execute(); err != nil {
+			t.Fatalf("%v failed: %v", tt.args, err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 1 {
+			t.Fatalf("%v: expected one JSON line, got %q", tt.args, out.String())
+		}
+		var got struct {
+			TS     time.Time `json:"ts"`
+			Source string    `json:"source"`
+			Line   string    `json:"line"`
+		}
+		if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+			t.Fatalf("%v: invalid JSON %q: %v", tt.args, lines[0], err)
+		}
+		if got.TS.IsZero() || got.Source != tt.wantSource || got.Line != tt.wantLine {
+			t.Fatalf("%v: expected a timestamped %s line %q, got %+v", tt.args, tt.wantSource, tt.wantLine, got)
+		}
+	}
+}
+
+func TestLogsFollowWithZeroLinesOnlyStreamsNewLines(t *testing.T) {
+	manager := &fakeAppManager{
+		listSessions: []session.SessionSummary{{Key: "service1/dev", Service: "service1", Env: "dev"}},
+		bufferedLogs: []string{"old-1", "old-2"},
+		streamedLogs: []string{"new-1", "new-2"},
+	}
+
+	var out bytes.Buffer
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(&out)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"logs", "service1/dev", "--lines", "0", "--follow"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("logs failed: %v", err)
+	}
+
+	if manager.subscribed != 1 {
+		t.Fatalf("expected one log subscription, got %d", manager.subscribed)
+	}
+	if out.String() != "new-1\nnew-2\n" {
+		t.Fatalf("expected only streamed lines, got %q", out.String())
+	}
+}
+
+func TestLogsFollowPrintsBacklogThenStreamsUntilSessionEnds(t *testing.T) {
+	manager := &fakeAppManager{
+		listSessions: []session.SessionSummary{{Key: "service1/dev", Service: "service1", Env: "dev"}},
+		bufferedLogs: []string{"old-1", "old-2", "old-3"},
+		streamedLogs: []string{"new-1"},
+	}
+
+	var out bytes.Buffer
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(&out)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"logs", "service1/dev", "--lines", "2", "--follow"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("logs failed: %v", err)
+	}
+
+	if out.String() != "old-2\nold-3\nnew-1\n" {
+		t.Fatalf("expected backlog then streamed lines, got %q", out.String())
+	}
+	if manager.followPolicy != session.DropOldest {
+		t.Fatalf("expected a follower that never blocks the session, got policy %v", manager.followPolicy)
+	}
+}
+
+func TestLogsFollowReportsDroppedLines(t *testing.T) {
+	manager := &fakeAppManager{
+		listSessions: []session.SessionSummary{{Key: "service1/dev", Service: "service1", Env: "dev"}},
+		streamedLogs: []string{"new-1", "new-2"},
+		dropped:      7,
+	}
+
+	var out, errOut bytes.Buffer
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(&out)
+	root.SetErr(&errOut)
+	root.SetArgs([]string{"logs", "service1/dev", "--lines", "0", "--follow"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("logs failed: %v", err)
+	}
+
+	if out.String() != "new-1\nnew-2\n" {
+		t.Fatalf("expected the lines on stdout only, got %q", out.String())
+	}
+	if strings.Count(errOut.String(), "dropped") != 1 || !strings.Contains(errOut.String(), "dropped 7 log lines") {
+		t.Fatalf("expected one drop note on stderr, got %q", errOut.String())
+	}
+}
+
+func TestTargetsListsConfiguredPairsWithRunningState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := `services:
+  - name: service1
+    envs:
+      dev:
+        target_instance_id: "i-0123456789abcdef0"
+        remote_host: "db.internal"
+        remote_port: 5432
+      qa:
+        target_instance_id: "i-0123456789abcdef1"
+        remote_host: "db.qa.internal"
+        ports:
+          - name: db
+            remote_port: 5432
+          - name: metrics
+            remote_port: 9187
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	manager := &fakeAppManager{listSessions: []session.SessionSummary{
+		{Key: "service1/qa:db", Service: "service1", Env: "qa:db"},
+	}}
+
+	var out bytes.Buffer
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(&out)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--config", path, "targets"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("targets failed: %v", err)
+	}
+	for _, want := range []string{
+		"service1/dev  db.internal:5432          no",
+		"service1/qa   db.qa.internal:5432,9187  yes",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %q in output, got:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	root.SetArgs([]string{"--config", path, "targets", "--json"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("targets --json failed: %v", err)
+	}
+	var got []targetStatus
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out.String())
+	}
+	if len(got) != 2 || got[0].Key != "service1/dev" || got[0].Running || !got[1].Running || len(got[1].RemotePorts) != 2 {
+		t.Fatalf("unexpected targets %+v", got)
+	}
+}
+
+func TestEnvPrintsPortPerSession(t *testing.T) {
+	manager := &fakeAppManager{listSessions: []session.SessionSummary{
+		{Key: "service1/dev", Service: "service1", Env: "dev", LocalPort: 5500},
+		{Key: "billing-api/qa:db", Service: "billing-api", Env: "qa:db", LocalPort: 5501},
+	}}
+
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"env"}, want: "export DBX_SERVICE1_DEV_PORT=5500\nexport DBX_BILLING_API_QA_DB_PORT=5501\n"},
+		{args: []string{"env", "--prefix", "", "--format", "fish"}, want: "set -gx SERVICE1_DEV_PORT 5500\nset -gx BILLING_API_QA_DB_PORT 5501\n"},
+		{args: []string{"env", "--format", "powershell"}, want: "$env:DBX_SERVICE1_DEV_PORT = \"5500\"\n$env:DBX_BILLING_API_QA_DB_PORT = \"5501\"\n"},
+	} {
+		var out bytes.Buffer
+		root := newRootCmd(&app{manager: manager})
+		root.SetOut(&out)
+		root.SetErr(io.Discard)
+		root.SetArgs(tt.args)
+		if err := root.Execute(); err != nil {
+			t.Fatalf("%v failed: %v", tt.args, err)
+		}
+		if out.String() != tt.want {
+			t.Fatalf("%v: expected %q, got %q", tt.args, tt.want, out.String())
+		}
+	}
+
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"env", "--format", "cmd"})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "unsupported --format") {
+		t.Fatalf("expected a format error, got %v", err)
+	}
+}
+
+func TestEnvCollisionPrintsNothing(t *testing.T) {
+	manager := &fakeAppManager{listSessions: []session.SessionSummary{
+		{Key: "service_1/dev", Service: "service_1", Env: "dev", LocalPort: 5500},
+		{Key: "service-1/dev", Service: "service-1", Env: "dev", LocalPort: 5501},
+	}}
+
+	var out bytes.Buffer
+	root := newRootCmd(&app{manager: manager})
+	root.SetOut(&out)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"env", "--prefix", ""})
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), "both map to") {
+		t.Fatalf("expected a collision error, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("expected nothing on stdout, got %q", out.String())
+	}
+}
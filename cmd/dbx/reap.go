@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/fredyranthun/db/internal/session"
+	"github.com/spf13/cobra"
+)
+
+var killOrphanFn = session.KillOrphan
+
+// newReapCmd lists, and with --kill stops, aws/session-manager-plugin
+// processes holding ports in port_range that this dbx did not start, such as
+// forwards left behind when an earlier dbx was killed.
+func (a *app) newReapCmd() *cobra.Command {
+	var kill bool
+
+	cmd := &cobra.Command{
+		Use:   "reap",
+		Short: "Find (and with --kill, stop) orphaned forwards holding ports in port_range",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := a.loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+			portRange := cfg.EffectiveDefaults().PortRange
+
+			orphans, err := a.manager.Orphans(portRange[0], portRange[1])
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if len(orphans) == 0 {
+				fmt.Fprintf(out, "no orphaned forwards in %d-%d\n", portRange[0], portRange[1])
+				return nil
+			}
+
+			if !kill {
+				w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "PORT\tPID\tCOMMAND")
+				for _, o := range orphans {
+					fmt.Fprintf(w, "%d\t%d\t%s\n", o.Port, o.PID, o.Command)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.ErrOrStderr(), "run `dbx reap --kill` to stop them")
+				return nil
+			}
+
+			var errs []error
+			for _, o := range orphans {
+				if err := killOrphanFn(o); err != nil {
+					errs = append(errs, fmt.Errorf("port %d: %w", o.Port, err))
+					continue
+				}
+				fmt.Fprintf(out, "killed %s pid=%d port=%d\n", o.Command, o.PID, o.Port)
+			}
+			return errors.Join(errs...)
+		},
+	}
+
+	cmd.Flags().BoolVar(&kill, "kill", false, "SIGKILL the orphaned processes")
+
+	return cmd
+}
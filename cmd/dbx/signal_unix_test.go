@@ -0,0 +1,55 @@
+//go:build !windows
+
+package main
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSignalCleanupStopsSessionsOnHangup(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		uiReload bool
+		attached bool
+		wantExit bool
+	}{
+		{name: "cli", wantExit: true},
+		{name: "ui with terminal reloads", uiReload: true, attached: true},
+		{name: "ui after terminal hangup", uiReload: true, wantExit: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := &fakeAppManager{}
+			exited := make(chan int, 1)
+			a := &app{
+				manager:          manager,
+				uiReload:         tt.uiReload,
+				exit:             func(code int) { exited <- code },
+				terminalAttached: func() bool { return tt.attached },
+			}
+
+			stop := a.installSignalCleanup(io.Discard)
+			defer stop()
+			if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+				t.Fatalf("send SIGHUP: %v", err)
+			}
+
+			select {
+			case code := <-exited:
+				if !tt.wantExit {
+					t.Fatalf("expected SIGHUP to be left to the config reload, exited %d", code)
+				}
+				if code != 130 || len(manager.stopAllTimeouts) != 1 || manager.stopAllTimeouts[0] != signalCleanupTimeout {
+					t.Fatalf("expected a bounded StopAll then exit 130, got exit %d with StopAllWithTimeout calls %v", code, manager.stopAllTimeouts)
+				}
+			case <-time.After(300 * time.Millisecond):
+				if tt.wantExit {
+					t.Fatal("expected SIGHUP to stop sessions and exit")
+				}
+			}
+		})
+	}
+}
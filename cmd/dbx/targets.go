@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fredyranthun/db/internal/session"
+	"github.com/spf13/cobra"
+)
+
+type targetStatus struct {
+	Key         string `json:"key"`
+	Service     string `json:"service"`
+	Env         string `json:"env"`
+	RemoteHost  string `json:"remote_host"`
+	RemotePorts []int  `json:"remote_ports"`
+	Running     bool   `json:"running"`
+}
+
+// newTargetsCmd lists every configured service/env pair, like the UI's
+// targets pane, and whether a session is running for it.
+func (a *app) newTargetsCmd() *cobra.Command {
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "targets",
+		Short: "List configured service/env targets",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := a.loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			summaries := a.manager.List()
+			var targets []targetStatus
+			for _, t := range cfg.Targets() {
+				key := session.NewSessionKey(t.Service, t.Env)
+				status := targetStatus{
+					Key:        string(key),
+					Service:    t.Service,
+					Env:        t.Env,
+					RemoteHost: t.Config.RemoteHost,
+					Running:    len(forwardGroupKeys(summaries, key)) > 0,
+				}
+				for _, fwd := range t.Config.Forwards() {
+					status.RemotePorts = append(status.RemotePorts, fwd.RemotePort)
+				}
+				for _, summary := range summaries {
+					if summary.Key == key {
+						status.Running = true
+					}
+				}
+				targets = append(targets, status)
+			}
+
+			out := cmd.OutOrStdout()
+			if asJSON {
+				if targets == nil {
+					targets = []targetStatus{}
+				}
+				return writeJSON(out, targets)
+			}
+			if len(targets) == 0 {
+				fmt.Fprintln(out, "no targets configured")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "KEY\tREMOTE\tRUNNING")
+			for _, t := range targets {
+				ports := make([]string, 0, len(t.RemotePorts))
+				for _, port := range t.RemotePorts {
+					ports = append(ports, strconv.Itoa(port))
+				}
+				running := "no"
+				if t.Running {
+					running = "yes"
+				}
+				fmt.Fprintf(w, "%s\t%s:%s\t%s\n", t.Key, t.RemoteHost, strings.Join(ports, ","), running)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print targets as JSON")
+	return cmd
+}
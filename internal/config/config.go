@@ -1,19 +1,127 @@
 package config
 
+import (
+	"maps"
+	"net"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// Port strategies accepted by defaults.port_strategy.
+const (
+	PortStrategySequential = "sequential"
+	PortStrategyRandom     = "random"
+)
+
+// Local port allocators accepted by defaults.auto_port.
+const (
+	AutoPortDBX = "dbx"
+	AutoPortSSM = "ssm"
+)
+
+// Graceful stop signals accepted by defaults.stop_signal.
+const (
+	StopSignalInt  = "int"
+	StopSignalTerm = "term"
+)
+
+// Readiness checks accepted by defaults.ready_check.
+const (
+	ReadyCheckTCP    = "tcp"
+	ReadyCheckBanner = "banner"
+	ReadyCheckBoth   = "both"
+)
+
+// DefaultReadyBanner matches the line the SSM plugin prints once the local
+// listener is up.
+const DefaultReadyBanner = `Waiting for connections`
+
 // Config is the root dbx configuration model.
 type Config struct {
 	Defaults Defaults  `mapstructure:"defaults" json:"defaults" yaml:"defaults"`
 	Services []Service `mapstructure:"services" json:"services" yaml:"services"`
+	// Groups maps a group name to "service/env" members for dbx up/down.
+	Groups map[string][]string `mapstructure:"groups" json:"groups" yaml:"groups"`
+	UI     UIConfig            `mapstructure:"ui" json:"ui,omitempty" yaml:"ui,omitempty"`
+	// Includes lists further config files, relative to the file naming them,
+	// that are merged underneath it. Loading resolves and clears it.
+	Includes []string `mapstructure:"includes" json:"includes,omitempty" yaml:"includes,omitempty"`
+}
+
+// UIConfig holds settings for dbx ui.
+type UIConfig struct {
+	// Keys rebinds UI actions, e.g. focus_next: [tab, l]. An action listed
+	// here replaces all of its default keys; the rest keep theirs.
+	Keys map[string][]string `mapstructure:"keys" json:"keys,omitempty" yaml:"keys,omitempty"`
+	// LogWrap soft-wraps long log lines in the logs pane instead of cutting
+	// them off; the wrap_logs key toggles it at runtime.
+	LogWrap *bool `mapstructure:"log_wrap" json:"log_wrap,omitempty" yaml:"log_wrap,omitempty"`
+}
+
+// LogWrapEnabled reports whether log_wrap is set to true.
+func (u UIConfig) LogWrapEnabled() bool {
+	return u.LogWrap != nil && *u.LogWrap
 }
 
 // Defaults contains global settings used by session definitions.
+//
+// Timeout fields are pointers so an explicit 0 can be told apart from "unset"
+// when merging; nil means "inherit".
 type Defaults struct {
 	Region                string `mapstructure:"region" json:"region" yaml:"region"`
 	Profile               string `mapstructure:"profile" json:"profile" yaml:"profile"`
 	Bind                  string `mapstructure:"bind" json:"bind" yaml:"bind"`
 	PortRange             []int  `mapstructure:"port_range" json:"port_range" yaml:"port_range"`
-	StartupTimeoutSeconds int    `mapstructure:"startup_timeout_seconds" json:"startup_timeout_seconds" yaml:"startup_timeout_seconds"`
-	StopTimeoutSeconds    int    `mapstructure:"stop_timeout_seconds" json:"stop_timeout_seconds" yaml:"stop_timeout_seconds"`
+	StartupTimeoutSeconds *int   `mapstructure:"startup_timeout_seconds" json:"startup_timeout_seconds" yaml:"startup_timeout_seconds"`
+	StopTimeoutSeconds    *int   `mapstructure:"stop_timeout_seconds" json:"stop_timeout_seconds" yaml:"stop_timeout_seconds"`
+	// ReadyCheck is "tcp" (default), "banner" or "both"; banner checks wait
+	// for a session log line matching ReadyBanner.
+	ReadyCheck  string `mapstructure:"ready_check" json:"ready_check" yaml:"ready_check"`
+	ReadyBanner string `mapstructure:"ready_banner" json:"ready_banner" yaml:"ready_banner"`
+	// ReadyPollInterval is how long each readiness attempt waits, e.g.
+	// "250ms"; empty keeps the 500ms default.
+	ReadyPollInterval string `mapstructure:"ready_poll_interval" json:"ready_poll_interval" yaml:"ready_poll_interval"`
+	// ReadyRetries caps the number of readiness attempts; nil or 0 keeps
+	// polling until startup_timeout_seconds.
+	ReadyRetries *int `mapstructure:"ready_retries" json:"ready_retries" yaml:"ready_retries"`
+	// NoPortReuse ignores pinned local_port values and always allocates from
+	// port_range. Like the timeouts, nil means "inherit".
+	NoPortReuse *bool `mapstructure:"no_port_reuse" json:"no_port_reuse" yaml:"no_port_reuse"`
+	// PortStrategy is "sequential" (default) or "random".
+	PortStrategy string `mapstructure:"port_strategy" json:"port_strategy" yaml:"port_strategy"`
+	// AutoPort picks who chooses the local port when an env has no
+	// local_port: "dbx" (default) allocates from port_range, "ssm" passes 0
+	// and reads the port the plugin reports.
+	AutoPort string `mapstructure:"auto_port" json:"auto_port" yaml:"auto_port"`
+	// Hooks are shell commands run before a session starts and after it
+	// stops. They only run when AllowHooks is true.
+	AllowHooks     *bool  `mapstructure:"allow_hooks" json:"allow_hooks" yaml:"allow_hooks"`
+	PreConnectHook string `mapstructure:"pre_connect_hook" json:"pre_connect_hook" yaml:"pre_connect_hook"`
+	PostStopHook   string `mapstructure:"post_stop_hook" json:"post_stop_hook" yaml:"post_stop_hook"`
+	// RedactLogs masks AWS access keys, secrets and bearer tokens in session
+	// logs and status output. Like the timeouts, nil means "inherit".
+	RedactLogs *bool `mapstructure:"redact_logs" json:"redact_logs" yaml:"redact_logs"`
+	// WebhookURL receives a JSON POST on connect, stop and error events.
+	WebhookURL string `mapstructure:"webhook_url" json:"webhook_url" yaml:"webhook_url"`
+	// IdleTimeout is a duration such as "30m"; sessions with no connections
+	// to their local port for that long are stopped. Empty disables it.
+	IdleTimeout string `mapstructure:"idle_timeout" json:"idle_timeout" yaml:"idle_timeout"`
+	// SessionTTL is a duration after which a session is stopped regardless
+	// of activity. Envs can override it. Empty disables it.
+	SessionTTL string `mapstructure:"session_ttl" json:"session_ttl" yaml:"session_ttl"`
+	// TargetCacheTTL is how long a target_tag lookup is reused, e.g. "5m";
+	// "0s" looks the instance up on every connect.
+	TargetCacheTTL string `mapstructure:"target_cache_ttl" json:"target_cache_ttl,omitempty" yaml:"target_cache_ttl,omitempty"`
+	// Env holds extra environment variables for the aws process, e.g.
+	// AWS_CA_BUNDLE or HTTPS_PROXY. Envs can add to or override them.
+	Env map[string]string `mapstructure:"env" json:"env,omitempty" yaml:"env,omitempty"`
+	// CommandWrapper is prepended to the aws argv, e.g. ["aws-vault", "exec",
+	// "myprofile", "--"], so credential helpers can run the aws CLI.
+	CommandWrapper []string `mapstructure:"command_wrapper" json:"command_wrapper,omitempty" yaml:"command_wrapper,omitempty"`
+	// StopSignal is the signal a graceful stop sends before falling back to
+	// a kill: "int" (default) or "term".
+	StopSignal string `mapstructure:"stop_signal" json:"stop_signal,omitempty" yaml:"stop_signal,omitempty"`
 }
 
 // Service groups environments for a named application/service.
@@ -24,13 +132,77 @@ type Service struct {
 
 // EnvConfig defines the per-environment SSM forwarding target.
 type EnvConfig struct {
-	TargetInstanceID string `mapstructure:"target_instance_id" json:"target_instance_id" yaml:"target_instance_id"`
-	RemoteHost       string `mapstructure:"remote_host" json:"remote_host" yaml:"remote_host"`
-	RemotePort       int    `mapstructure:"remote_port" json:"remote_port" yaml:"remote_port"`
-	LocalPort        int    `mapstructure:"local_port" json:"local_port" yaml:"local_port"`
+	TargetInstanceID string       `mapstructure:"target_instance_id" json:"target_instance_id" yaml:"target_instance_id"`
+	RemoteHost       string       `mapstructure:"remote_host" json:"remote_host" yaml:"remote_host"`
+	RemotePort       int          `mapstructure:"remote_port" json:"remote_port" yaml:"remote_port"`
+	LocalPort        int          `mapstructure:"local_port" json:"local_port" yaml:"local_port"`
+	Ports            []PortConfig `mapstructure:"ports" json:"ports" yaml:"ports"`
+	// TargetTag ("Key=Value") replaces TargetInstanceID with the one online
+	// SSM instance carrying that tag, looked up at connect time.
+	TargetTag string `mapstructure:"target_tag" json:"target_tag,omitempty" yaml:"target_tag,omitempty"`
+	// PreConnectHook and PostStopHook override the defaults for this env.
+	PreConnectHook string `mapstructure:"pre_connect_hook" json:"pre_connect_hook" yaml:"pre_connect_hook"`
+	PostStopHook   string `mapstructure:"post_stop_hook" json:"post_stop_hook" yaml:"post_stop_hook"`
+	// SessionTTL overrides defaults.session_ttl for this env.
+	SessionTTL string `mapstructure:"session_ttl" json:"session_ttl" yaml:"session_ttl"`
+	// Bind overrides defaults.bind for this env.
+	Bind string `mapstructure:"bind" json:"bind" yaml:"bind"`
+	// Env is merged over defaults.env for this env's aws process.
+	Env map[string]string `mapstructure:"env" json:"env,omitempty" yaml:"env,omitempty"`
+}
+
+// PortConfig is one named forward of a multi-port env.
+type PortConfig struct {
+	Name       string `mapstructure:"name" json:"name" yaml:"name"`
+	RemotePort int    `mapstructure:"remote_port" json:"remote_port" yaml:"remote_port"`
+	LocalPort  int    `mapstructure:"local_port" json:"local_port" yaml:"local_port"`
 }
 
-// Merged returns defaults with non-zero values from override applied.
+// Target is one configured service/env pair.
+type Target struct {
+	Service string
+	Env     string
+	Config  EnvConfig
+}
+
+// Targets returns every configured service/env pair, sorted by "service/env".
+func (c *Config) Targets() []Target {
+	if c == nil {
+		return nil
+	}
+
+	var targets []Target
+	for _, svc := range c.Services {
+		for envName, envCfg := range svc.Envs {
+			targets = append(targets, Target{Service: svc.Name, Env: envName, Config: envCfg})
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].Service+"/"+targets[i].Env < targets[j].Service+"/"+targets[j].Env
+	})
+	return targets
+}
+
+// Forwards returns the forwards to start for the env: the ports list when set,
+// otherwise a single unnamed forward built from remote_port/local_port.
+func (e EnvConfig) Forwards() []PortConfig {
+	if len(e.Ports) > 0 {
+		return append([]PortConfig(nil), e.Ports...)
+	}
+	return []PortConfig{{RemotePort: e.RemotePort, LocalPort: e.LocalPort}}
+}
+
+// EnvName returns the session env name for this forward: env itself for an
+// unnamed forward, "env:name" for a named one.
+func (p PortConfig) EnvName(env string) string {
+	if p.Name == "" {
+		return env
+	}
+	return env + ":" + p.Name
+}
+
+// Merged returns defaults with values set in override applied. Strings and
+// port_range are applied when non-empty, timeouts whenever they are non-nil.
 func (d Defaults) Merged(override Defaults) Defaults {
 	merged := d
 
@@ -46,23 +218,308 @@ func (d Defaults) Merged(override Defaults) Defaults {
 	if len(override.PortRange) > 0 {
 		merged.PortRange = append([]int(nil), override.PortRange...)
 	}
-	if override.StartupTimeoutSeconds != 0 {
-		merged.StartupTimeoutSeconds = override.StartupTimeoutSeconds
+	if override.StartupTimeoutSeconds != nil {
+		merged.StartupTimeoutSeconds = Int(*override.StartupTimeoutSeconds)
+	}
+	if override.StopTimeoutSeconds != nil {
+		merged.StopTimeoutSeconds = Int(*override.StopTimeoutSeconds)
+	}
+	if override.ReadyCheck != "" {
+		merged.ReadyCheck = override.ReadyCheck
+	}
+	if override.ReadyBanner != "" {
+		merged.ReadyBanner = override.ReadyBanner
 	}
-	if override.StopTimeoutSeconds != 0 {
-		merged.StopTimeoutSeconds = override.StopTimeoutSeconds
+	if override.ReadyPollInterval != "" {
+		merged.ReadyPollInterval = override.ReadyPollInterval
+	}
+	if override.ReadyRetries != nil {
+		merged.ReadyRetries = Int(*override.ReadyRetries)
+	}
+	if override.NoPortReuse != nil {
+		merged.NoPortReuse = Bool(*override.NoPortReuse)
+	}
+	if override.PortStrategy != "" {
+		merged.PortStrategy = override.PortStrategy
+	}
+	if override.AutoPort != "" {
+		merged.AutoPort = override.AutoPort
+	}
+	if override.AllowHooks != nil {
+		merged.AllowHooks = Bool(*override.AllowHooks)
+	}
+	if override.PreConnectHook != "" {
+		merged.PreConnectHook = override.PreConnectHook
+	}
+	if override.PostStopHook != "" {
+		merged.PostStopHook = override.PostStopHook
+	}
+	if override.RedactLogs != nil {
+		merged.RedactLogs = Bool(*override.RedactLogs)
+	}
+	if override.WebhookURL != "" {
+		merged.WebhookURL = override.WebhookURL
+	}
+	if override.IdleTimeout != "" {
+		merged.IdleTimeout = override.IdleTimeout
+	}
+	if override.SessionTTL != "" {
+		merged.SessionTTL = override.SessionTTL
+	}
+	if override.TargetCacheTTL != "" {
+		merged.TargetCacheTTL = override.TargetCacheTTL
+	}
+	if len(override.Env) > 0 {
+		env := make(map[string]string, len(d.Env)+len(override.Env))
+		maps.Copy(env, d.Env)
+		maps.Copy(env, override.Env)
+		merged.Env = env
+	}
+	if len(override.CommandWrapper) > 0 {
+		merged.CommandWrapper = append([]string(nil), override.CommandWrapper...)
+	}
+	if override.StopSignal != "" {
+		merged.StopSignal = override.StopSignal
 	}
 
 	return merged
 }
 
+// ReadyBannerPattern returns the banner regex readiness must observe, or nil
+// when ready_check only uses the TCP check.
+func (d Defaults) ReadyBannerPattern() (*regexp.Regexp, error) {
+	if d.ReadyCheck != ReadyCheckBanner && d.ReadyCheck != ReadyCheckBoth {
+		return nil, nil
+	}
+	pattern := d.ReadyBanner
+	if pattern == "" {
+		pattern = DefaultReadyBanner
+	}
+	return regexp.Compile(pattern)
+}
+
+// ReadyPollIntervalDuration returns ready_poll_interval; unset or invalid is 0.
+func (d Defaults) ReadyPollIntervalDuration() time.Duration {
+	return durationOrZero(d.ReadyPollInterval)
+}
+
+// ReadyRetryLimit returns ready_retries; unset is 0 (no limit).
+func (d Defaults) ReadyRetryLimit() int {
+	if d.ReadyRetries == nil {
+		return 0
+	}
+	return *d.ReadyRetries
+}
+
+// StartupTimeout returns startup_timeout_seconds as a duration; unset is 0.
+func (d Defaults) StartupTimeout() time.Duration {
+	return secondsOrZero(d.StartupTimeoutSeconds)
+}
+
+// StopTimeout returns stop_timeout_seconds as a duration; unset is 0.
+func (d Defaults) StopTimeout() time.Duration {
+	return secondsOrZero(d.StopTimeoutSeconds)
+}
+
+// IdleTimeoutDuration returns idle_timeout as a duration; unset or invalid is
+// 0, which disables the idle stop.
+func (d Defaults) IdleTimeoutDuration() time.Duration {
+	return durationOrZero(d.IdleTimeout)
+}
+
+// TargetCacheTTLDuration returns target_cache_ttl as a duration; unset or
+// invalid is 0.
+func (d Defaults) TargetCacheTTLDuration() time.Duration {
+	return durationOrZero(d.TargetCacheTTL)
+}
+
+// BindAddress returns the local bind address for env e: its own bind when
+// set, otherwise the default.
+func (e EnvConfig) BindAddress(defaults Defaults) string {
+	if e.Bind != "" {
+		return e.Bind
+	}
+	return defaults.Bind
+}
+
+// IsLoopbackBind reports whether bind only listens on the local machine.
+func IsLoopbackBind(bind string) bool {
+	if bind == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(bind)
+	return ip != nil && ip.IsLoopback()
+}
+
+// TTL returns the session TTL for env e: its own session_ttl when set,
+// otherwise the default. Unset or invalid is 0, which disables the TTL.
+func (e EnvConfig) TTL(defaults Defaults) time.Duration {
+	if e.SessionTTL != "" {
+		return durationOrZero(e.SessionTTL)
+	}
+	return durationOrZero(defaults.SessionTTL)
+}
+
+// ProcessEnv returns the environment variables for env e's aws process:
+// defaults.env, then e's own env, then overrides (e.g. from --env-file), each
+// winning over the ones before. Names are kept as written, so http_proxy and
+// HTTP_PROXY stay distinct.
+func (e EnvConfig) ProcessEnv(defaults Defaults, overrides map[string]string) map[string]string {
+	env := make(map[string]string, len(defaults.Env)+len(e.Env)+len(overrides))
+	maps.Copy(env, defaults.Env)
+	maps.Copy(env, e.Env)
+	maps.Copy(env, overrides)
+	return env
+}
+
+// PortReuseDisabled reports whether no_port_reuse is set to true.
+func (d Defaults) PortReuseDisabled() bool {
+	return d.NoPortReuse != nil && *d.NoPortReuse
+}
+
+// LogRedactionEnabled reports whether redact_logs is set to true.
+func (d Defaults) LogRedactionEnabled() bool {
+	return d.RedactLogs != nil && *d.RedactLogs
+}
+
+// HooksAllowed reports whether allow_hooks is set to true.
+func (d Defaults) HooksAllowed() bool {
+	return d.AllowHooks != nil && *d.AllowHooks
+}
+
+// Hooks returns the pre-connect and post-stop hooks for env e: its own when
+// set, otherwise the defaults. Both are empty unless hooks are allowed.
+func (e EnvConfig) Hooks(defaults Defaults) (preConnect, postStop string) {
+	if !defaults.HooksAllowed() {
+		return "", ""
+	}
+	preConnect, postStop = defaults.PreConnectHook, defaults.PostStopHook
+	if e.PreConnectHook != "" {
+		preConnect = e.PreConnectHook
+	}
+	if e.PostStopHook != "" {
+		postStop = e.PostStopHook
+	}
+	return preConnect, postStop
+}
+
+// Int returns a pointer to v, for setting optional numeric fields.
+func Int(v int) *int {
+	return &v
+}
+
+// Bool returns a pointer to v, for setting optional boolean fields.
+func Bool(v bool) *bool {
+	return &v
+}
+
+func durationOrZero(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+func secondsOrZero(v *int) time.Duration {
+	if v == nil {
+		return 0
+	}
+	return time.Duration(*v) * time.Second
+}
+
+// Merged returns c with overlay applied on top: defaults are merged field by
+// field, services with the same name have their envs replaced or extended, and
+// new services are appended in overlay order.
+func (c *Config) Merged(overlay *Config) *Config {
+	if c == nil {
+		return overlay
+	}
+	if overlay == nil {
+		return c
+	}
+
+	merged := &Config{
+		Defaults: c.Defaults.Merged(overlay.Defaults),
+		Services: make([]Service, 0, len(c.Services)+len(overlay.Services)),
+	}
+
+	if len(c.UI.Keys)+len(overlay.UI.Keys) > 0 {
+		merged.UI.Keys = make(map[string][]string, len(c.UI.Keys)+len(overlay.UI.Keys))
+		for action, keys := range c.UI.Keys {
+			merged.UI.Keys[action] = append([]string(nil), keys...)
+		}
+		for action, keys := range overlay.UI.Keys {
+			merged.UI.Keys[action] = append([]string(nil), keys...)
+		}
+	}
+	switch {
+	case overlay.UI.LogWrap != nil:
+		merged.UI.LogWrap = Bool(*overlay.UI.LogWrap)
+	case c.UI.LogWrap != nil:
+		merged.UI.LogWrap = Bool(*c.UI.LogWrap)
+	}
+
+	index := make(map[string]int, len(c.Services))
+	for _, svc := range c.Services {
+		index[svc.Name] = len(merged.Services)
+		merged.Services = append(merged.Services, svc.clone())
+	}
+
+	if len(c.Groups)+len(overlay.Groups) > 0 {
+		merged.Groups = make(map[string][]string, len(c.Groups)+len(overlay.Groups))
+		for name, members := range c.Groups {
+			merged.Groups[name] = append([]string(nil), members...)
+		}
+		for name, members := range overlay.Groups {
+			merged.Groups[name] = append([]string(nil), members...)
+		}
+	}
+
+	for _, svc := range overlay.Services {
+		i, ok := index[svc.Name]
+		if !ok {
+			index[svc.Name] = len(merged.Services)
+			merged.Services = append(merged.Services, svc.clone())
+			continue
+		}
+		if merged.Services[i].Envs == nil {
+			merged.Services[i].Envs = make(map[string]EnvConfig, len(svc.Envs))
+		}
+		for envName, envCfg := range svc.Envs {
+			merged.Services[i].Envs[envName] = envCfg
+		}
+	}
+
+	return merged
+}
+
+func (s Service) clone() Service {
+	out := Service{Name: s.Name}
+	if s.Envs != nil {
+		out.Envs = make(map[string]EnvConfig, len(s.Envs))
+		for envName, envCfg := range s.Envs {
+			out.Envs[envName] = envCfg
+		}
+	}
+	return out
+}
+
 // EffectiveDefaults ensures default values used by dbx are present.
 func (c *Config) EffectiveDefaults() Defaults {
 	defaults := Defaults{
 		Bind:                  "127.0.0.1",
 		PortRange:             []int{5500, 5999},
-		StartupTimeoutSeconds: 15,
-		StopTimeoutSeconds:    5,
+		StartupTimeoutSeconds: Int(15),
+		StopTimeoutSeconds:    Int(5),
+		ReadyCheck:            ReadyCheckTCP,
+		PortStrategy:          PortStrategySequential,
+		AutoPort:              AutoPortDBX,
+		StopSignal:            StopSignalInt,
+		TargetCacheTTL:        "1m",
 	}
 	if c == nil {
 		return defaults
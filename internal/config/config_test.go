@@ -0,0 +1,59 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDefaultsMergedExplicitZeroOverridesNonZero(t *testing.T) {
+	base := Defaults{StartupTimeoutSeconds: Int(15), StopTimeoutSeconds: Int(5)}
+
+	merged := base.Merged(Defaults{StartupTimeoutSeconds: Int(0)})
+	if got := merged.StartupTimeout(); got != 0 {
+		t.Fatalf("expected explicit zero startup timeout to win, got %s", got)
+	}
+	if got := merged.StopTimeout(); got != 5*time.Second {
+		t.Fatalf("expected unset stop timeout to be inherited, got %s", got)
+	}
+}
+
+func TestDefaultsMergedDoesNotAliasOverride(t *testing.T) {
+	override := Defaults{StartupTimeoutSeconds: Int(3)}
+	merged := Defaults{}.Merged(override)
+	*override.StartupTimeoutSeconds = 9
+
+	if got := merged.StartupTimeout(); got != 3*time.Second {
+		t.Fatalf("expected merged value to be independent of override, got %s", got)
+	}
+}
+
+func TestEffectiveDefaultsKeepsExplicitZero(t *testing.T) {
+	cfg := &Config{Defaults: Defaults{StartupTimeoutSeconds: Int(0)}}
+
+	defaults := cfg.EffectiveDefaults()
+	if defaults.StartupTimeoutSeconds == nil || *defaults.StartupTimeoutSeconds != 0 {
+		t.Fatalf("expected explicit zero startup timeout, got %v", defaults.StartupTimeoutSeconds)
+	}
+	if got := defaults.StopTimeout(); got != 5*time.Second {
+		t.Fatalf("expected default stop timeout, got %s", got)
+	}
+}
+
+func TestLoadConfigExplicitZeroTimeout(t *testing.T) {
+	t.Setenv(strictConfigEnvVar, "")
+	path := writeConfigFile(t, "config.yml", `defaults:
+  startup_timeout_seconds: 0
+services: []
+`)
+
+	cfg, _, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if got := cfg.EffectiveDefaults().StartupTimeout(); got != 0 {
+		t.Fatalf("expected explicit zero from file, got %s", got)
+	}
+	if got := (&Config{}).EffectiveDefaults().StartupTimeout(); got != 15*time.Second {
+		t.Fatalf("expected default startup timeout when unset, got %s", got)
+	}
+}
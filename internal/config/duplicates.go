@@ -0,0 +1,167 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"go.yaml.in/yaml/v3"
+)
+
+// checkDuplicateKeys rejects config data in which a mapping defines the same
+// key twice, or the services list names a service twice. Keys are compared
+// case-insensitively because viper lowercases them: "dev" and "Dev" would
+// otherwise silently collapse into whichever comes last. JSON is parsed as
+// YAML, which it is a subset of.
+func checkDuplicateKeys(data []byte, configType string) error {
+	if configType == "toml" {
+		return checkDuplicateTOMLKeys(data)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		// Leave syntax errors to the real decode, which reports them better.
+		return nil
+	}
+	return walkDuplicateKeys(&root, "")
+}
+
+func walkDuplicateKeys(node *yaml.Node, path string) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := walkDuplicateKeys(child, path); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		seen := make(map[string]*yaml.Node, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			lower := strings.ToLower(key.Value)
+			if first, ok := seen[lower]; ok {
+				return fmt.Errorf("%s: key %q at line %d duplicates %q at line %d", keyPath(path, ""), key.Value, key.Line, first.Value, first.Line)
+			}
+			seen[lower] = key
+			if err := walkDuplicateKeys(value, keyPath(path, key.Value)); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		if path == "services" {
+			if err := checkDuplicateServices(node); err != nil {
+				return err
+			}
+		}
+		for i, item := range node.Content {
+			name := strconv.Itoa(i)
+			if n := mappingValue(item, "name"); n != nil && n.Value != "" {
+				name = n.Value
+			}
+			if err := walkDuplicateKeys(item, fmt.Sprintf("%s[%s]", path, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkDuplicateServices rejects two entries of the services list with the
+// same name, which a later config file would otherwise merge into one.
+func checkDuplicateServices(services *yaml.Node) error {
+	seen := make(map[string]*yaml.Node, len(services.Content))
+	for _, item := range services.Content {
+		name := mappingValue(item, "name")
+		if name == nil || strings.TrimSpace(name.Value) == "" {
+			continue
+		}
+		key := strings.TrimSpace(name.Value)
+		if first, ok := seen[key]; ok {
+			return fmt.Errorf("services[%s]: service at line %d duplicates the one at line %d", key, name.Line, first.Line)
+		}
+		seen[key] = name
+	}
+	return nil
+}
+
+// checkDuplicateTOMLKeys is checkDuplicateKeys for TOML. The parser already
+// rejects exact repeats, so only keys differing in case and repeated service
+// names are left to catch. TOML carries no line numbers past parsing.
+func checkDuplicateTOMLKeys(data []byte) error {
+	var root map[string]any
+	if err := toml.Unmarshal(data, &root); err != nil {
+		return nil
+	}
+	return walkDuplicateTOMLKeys(root, "")
+}
+
+func walkDuplicateTOMLKeys(value any, path string) error {
+	switch v := value.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		seen := make(map[string]string, len(keys))
+		for _, key := range keys {
+			lower := strings.ToLower(key)
+			if first, ok := seen[lower]; ok {
+				return fmt.Errorf("%s: key %q duplicates %q", keyPath(path, ""), key, first)
+			}
+			seen[lower] = key
+			if err := walkDuplicateTOMLKeys(v[key], keyPath(path, key)); err != nil {
+				return err
+			}
+		}
+	case []any:
+		seenServices := make(map[string]struct{}, len(v))
+		for i, item := range v {
+			name := strconv.Itoa(i)
+			if m, ok := item.(map[string]any); ok {
+				if n, ok := m["name"].(string); ok && strings.TrimSpace(n) != "" {
+					name = strings.TrimSpace(n)
+					if path == "services" {
+						if _, dup := seenServices[name]; dup {
+							return fmt.Errorf("services[%s]: service is listed more than once", name)
+						}
+						seenServices[name] = struct{}{}
+					}
+				}
+			}
+			if err := walkDuplicateTOMLKeys(item, fmt.Sprintf("%s[%s]", path, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value of key in a mapping node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if strings.EqualFold(node.Content[i].Value, key) {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func keyPath(path, key string) string {
+	switch {
+	case path == "":
+		if key == "" {
+			return "config"
+		}
+		return key
+	case key == "":
+		return path
+	default:
+		return path + "." + key
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"go.yaml.in/yaml/v3"
+)
+
+// restoreEnvKeyCase puts back the case of the variable names under
+// defaults.env and each env's env, which viper lower-cases like every other
+// key. Names are case-sensitive outside Windows, so http_proxy and
+// HTTP_PROXY must reach the aws process as written. data is the raw config
+// of kind ("yaml", "json" or "toml") that cfg was decoded from.
+func restoreEnvKeyCase(cfg *Config, data []byte, kind string) {
+	var raw map[string]any
+	var err error
+	if kind == "toml" {
+		err = toml.Unmarshal(data, &raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return
+	}
+
+	if defaults, ok := lookupFold(raw, "defaults").(map[string]any); ok {
+		cfg.Defaults.Env = restoreKeys(cfg.Defaults.Env, lookupFold(defaults, "env"))
+	}
+	services, _ := lookupFold(raw, "services").([]any)
+	for i, svc := range services {
+		if i >= len(cfg.Services) {
+			break
+		}
+		svcMap, _ := svc.(map[string]any)
+		envs, _ := lookupFold(svcMap, "envs").(map[string]any)
+		for name, env := range envs {
+			key := strings.ToLower(name)
+			envCfg, ok := cfg.Services[i].Envs[key]
+			if !ok {
+				continue
+			}
+			envMap, _ := env.(map[string]any)
+			envCfg.Env = restoreKeys(envCfg.Env, lookupFold(envMap, "env"))
+			cfg.Services[i].Envs[key] = envCfg
+		}
+	}
+}
+
+// lookupFold returns m's value for key, compared case-insensitively.
+func lookupFold(m map[string]any, key string) any {
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return nil
+}
+
+// restoreKeys returns env with each lower-cased name replaced by its
+// original spelling from raw.
+func restoreKeys(env map[string]string, raw any) map[string]string {
+	written, ok := raw.(map[string]any)
+	if !ok || len(env) == 0 {
+		return env
+	}
+	out := make(map[string]string, len(env))
+	for name, value := range env {
+		out[name] = value
+	}
+	for name := range written {
+		lower := strings.ToLower(name)
+		if value, ok := env[lower]; ok && name != lower {
+			delete(out, lower)
+			out[name] = value
+		}
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadEnvFile reads KEY=VALUE pairs from a dotenv file, as passed with
+// --env-file. Blank lines and # comments are skipped, an "export " prefix is
+// allowed and values may be wrapped in single or double quotes.
+func LoadEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("env file: %w", err)
+	}
+	defer f.Close()
+
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("env file %s:%d: expected KEY=VALUE", path, lineNo)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("env file %s: %w", path, err)
+	}
+	return vars, nil
+}
+
+// ApplyEnvFile lets an env file choose the AWS profile and region: AWS_PROFILE
+// and AWS_REGION (or AWS_DEFAULT_REGION) replace the configured defaults, and
+// static credentials (AWS_ACCESS_KEY_ID) without AWS_PROFILE clear the
+// configured profile so the aws CLI uses them instead.
+func ApplyEnvFile(cfg *Config, values map[string]string) {
+	if cfg == nil {
+		return
+	}
+
+	if profile, ok := values["AWS_PROFILE"]; ok {
+		cfg.Defaults.Profile = profile
+	} else if _, ok := values["AWS_ACCESS_KEY_ID"]; ok {
+		cfg.Defaults.Profile = ""
+	}
+	if region, ok := values["AWS_REGION"]; ok {
+		cfg.Defaults.Region = region
+	} else if region, ok := values["AWS_DEFAULT_REGION"]; ok {
+		cfg.Defaults.Region = region
+	}
+}
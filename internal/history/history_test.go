@@ -0,0 +1,44 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogAppendAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "history.jsonl")
+	log := NewLog(path)
+
+	if entries, err := log.Read(); err != nil || len(entries) != 0 {
+		t.Fatalf("expected empty history for missing file, got %v (%v)", entries, err)
+	}
+
+	if err := log.Append(Entry{Event: EventConnect, Key: "service1/dev", Endpoint: "127.0.0.1:5500"}); err != nil {
+		t.Fatalf("append connect: %v", err)
+	}
+	if err := log.Append(Entry{Event: EventStop, Key: "service1/dev"}); err != nil {
+		t.Fatalf("append stop: %v", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	_, _ = f.WriteString("not json\n")
+	_ = f.Close()
+
+	entries, err := log.Read()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Event != EventConnect || entries[0].Endpoint != "127.0.0.1:5500" || entries[0].Time.IsZero() {
+		t.Fatalf("unexpected first entry: %+v", entries[0])
+	}
+	if entries[1].Event != EventStop {
+		t.Fatalf("unexpected second entry: %+v", entries[1])
+	}
+}
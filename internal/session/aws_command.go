@@ -2,9 +2,27 @@ package session
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 )
 
+// openedPortPattern matches the plugin's "Port 54321 opened for sessionId ..."
+// line, which names the local port it listens on.
+var openedPortPattern = regexp.MustCompile(`\bPort (\d+) opened for session`)
+
+// openedPort extracts the local port from a plugin "Port N opened" line.
+func openedPort(line string) (int, bool) {
+	match := openedPortPattern.FindStringSubmatch(line)
+	if match == nil {
+		return 0, false
+	}
+	port, err := strconv.Atoi(match[1])
+	if err != nil || port < 1 || port > 65535 {
+		return 0, false
+	}
+	return port, true
+}
+
 // BuildSSMPortForwardArgs builds args for:
 // aws ssm start-session --document-name AWS-StartPortForwardingSessionToRemoteHost
 func BuildSSMPortForwardArgs(targetInstanceID, remoteHost string, remotePort, localPort int, region, profile string) []string {
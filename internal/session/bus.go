@@ -0,0 +1,133 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// broadcaster fans values out to subscriber channels. Each subscriber has its
+// own buffer and DropPolicy, so a slow one holds publish up for at most
+// subscriberBlockTimeout. The zero value is ready to use. Once closed, every
+// channel is closed and new subscribers get an already-closed channel.
+type broadcaster[T any] struct {
+	mu     sync.Mutex
+	subs   map[uint64]*subscriber[T]
+	nextID uint64
+	closed bool
+}
+
+type subscriber[T any] struct {
+	ch      chan T
+	policy  DropPolicy
+	dropped uint64
+}
+
+// subscribe registers a channel that first holds replay, then up to buffer
+// further values. Replay and registration happen under one lock, so nothing
+// published meanwhile is missed or repeated.
+func (b *broadcaster[T]) subscribe(replay []T, buffer int, policy DropPolicy) (uint64, <-chan T) {
+	if buffer < 0 {
+		buffer = 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		ch := make(chan T)
+		close(ch)
+		return 0, ch
+	}
+
+	ch := make(chan T, len(replay)+buffer)
+	for _, v := range replay {
+		ch <- v
+	}
+	if b.subs == nil {
+		b.subs = make(map[uint64]*subscriber[T])
+	}
+	b.nextID++
+	b.subs[b.nextID] = &subscriber[T]{ch: ch, policy: policy}
+	return b.nextID, ch
+}
+
+// publish delivers v to every subscriber according to its policy.
+func (b *broadcaster[T]) publish(v T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, sub := range b.subs {
+		sub.send(v)
+	}
+}
+
+// unsubscribe closes and forgets subscriber id; unknown ids are ignored.
+func (b *broadcaster[T]) unsubscribe(id uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub, ok := b.subs[id]
+	if !ok {
+		return
+	}
+	delete(b.subs, id)
+	close(sub.ch)
+}
+
+// stats returns the counters of subscriber id. The bool is false when id is
+// not an active subscriber.
+func (b *broadcaster[T]) stats(id uint64) (SubscriberStats, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub, ok := b.subs[id]
+	if !ok {
+		return SubscriberStats{}, false
+	}
+	return SubscriberStats{Dropped: sub.dropped}, true
+}
+
+// close closes every subscriber channel and rejects new subscribers.
+func (b *broadcaster[T]) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for id, sub := range b.subs {
+		delete(b.subs, id)
+		close(sub.ch)
+	}
+}
+
+// send delivers v according to the subscriber's policy, counting drops.
+func (sub *subscriber[T]) send(v T) {
+	select {
+	case sub.ch <- v:
+		return
+	default:
+	}
+
+	switch sub.policy {
+	case DropOldest:
+		select {
+		case <-sub.ch:
+			sub.dropped++
+		default:
+		}
+		select {
+		case sub.ch <- v:
+		default:
+			sub.dropped++
+		}
+	case Block:
+		timer := time.NewTimer(subscriberBlockTimeout)
+		defer timer.Stop()
+		select {
+		case sub.ch <- v:
+		case <-timer.C:
+			sub.dropped++
+		}
+	default:
+		sub.dropped++
+	}
+}
@@ -0,0 +1,65 @@
+//go:build linux
+
+package session
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// tcpStateEstablished is the st column value of an established socket in
+// /proc/net/tcp.
+const tcpStateEstablished = "01"
+
+// activeConnections counts established TCP connections whose local port is
+// port, from /proc/net/tcp and /proc/net/tcp6.
+func activeConnections(bind string, port int) (int, error) {
+	total := 0
+	found := false
+	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		n, err := countEstablished(path, port)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		found = true
+		total += n
+	}
+	if !found {
+		return 0, fmt.Errorf("no /proc/net/tcp table available")
+	}
+	return total, nil
+}
+
+func countEstablished(path string, port int) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[3] != tcpStateEstablished {
+			continue
+		}
+		_, hexPort, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		local, err := strconv.ParseUint(hexPort, 16, 16)
+		if err == nil && int(local) == port {
+			count++
+		}
+	}
+	return count, scanner.Err()
+}
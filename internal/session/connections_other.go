@@ -0,0 +1,12 @@
+//go:build !linux
+
+package session
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func activeConnections(bind string, port int) (int, error) {
+	return 0, fmt.Errorf("connection counting is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,117 @@
+package session
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventType names a session lifecycle transition. Its value is what webhooks
+// send as "event", so the ready event keeps its original "connect".
+type EventType string
+
+const (
+	// EventSessionStarted reports that the aws process was spawned;
+	// EventSessionReady follows once the session passed readiness.
+	EventSessionStarted EventType = "started"
+	EventSessionReady   EventType = "connect"
+	EventSessionStopped EventType = "stop"
+	EventSessionError   EventType = "error"
+	// EventLogLine carries one session log line in Log.
+	EventLogLine EventType = "log"
+)
+
+// Event describes one lifecycle transition or log line. The event handler
+// only receives EventSessionReady, EventSessionStopped and EventSessionError;
+// subscribers receive every type.
+type Event struct {
+	Type     EventType
+	Time     time.Time
+	Key      SessionKey
+	Service  string
+	Env      string
+	Endpoint string
+	Error    string
+	Log      LogEntry
+}
+
+// EventHandler receives lifecycle events. It is called synchronously from the
+// transition, outside the manager lock, so it must not block. Unlike
+// subscribers it never misses an event, which is why webhooks use it.
+type EventHandler func(Event)
+
+// SetEventHandler registers fn to receive lifecycle events; nil disables them.
+func (m *Manager) SetEventHandler(fn EventHandler) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onEvent = fn
+}
+
+// Subscribe returns a channel receiving every event from now on. Unlike the
+// event handler, any number of subscribers can observe the manager. Events
+// are published from under session and manager locks, so delivery never
+// waits: once the buffer is full the oldest event is dropped, counted in
+// EventStats. Close closes the channels of remaining subscribers.
+func (m *Manager) Subscribe(buffer int) (uint64, <-chan Event) {
+	if m == nil {
+		ch := make(chan Event)
+		close(ch)
+		return 0, ch
+	}
+	return m.events.subscribe(nil, buffer, DropOldest)
+}
+
+// EventStats returns the counters of event subscriber id. The bool is false
+// when id is not an active subscriber.
+func (m *Manager) EventStats(id uint64) (SubscriberStats, bool) {
+	if m == nil {
+		return SubscriberStats{}, false
+	}
+	return m.events.stats(id)
+}
+
+// Unsubscribe closes and forgets subscriber id.
+func (m *Manager) Unsubscribe(id uint64) {
+	if m == nil {
+		return
+	}
+	m.events.unsubscribe(id)
+}
+
+// emit publishes e to subscribers and passes it to the event handler, if any.
+func (m *Manager) emit(e Event) {
+	e = m.publish(e)
+
+	m.mu.RLock()
+	fn := m.onEvent
+	m.mu.RUnlock()
+	if fn != nil {
+		fn(e)
+	}
+}
+
+// publish stamps e and sends it to subscribers only.
+func (m *Manager) publish(e Event) Event {
+	e.Time = time.Now()
+	m.events.publish(e)
+	return e
+}
+
+func sessionEvent(eventType EventType, s SessionSnapshot, err error) Event {
+	e := Event{
+		Type:    eventType,
+		Key:     s.Key,
+		Service: s.Service,
+		Env:     s.Env,
+	}
+	if s.LocalPort > 0 {
+		e.Endpoint = fmt.Sprintf("%s:%d", s.Bind, s.LocalPort)
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
@@ -0,0 +1,54 @@
+package session
+
+import (
+	"context"
+	"os/exec"
+	"sort"
+)
+
+// Executor builds the command for a session's aws process. The default runs
+// the real aws CLI; tests can substitute a simulator such as
+// sessiontest.FakeExecutor.
+type Executor interface {
+	Command(ctx context.Context, name string, args ...string) *exec.Cmd
+}
+
+// ExecutorFunc adapts a function to the Executor interface.
+type ExecutorFunc func(ctx context.Context, name string, args ...string) *exec.Cmd
+
+// Command calls f(ctx, name, args...).
+func (f ExecutorFunc) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	return f(ctx, name, args...)
+}
+
+// SetExecutor replaces the executor used by later Start calls; nil restores
+// the default.
+func (m *Manager) SetExecutor(e Executor) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.executor = e
+}
+
+func (m *Manager) command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	m.mu.RLock()
+	e := m.executor
+	m.mu.RUnlock()
+	if e != nil {
+		return e.Command(ctx, name, args...)
+	}
+	return execCommandContext(ctx, name, args...)
+}
+
+// processEnv renders env as sorted KEY=VALUE pairs for exec.Cmd.Env.
+func processEnv(env map[string]string) []string {
+	out := make([]string, 0, len(env))
+	for key, value := range env {
+		out = append(out, key+"="+value)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,41 @@
+package session
+
+import "time"
+
+var (
+	// healthProbeInterval is how often a running session's local port is
+	// dialed to refresh LastHealthyAt.
+	healthProbeInterval = 15 * time.Second
+	healthProbeTimeout  = 2 * time.Second
+)
+
+// watchHealth probes the session's local endpoint until done is closed,
+// recording the time of each successful probe. Ticks while an SSM-assigned
+// port is still unknown are skipped.
+func (m *Manager) watchHealth(s *Session, done <-chan struct{}) {
+	defer m.workers.Done()
+
+	ticker := time.NewTicker(healthProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			bind, port := m.endpointOf(s)
+			if port == 0 {
+				continue
+			}
+			s.healthProbing.Store(true)
+			err := waitForPortFn(bind, port, healthProbeTimeout)
+			s.healthProbing.Store(false)
+			if err != nil {
+				continue
+			}
+			m.mu.Lock()
+			s.LastHealthyAt = time.Now()
+			m.mu.Unlock()
+		}
+	}
+}
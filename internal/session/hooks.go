@@ -0,0 +1,58 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// hookTimeout bounds a hook run; pre-connect hooks such as `aws sso login`
+// may wait on the user, so it is generous.
+var hookTimeout = 5 * time.Minute
+
+// hookWaitDelay bounds how long a timed-out hook may keep its output pipe
+// open, e.g. through a child it left in the background.
+const hookWaitDelay = 2 * time.Second
+
+var hookCommandContext = exec.CommandContext
+
+// runHook runs script through the platform shell and appends its combined
+// output to the session log, each line prefixed with [name].
+func (m *Manager) runHook(s *Session, name, script string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = hookCommandContext(ctx, "cmd", "/C", script)
+	} else {
+		cmd = hookCommandContext(ctx, "sh", "-c", script)
+	}
+	configureHookForPlatform(cmd)
+	cmd.WaitDelay = hookWaitDelay
+	cmd.Env = append(os.Environ(),
+		"DBX_SERVICE="+s.Service,
+		"DBX_ENV="+s.Env,
+		"DBX_BIND="+s.Bind,
+		"DBX_LOCAL_PORT="+strconv.Itoa(s.LocalPort),
+		"DBX_PROFILE="+s.Profile,
+		"DBX_REGION="+s.Region,
+	)
+
+	s.AppendLog(fmt.Sprintf("[%s] running", name))
+	out, err := cmd.CombinedOutput()
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		s.AppendLog(fmt.Sprintf("[%s] %s", name, scanner.Text()))
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package session
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	// idleCheckInterval is how often an idle-timeout session polls its port.
+	idleCheckInterval   = 10 * time.Second
+	activeConnectionsFn = activeConnections
+)
+
+// watchIdle stops the session once its local port has had no established
+// connections for timeout. It returns when done is closed. If connections
+// cannot be counted on this platform the timeout is disabled with a log line.
+// Ticks while an SSM-assigned port is still unknown are skipped, and a health
+// probe in flight is not counted as a connection.
+func (m *Manager) watchIdle(key SessionKey, s *Session, done <-chan struct{}, timeout time.Duration) {
+	defer m.workers.Done()
+
+	ticker := time.NewTicker(min(idleCheckInterval, timeout))
+	defer ticker.Stop()
+
+	lastActive := time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			bind, port := m.endpointOf(s)
+			if port == 0 {
+				lastActive = now
+				continue
+			}
+			n, err := activeConnectionsFn(bind, port)
+			if err != nil {
+				s.AppendLog(fmt.Sprintf("idle timeout disabled: %v", err))
+				return
+			}
+			if n > 0 && s.healthProbing.Load() {
+				n--
+			}
+			if n > 0 {
+				lastActive = now
+				continue
+			}
+			if now.Sub(lastActive) < timeout {
+				continue
+			}
+			s.AppendLog(fmt.Sprintf("stopped: idle for %s with no connections", timeout))
+			if err := m.Stop(key); err != nil {
+				s.AppendLog(fmt.Sprintf("idle stop failed: %v", err))
+			}
+			return
+		}
+	}
+}
@@ -3,14 +3,41 @@ package session
 import (
 	"fmt"
 	"sync"
+	"time"
 )
 
 const DefaultRingBufferLines = 500
 
+// LogSource is the stream a log line was read from.
+type LogSource string
+
+const (
+	// LogSourceDBX marks lines dbx writes itself: readiness, hooks, exits.
+	LogSourceDBX    LogSource = ""
+	LogSourceStdout LogSource = "out"
+	LogSourceStderr LogSource = "err"
+)
+
+// LogEntry is one stored log line with its source and when it was logged.
+type LogEntry struct {
+	Time   time.Time
+	Source LogSource
+	Line   string
+}
+
+// String renders the entry with its source: aws output is tagged [out] or
+// [err], dbx's own lines are left as they are.
+func (e LogEntry) String() string {
+	if e.Source == LogSourceDBX {
+		return e.Line
+	}
+	return "[" + string(e.Source) + "] " + e.Line
+}
+
 // RingBuffer stores log lines in a fixed-size circular buffer.
 type RingBuffer struct {
 	mu    sync.RWMutex
-	buf   []string
+	buf   []LogEntry
 	head  int
 	count int
 }
@@ -21,11 +48,16 @@ func NewRingBuffer(capacity int) *RingBuffer {
 		capacity = DefaultRingBufferLines
 	}
 
-	return &RingBuffer{buf: make([]string, capacity)}
+	return &RingBuffer{buf: make([]LogEntry, capacity)}
 }
 
-// Append stores one line, evicting the oldest line when full.
+// Append stores one dbx line, evicting the oldest line when full.
 func (r *RingBuffer) Append(line string) {
+	r.AppendEntry(LogEntry{Time: time.Now(), Line: line})
+}
+
+// AppendEntry stores one entry, evicting the oldest entry when full.
+func (r *RingBuffer) AppendEntry(entry LogEntry) {
 	if r == nil {
 		return
 	}
@@ -37,15 +69,29 @@ func (r *RingBuffer) Append(line string) {
 		return
 	}
 
-	r.buf[r.head] = line
+	r.buf[r.head] = entry
 	r.head = (r.head + 1) % len(r.buf)
 	if r.count < len(r.buf) {
 		r.count++
 	}
 }
 
-// Last returns the last n lines ordered from oldest to newest.
+// Last returns the last n lines ordered from oldest to newest, without their
+// sources.
 func (r *RingBuffer) Last(n int) []string {
+	entries := r.LastEntries(n)
+	if entries == nil {
+		return nil
+	}
+	out := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		out = append(out, entry.Line)
+	}
+	return out
+}
+
+// LastEntries returns the last n entries ordered from oldest to newest.
+func (r *RingBuffer) LastEntries(n int) []LogEntry {
 	if r == nil || n <= 0 {
 		return nil
 	}
@@ -61,7 +107,7 @@ func (r *RingBuffer) Last(n int) []string {
 	}
 
 	start := (r.head - n + len(r.buf)) % len(r.buf)
-	out := make([]string, 0, n)
+	out := make([]LogEntry, 0, n)
 	for i := 0; i < n; i++ {
 		idx := (start + i) % len(r.buf)
 		out = append(out, r.buf[idx])
@@ -70,8 +116,8 @@ func (r *RingBuffer) Last(n int) []string {
 	return out
 }
 
-// LastLogs returns the last n log lines for a session key.
-func (m *Manager) LastLogs(key SessionKey, n int) ([]string, error) {
+// LastLogs returns the last n log entries for a session key.
+func (m *Manager) LastLogs(key SessionKey, n int) ([]LogEntry, error) {
 	if m == nil {
 		return nil, fmt.Errorf("manager is nil")
 	}
@@ -83,11 +129,29 @@ func (m *Manager) LastLogs(key SessionKey, n int) ([]string, error) {
 		return nil, fmt.Errorf("%s: session not found", key)
 	}
 
-	return s.LastLogs(n), nil
+	return s.LastLogEntries(n), nil
 }
 
 // SubscribeLogs subscribes to streaming logs for the given session key.
-func (m *Manager) SubscribeLogs(key SessionKey, buffer int) (uint64, <-chan string, error) {
+func (m *Manager) SubscribeLogs(key SessionKey, buffer int, policy DropPolicy) (uint64, <-chan LogEntry, error) {
+	if m == nil {
+		return 0, nil, fmt.Errorf("manager is nil")
+	}
+
+	m.mu.RLock()
+	s, ok := m.sessions[key]
+	m.mu.RUnlock()
+	if !ok || s == nil {
+		return 0, nil, fmt.Errorf("%s: session not found", key)
+	}
+
+	id, ch := s.SubscribeLogs(buffer, policy)
+	return id, ch, nil
+}
+
+// SubscribeLogsWithReplay subscribes to streaming logs for key, starting with
+// its last n buffered lines. See Session.SubscribeLogsWithReplay.
+func (m *Manager) SubscribeLogsWithReplay(key SessionKey, n, buffer int, policy DropPolicy) (uint64, <-chan LogEntry, error) {
 	if m == nil {
 		return 0, nil, fmt.Errorf("manager is nil")
 	}
@@ -99,7 +163,7 @@ func (m *Manager) SubscribeLogs(key SessionKey, buffer int) (uint64, <-chan stri
 		return 0, nil, fmt.Errorf("%s: session not found", key)
 	}
 
-	id, ch := s.SubscribeLogs(buffer)
+	id, ch := s.SubscribeLogsWithReplay(n, buffer, policy)
 	return id, ch, nil
 }
 
@@ -118,3 +182,23 @@ func (m *Manager) UnsubscribeLogs(key SessionKey, id uint64) {
 
 	s.UnsubscribeLogs(id)
 }
+
+// SubscriberStats returns delivery counters for a log subscription.
+func (m *Manager) SubscriberStats(key SessionKey, id uint64) (SubscriberStats, error) {
+	if m == nil {
+		return SubscriberStats{}, fmt.Errorf("manager is nil")
+	}
+
+	m.mu.RLock()
+	s, ok := m.sessions[key]
+	m.mu.RUnlock()
+	if !ok || s == nil {
+		return SubscriberStats{}, fmt.Errorf("%s: session not found", key)
+	}
+
+	stats, ok := s.SubscriberStats(id)
+	if !ok {
+		return SubscriberStats{}, fmt.Errorf("%s: subscriber %d not found", key, id)
+	}
+	return stats, nil
+}
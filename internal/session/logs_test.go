@@ -1,8 +1,12 @@
 package session
 
 import (
+	"context"
+	"os/exec"
 	"reflect"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func TestRingBufferLast(t *testing.T) {
@@ -33,3 +37,119 @@ func TestRingBufferLastBounds(t *testing.T) {
 		t.Fatalf("Last(0) = %v, want nil", gotNil)
 	}
 }
+
+func TestSessionLogsKeepSource(t *testing.T) {
+	s := NewSession("service1", "dev")
+	_, ch := s.SubscribeLogs(4, DropNewest)
+	s.AppendLogFrom(LogSourceStdout, "Starting session")
+	s.AppendLogFrom(LogSourceStderr, "An error occurred")
+	s.AppendLog("readiness: ready")
+
+	want := []LogEntry{
+		{Source: LogSourceStdout, Line: "Starting session"},
+		{Source: LogSourceStderr, Line: "An error occurred"},
+		{Source: LogSourceDBX, Line: "readiness: ready"},
+	}
+	withoutTime := func(entries []LogEntry) []LogEntry {
+		for i := range entries {
+			if entries[i].Time.IsZero() {
+				t.Fatalf("expected entry %d to be timestamped", i)
+			}
+			entries[i].Time = time.Time{}
+		}
+		return entries
+	}
+	if got := withoutTime(s.LastLogEntries(3)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("LastLogEntries(3) = %v, want %v", got, want)
+	}
+	if got := withoutTime([]LogEntry{<-ch, <-ch, <-ch}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("subscriber got %v, want %v", got, want)
+	}
+	if got := s.LastLogs(3); !reflect.DeepEqual(got, []string{"Starting session", "An error occurred", "readiness: ready"}) {
+		t.Fatalf("expected plain lines, got %v", got)
+	}
+	var tagged []string
+	for _, entry := range want {
+		tagged = append(tagged, entry.String())
+	}
+	if !reflect.DeepEqual(tagged, []string{"[out] Starting session", "[err] An error occurred", "readiness: ready"}) {
+		t.Fatalf("unexpected rendering %v", tagged)
+	}
+}
+
+func TestSubscribeLogsWithReplayHasNoGapOrDuplicate(t *testing.T) {
+	s := NewSession("service1", "dev")
+	const total = 2000
+
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < total; i++ {
+			if i == total/4 {
+				close(started)
+			}
+			s.AppendLog(strconv.Itoa(i))
+		}
+	}()
+
+	<-started
+	_, ch := s.SubscribeLogsWithReplay(10, total, Block)
+	<-done
+	s.CloseLogSubscribers()
+
+	var got []int
+	for entry := range ch {
+		n, err := strconv.Atoi(entry.Line)
+		if err != nil {
+			t.Fatalf("unexpected line %q", entry.Line)
+		}
+		got = append(got, n)
+	}
+	if len(got) == 0 || got[len(got)-1] != total-1 {
+		t.Fatalf("expected stream to end at %d, got %v", total-1, got)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i] != got[i-1]+1 {
+			t.Fatalf("expected contiguous lines, got %d after %d", got[i], got[i-1])
+		}
+	}
+	if len(got) < 10 {
+		t.Fatalf("expected at least the 10 replayed lines, got %d", len(got))
+	}
+}
+
+func TestProcessExitDoesNotHoldManagerForBlockedSubscriber(t *testing.T) {
+	withManagerTestSeams(t, func(ctx context.Context, _ string, _ ...string) *exec.Cmd {
+		return exec.CommandContext(ctx, "sh", "-c", "sleep 0.1; echo first; sleep 0.3")
+	})
+
+	m := NewManager()
+	m.defaultStopWait = 2 * time.Second
+	t.Cleanup(func() { _ = m.Close() })
+	key := NewSessionKey("service1", "dev")
+	if _, err := m.Start(startOpts("service1", "dev", 5596)); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	// A Block subscriber that never reads: "first" fills its buffer, so the
+	// exit line waits out subscriberBlockTimeout.
+	id, _, err := m.SubscribeLogs(key, 1, Block)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer m.UnsubscribeLogs(key, id)
+
+	var slowest time.Duration
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		began := time.Now()
+		sessions := m.List()
+		slowest = max(slowest, time.Since(began))
+		if len(sessions) == 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if slowest >= subscriberBlockTimeout/2 {
+		t.Fatalf("expected List to stay responsive while the exit line waits on a subscriber, slowest call took %s", slowest)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"os/exec"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
@@ -19,13 +21,56 @@ const (
 	defaultStartupTimeout = 15 * time.Second
 	defaultStopTimeout    = 5 * time.Second
 	logTailLinesOnError   = 20
+
+	// Ended sessions stay visible to RecentlyStopped (dbx ls --all) for a
+	// while so it is clear why they went away.
+	recentlyStoppedTTL   = 10 * time.Minute
+	recentlyStoppedLimit = 20
+
+	// closeKillWait is how long CloseContext still waits, once it killed
+	// the sessions left at its deadline, for their abandoned Stop calls and
+	// goroutines to notice.
+	closeKillWait = 2 * time.Second
+
+	pluginMissingSignature = "SessionManagerPlugin is not found"
+	pluginInstallURL       = "https://docs.aws.amazon.com/systems-manager/latest/userguide/session-manager-working-with-install-plugin.html"
 )
 
 var (
 	errSessionNotFound = errors.New("session not found")
+
+	// ErrManagerClosed is returned by Start once Close or CloseContext began.
+	ErrManagerClosed = errors.New("manager is closed")
+
+	// ErrPluginMissing is returned by Start when the aws CLI reports that the
+	// Session Manager plugin is not installed.
+	ErrPluginMissing   = errors.New("session-manager-plugin is not installed")
 	execCommandContext = exec.CommandContext
 	waitForPortFn      = WaitForPort
 	portAvailableFn    = ValidatePortAvailable
+	shufflePortsFn     = rand.Shuffle
+)
+
+// PortStrategy controls the order in which range ports are tried.
+type PortStrategy string
+
+const (
+	// PortStrategySequential tries ports from min upward (the default).
+	PortStrategySequential PortStrategy = "sequential"
+	// PortStrategyRandom tries ports in random order, so concurrent starts
+	// are less likely to race for the same port.
+	PortStrategyRandom PortStrategy = "random"
+)
+
+// StopSignal selects the signal a graceful stop sends to the aws process
+// group before the kill fallback.
+type StopSignal string
+
+const (
+	// StopSignalInt sends SIGINT (the default).
+	StopSignalInt StopSignal = "int"
+	// StopSignalTerm sends SIGTERM, for wrappers that ignore SIGINT.
+	StopSignalTerm StopSignal = "term"
 )
 
 // StartOptions contains the parameters required to start one session.
@@ -42,6 +87,64 @@ type StartOptions struct {
 	Region           string
 	Profile          string
 	StartupTimeout   time.Duration
+	// TargetTag ("Key=Value"), when TargetInstanceID is empty, resolves the
+	// target to the one online SSM instance carrying that tag.
+	TargetTag string
+	// TargetCacheTTL is how long a TargetTag lookup is reused; 0 looks it
+	// up on every start. RefreshTarget skips the cached lookup and stores a
+	// fresh one.
+	TargetCacheTTL time.Duration
+	RefreshTarget  bool
+	// SSMAssignedPort, when LocalPort is 0, passes localPortNumber 0 so the
+	// plugin picks the port, and records the port from its "Port N opened"
+	// output instead of allocating from PortMin-PortMax.
+	SSMAssignedPort bool
+	// ReadinessPollInterval is how long each readiness attempt waits for the
+	// port; 0 uses defaultReadinessPollInterval.
+	ReadinessPollInterval time.Duration
+	// ReadinessRetries caps the number of readiness attempts; 0 keeps trying
+	// until StartupTimeout.
+	ReadinessRetries int
+	// SkipReadiness marks the session running as soon as the process starts,
+	// without waiting for the local port to accept connections.
+	SkipReadiness bool
+	// ReadyBanner, when set, also requires a log line matching it before the
+	// session counts as ready. BannerOnly drops the TCP check in that case.
+	ReadyBanner *regexp.Regexp
+	BannerOnly  bool
+	// NoPortReuse ignores LocalPort and always allocates from the port range.
+	NoPortReuse bool
+	// PortStrategy picks the allocation order; empty means sequential.
+	PortStrategy PortStrategy
+	// PreConnectHook runs before the aws process starts and must succeed;
+	// PostStopHook runs after Stop ends the process. Both are shell commands.
+	PreConnectHook string
+	PostStopHook   string
+	// RedactLogs masks access keys, secrets and bearer tokens (see Redact)
+	// in the session log, the live log tap and LastError.
+	RedactLogs bool
+	// CommandWrapper is prepended to the aws argv, e.g. ["aws-vault",
+	// "exec", "myprofile", "--"]; its first element is the command run.
+	CommandWrapper []string
+	// StopSignal is sent on a graceful stop; empty means StopSignalInt.
+	StopSignal StopSignal
+	// ProcessEnv is merged into the aws process environment on top of dbx's
+	// own (e.g. AWS_CA_BUNDLE, or --env-file credentials); dbx's environment
+	// is unchanged.
+	ProcessEnv map[string]string
+	// LogTap, when set, receives every captured log line while Start runs,
+	// e.g. to echo aws output live. It is detached from the session this call
+	// started before Start returns; a failed Start leaves other taps alone.
+	LogTap func(line string)
+	// IdleTimeout, when positive, stops the session after its local port has
+	// had no established connections for that long.
+	IdleTimeout time.Duration
+	// TTL, when positive, stops the session that long after it started,
+	// regardless of activity.
+	TTL time.Duration
+	// ReuseExisting makes Start return the running session for the same
+	// service/env instead of failing with "session already exists".
+	ReuseExisting bool
 }
 
 // SessionSummary is a read-only snapshot used by list output.
@@ -56,6 +159,32 @@ type SessionSummary struct {
 	StartTime time.Time
 	Uptime    time.Duration
 	LastError string
+
+	Reconnects    int
+	LastReconnect time.Time
+
+	// StopRequestedAt is when Stop began; StoppingFor is the time since then
+	// while the session is stopping. After StopTimeout the process is killed.
+	StopRequestedAt time.Time
+	StoppingFor     time.Duration
+	StopTimeout     time.Duration
+
+	// ExpiresAt is when the session TTL stops it; zero without a TTL.
+	// TTLRemaining is the time left until then.
+	ExpiresAt    time.Time
+	TTLRemaining time.Duration
+
+	// StoppedAt is when a session from RecentlyStopped ended; zero for
+	// sessions from List.
+	StoppedAt time.Time
+
+	// LastHealthyAt is when the local endpoint last accepted a TCP probe;
+	// zero until the first success.
+	LastHealthyAt time.Time
+
+	// StartupLatency is how long the session took to become ready; zero
+	// when readiness was skipped.
+	StartupLatency time.Duration
 }
 
 // Manager tracks active forwarding sessions and their lifecycle.
@@ -63,6 +192,26 @@ type Manager struct {
 	mu sync.RWMutex
 
 	sessions map[SessionKey]*Session
+	starts   map[SessionKey]int
+	// recentlyStopped holds summaries of ended sessions, oldest first, for
+	// recentlyStoppedTTL and at most recentlyStoppedLimit of them.
+	recentlyStopped []SessionSummary
+	closed          bool
+	workers         sync.WaitGroup
+	// stops counts the Stop calls of stopAllContext, which may outlive it.
+	stops sync.WaitGroup
+	// stopping holds the in-flight stop of each key until it returns, even
+	// after the exited session was removed from sessions.
+	stopping map[SessionKey]*stopCall
+
+	closeOnce sync.Once
+	closeErr  error
+
+	onEvent  EventHandler
+	events   broadcaster[Event]
+	executor Executor
+	// targets caches TargetTag lookups.
+	targets targetCache
 
 	defaultPortMin   int
 	defaultPortMax   int
@@ -73,6 +222,8 @@ type Manager struct {
 func NewManager() *Manager {
 	return &Manager{
 		sessions:         make(map[SessionKey]*Session),
+		starts:           make(map[SessionKey]int),
+		stopping:         make(map[SessionKey]*stopCall),
 		defaultPortMin:   defaultPortRangeMin,
 		defaultPortMax:   defaultPortRangeMax,
 		defaultStartWait: defaultStartupTimeout,
@@ -80,20 +231,47 @@ func NewManager() *Manager {
 	}
 }
 
-// Start creates and starts an aws ssm start-session process.
-func (m *Manager) Start(opts StartOptions) (*Session, error) {
+// Start creates and starts an aws ssm start-session process and returns a
+// snapshot of the started session.
+func (m *Manager) Start(opts StartOptions) (SessionSnapshot, error) {
 	if m == nil {
-		return nil, errors.New("manager is nil")
+		return SessionSnapshot{}, errors.New("manager is nil")
+	}
+
+	s, reused, err := m.start(opts)
+	if reused {
+		s.Reused = true
+		return s, nil
 	}
+	if err != nil {
+		if opts.Service != "" && opts.Env != "" {
+			m.emit(Event{
+				Type:    EventSessionError,
+				Key:     NewSessionKey(opts.Service, opts.Env),
+				Service: opts.Service,
+				Env:     opts.Env,
+				Error:   err.Error(),
+			})
+		}
+		return SessionSnapshot{}, err
+	}
+	m.emit(sessionEvent(EventSessionReady, s, nil))
+	return s, nil
+}
+
+// start reports reused when opts.ReuseExisting returned an already running
+// session, so Start does not announce it as a new connect.
+func (m *Manager) start(opts StartOptions) (SessionSnapshot, bool, error) {
 	if opts.Service == "" || opts.Env == "" {
-		return nil, errors.New("service and env are required")
+		return SessionSnapshot{}, false, errors.New("service and env are required")
 	}
-	if opts.TargetInstanceID == "" || opts.RemoteHost == "" || opts.RemotePort == 0 {
-		return nil, errors.New("target_instance_id, remote_host and remote_port are required")
+	if (opts.TargetInstanceID == "" && opts.TargetTag == "") || opts.RemoteHost == "" || opts.RemotePort == 0 {
+		return SessionSnapshot{}, false, errors.New("target_instance_id (or target_tag), remote_host and remote_port are required")
 	}
 	if opts.Bind == "" {
 		opts.Bind = "127.0.0.1"
 	}
+	opts.Bind = normalizeBind(opts.Bind)
 	if opts.StartupTimeout <= 0 {
 		opts.StartupTimeout = m.defaultStartWait
 	}
@@ -101,19 +279,33 @@ func (m *Manager) Start(opts StartOptions) (*Session, error) {
 	key := NewSessionKey(opts.Service, opts.Env)
 
 	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return SessionSnapshot{}, false, fmt.Errorf("%s: %w", key, ErrManagerClosed)
+	}
 	if existing, exists := m.sessions[key]; exists {
-		if existing == nil || existing.State == SessionStateStopped {
+		switch {
+		case existing == nil || existing.State == SessionStateStopped:
 			delete(m.sessions, key)
-		} else {
+		case opts.ReuseExisting && existing.State == SessionStateRunning:
+			out := m.snapshotLocked(key)
 			m.mu.Unlock()
-			return nil, fmt.Errorf("%s: session already exists", key)
+			return out, true, nil
+		default:
+			m.mu.Unlock()
+			return SessionSnapshot{}, false, fmt.Errorf("%s: session already exists", key)
 		}
 	}
 
-	port, err := m.selectPortLocked(opts)
-	if err != nil {
-		m.mu.Unlock()
-		return nil, fmt.Errorf("%s: failed to allocate local port: %w", key, err)
+	port := 0
+	ssmPort := opts.SSMAssignedPort && opts.LocalPort == 0
+	if !ssmPort {
+		var err error
+		port, err = m.selectPortLocked(opts)
+		if err != nil {
+			m.mu.Unlock()
+			return SessionSnapshot{}, false, fmt.Errorf("%s: failed to allocate local port: %w", key, err)
+		}
 	}
 
 	s := NewSession(opts.Service, opts.Env)
@@ -126,8 +318,58 @@ func (m *Manager) Start(opts StartOptions) (*Session, error) {
 	s.Profile = opts.Profile
 	s.StartTime = time.Now()
 	s.State = SessionStateStarting
+	if opts.TTL > 0 {
+		s.ExpiresAt = s.StartTime.Add(opts.TTL)
+	}
+	s.readyBanner = opts.ReadyBanner
+	s.redactLogs = opts.RedactLogs
+	s.onLog = func(entry LogEntry) {
+		m.publish(Event{Type: EventLogLine, Key: key, Service: opts.Service, Env: opts.Env, Log: entry})
+	}
+	s.stopSignal = opts.StopSignal
+	s.awaitingPort = ssmPort
+	s.postStopHook = opts.PostStopHook
+	s.logTap = opts.LogTap
+	s.done = make(chan struct{})
+	if prev := m.starts[key]; prev > 0 {
+		s.Reconnects = prev
+		s.LastReconnect = s.StartTime
+	}
 	m.sessions[key] = s
 	m.mu.Unlock()
+	if opts.LogTap != nil {
+		// Detach from this session only: by the time start returns, the key
+		// may belong to another session with its own tap.
+		defer func() {
+			m.mu.Lock()
+			s.logTap = nil
+			m.mu.Unlock()
+		}()
+	}
+
+	if opts.PreConnectHook != "" {
+		if err := m.runHook(s, "pre_connect_hook", opts.PreConnectHook); err != nil {
+			m.failStart(key, err)
+			startErr := m.startErrorWithLogs(key, err)
+			m.removeSession(key)
+			return SessionSnapshot{}, false, startErr
+		}
+	}
+
+	if opts.TargetInstanceID == "" {
+		id, err := m.resolveTarget(opts)
+		if err != nil {
+			m.failStart(key, err)
+			startErr := m.startErrorWithLogs(key, err)
+			m.removeSession(key)
+			return SessionSnapshot{}, false, startErr
+		}
+		opts.TargetInstanceID = id
+		m.mu.Lock()
+		s.TargetInstanceID = id
+		m.mu.Unlock()
+		s.AppendLog(fmt.Sprintf("target: %s resolved to %s", opts.TargetTag, id))
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	args := BuildSSMPortForwardArgs(
@@ -138,7 +380,11 @@ func (m *Manager) Start(opts StartOptions) (*Session, error) {
 		opts.Region,
 		opts.Profile,
 	)
-	cmd := execCommandContext(ctx, "aws", args...)
+	argv := append(append([]string(nil), opts.CommandWrapper...), "aws")
+	argv = append(argv, args...)
+	cmd := m.command(ctx, argv[0], argv[1:]...)
+	cmd.Env = append(cmd.Environ(), processEnv(opts.ProcessEnv)...)
+	cmd.Env = append(cmd.Env, sessionMarkerEnv+"="+string(key))
 	configureCommandForPlatform(cmd)
 
 	stdout, err := cmd.StdoutPipe()
@@ -147,7 +393,7 @@ func (m *Manager) Start(opts StartOptions) (*Session, error) {
 		m.failStart(key, fmt.Errorf("failed to capture stdout: %w", err))
 		startErr := m.startErrorWithLogs(key, err)
 		m.removeSession(key)
-		return nil, startErr
+		return SessionSnapshot{}, false, startErr
 	}
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
@@ -155,7 +401,7 @@ func (m *Manager) Start(opts StartOptions) (*Session, error) {
 		m.failStart(key, fmt.Errorf("failed to capture stderr: %w", err))
 		startErr := m.startErrorWithLogs(key, err)
 		m.removeSession(key)
-		return nil, startErr
+		return SessionSnapshot{}, false, startErr
 	}
 
 	if err := cmd.Start(); err != nil {
@@ -163,69 +409,170 @@ func (m *Manager) Start(opts StartOptions) (*Session, error) {
 		m.failStart(key, fmt.Errorf("failed to start aws command: %w", err))
 		startErr := m.startErrorWithLogs(key, err)
 		m.removeSession(key)
-		return nil, startErr
+		return SessionSnapshot{}, false, startErr
+	}
+	processStarted := time.Now()
+	if err := trackSessionProcess(cmd); err != nil {
+		cancel()
+		_ = killSessionProcess(cmd)
+		_ = cmd.Wait()
+		releaseSessionProcess(cmd)
+		m.failStart(key, fmt.Errorf("failed to start aws command: %w", err))
+		startErr := m.startErrorWithLogs(key, err)
+		m.removeSession(key)
+		return SessionSnapshot{}, false, startErr
 	}
 
 	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		cancel()
+		_ = cmd.Wait()
+		releaseSessionProcess(cmd)
+		m.removeSession(key)
+		return SessionSnapshot{}, false, fmt.Errorf("%s: %w", key, ErrManagerClosed)
+	}
 	s.cmd = cmd
 	s.cancel = cancel
+	s.StartedArgs = argv
 	if cmd.Process != nil {
 		s.PID = cmd.Process.Pid
 	}
+	started := s.Snapshot()
+	m.workers.Add(3)
 	m.mu.Unlock()
+	m.publish(sessionEvent(EventSessionStarted, started, nil))
 
-	go m.pipeLogs(key, stdout)
-	go m.pipeLogs(key, stderr)
-	go m.waitProcess(key, cmd)
+	logsDone := &sync.WaitGroup{}
+	logsDone.Add(2)
+	go m.pipeLogs(key, LogSourceStdout, stdout, logsDone)
+	go m.pipeLogs(key, LogSourceStderr, stderr, logsDone)
+	go m.waitProcess(key, cmd, logsDone)
 
-	if err := m.waitUntilReady(key, opts.Bind, port, opts.StartupTimeout); err != nil {
+	if opts.SkipReadiness {
+		s.AppendLog("readiness wait skipped (startup timeout is 0)")
+	} else if err := m.waitUntilReady(key, opts); err != nil {
 		startErr := m.startErrorWithLogs(key, err)
 		stopErr := m.Stop(key)
 		if stopErr != nil {
-			return nil, fmt.Errorf("%v\ncleanup error: %w", startErr, stopErr)
+			return SessionSnapshot{}, false, fmt.Errorf("%v\ncleanup error: %w", startErr, stopErr)
 		}
-		return nil, startErr
+		return SessionSnapshot{}, false, startErr
 	}
 
 	m.mu.Lock()
-	if current, ok := m.sessions[key]; ok {
+	// waitProcess leaves a session that exited while starting in the error
+	// state for Start to report, including when readiness was skipped.
+	if current, ok := m.sessions[key]; ok && current.State == SessionStateError {
+		startErr := fmt.Errorf("%s: failed to start session: %s", key, current.LastError)
+		m.removeSessionLocked(key)
+		m.mu.Unlock()
+		return SessionSnapshot{}, false, startErr
+	}
+	if current, ok := m.sessions[key]; ok && current.State == SessionStateStarting {
 		current.State = SessionStateRunning
+		// Only starts that became ready count, so failed attempts are not
+		// reported as reconnects.
+		m.starts[key]++
+		if !opts.SkipReadiness {
+			current.StartupLatency = time.Since(processStarted)
+		}
+		if !opts.SkipReadiness && !(opts.BannerOnly && opts.ReadyBanner != nil) {
+			current.LastHealthyAt = time.Now()
+		}
+		m.workers.Add(1)
+		go m.watchHealth(current, current.done)
+		if opts.IdleTimeout > 0 {
+			m.workers.Add(1)
+			go m.watchIdle(key, current, current.done, opts.IdleTimeout)
+		}
+		if !current.ExpiresAt.IsZero() {
+			m.workers.Add(1)
+			go m.watchTTL(key, current, current.done, current.ExpiresAt)
+		}
 	}
-	out := m.copySessionLocked(key)
+	out := m.snapshotLocked(key)
 	m.mu.Unlock()
 
-	return out, nil
+	return out, false, nil
 }
 
-// Stop requests graceful shutdown and forces kill after timeout.
+// Stop requests graceful shutdown and forces kill after timeout. Concurrent
+// calls for the same session wait for the in-flight stop and share its result.
 func (m *Manager) Stop(key SessionKey) error {
+	return m.stop(key, false)
+}
+
+// Kill stops a session with SIGKILL straight away, skipping the interrupt and
+// grace period, then waits for its local port to be released. A Stop already
+// in flight is escalated rather than waited out. The remote SSM session may
+// linger briefly until AWS notices the client is gone.
+func (m *Manager) Kill(key SessionKey) error {
+	return m.stop(key, true)
+}
+
+func (m *Manager) stop(key SessionKey, force bool) error {
 	if m == nil {
 		return errors.New("manager is nil")
 	}
 
 	m.mu.Lock()
+	if call := m.stopping[key]; call != nil {
+		escalate := force && !call.force
+		call.force = call.force || force
+		m.mu.Unlock()
+		if escalate {
+			if err := killSessionProcess(call.cmd); err != nil {
+				return fmt.Errorf("%s: failed to kill process: %w", key, err)
+			}
+		}
+		<-call.done
+		return call.err
+	}
 	s, ok := m.sessions[key]
 	if !ok {
 		m.mu.Unlock()
 		return fmt.Errorf("%s: %w", key, errSessionNotFound)
 	}
-	if s.State == SessionStateStopped {
-		delete(m.sessions, key)
+	if s.State == SessionStateStopped || s.State == SessionStateError {
+		m.removeSessionLocked(key)
 		m.mu.Unlock()
 		return nil
 	}
-	if s.State == SessionStateError {
-		s.CloseLogSubscribers()
-		delete(m.sessions, key)
-		m.mu.Unlock()
-		return nil
+	s.State = SessionStateStopping
+	s.StopRequestedAt = time.Now()
+	cmd := s.cmd
+	call := &stopCall{done: make(chan struct{}), cmd: cmd, force: force}
+	if m.stopping == nil {
+		m.stopping = make(map[SessionKey]*stopCall)
+	}
+	m.stopping[key] = call
+	m.mu.Unlock()
+
+	call.err = m.stopProcess(key, s, cmd, force)
+	if call.err == nil {
+		m.mu.RLock()
+		snap := s.Snapshot()
+		m.mu.RUnlock()
+		m.emit(sessionEvent(EventSessionStopped, snap, nil))
 	}
-	if s.State != SessionStateStopping {
-		s.State = SessionStateStopping
+	if call.err == nil && s.postStopHook != "" {
+		if err := m.runHook(s, "post_stop_hook", s.postStopHook); err != nil {
+			call.err = fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	m.mu.Lock()
+	if m.stopping[key] == call {
+		delete(m.stopping, key)
 	}
-	cmd := s.cmd
 	m.mu.Unlock()
+	close(call.done)
 
+	return call.err
+}
+
+func (m *Manager) stopProcess(key SessionKey, s *Session, cmd *exec.Cmd, force bool) error {
 	if cmd == nil || cmd.Process == nil {
 		m.mu.Lock()
 		m.removeSessionLocked(key)
@@ -233,15 +580,18 @@ func (m *Manager) Stop(key SessionKey) error {
 		return nil
 	}
 
-	if err := interruptSessionProcess(cmd); err != nil {
-		return fmt.Errorf("%s: failed to interrupt process: %w", key, err)
-	}
+	if !force {
+		if err := interruptSessionProcess(cmd, s.stopSignal); err != nil {
+			return fmt.Errorf("%s: failed to interrupt process: %w", key, err)
+		}
 
-	if m.waitForState(key, SessionStateStopped, m.defaultStopWait) {
-		if err := m.waitUntilPortReleased(s.Bind, s.LocalPort, m.defaultStopWait); err != nil {
-			return fmt.Errorf("%s: %w", key, err)
+		if m.waitForState(key, SessionStateStopped, m.defaultStopWait) {
+			bind, port := m.endpointOf(s)
+			if err := m.waitUntilPortReleased(bind, port, m.defaultStopWait); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			return nil
 		}
-		return nil
 	}
 
 	if err := killSessionProcess(cmd); err != nil {
@@ -251,13 +601,22 @@ func (m *Manager) Stop(key SessionKey) error {
 	if !m.waitForState(key, SessionStateStopped, 2*time.Second) {
 		return fmt.Errorf("%s: session did not stop within timeout", key)
 	}
-	if err := m.waitUntilPortReleased(s.Bind, s.LocalPort, 2*time.Second); err != nil {
+	bind, port := m.endpointOf(s)
+	if err := m.waitUntilPortReleased(bind, port, 2*time.Second); err != nil {
 		return fmt.Errorf("%s: %w", key, err)
 	}
 
 	return nil
 }
 
+// endpointOf reads the local endpoint of s under the lock: an SSM-assigned
+// LocalPort is filled in by the log reader, which may still be running.
+func (m *Manager) endpointOf(s *Session) (string, int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return s.Bind, s.LocalPort
+}
+
 // StopAll stops all known sessions and returns a joined error if any stop fails.
 func (m *Manager) StopAll() error {
 	if m == nil {
@@ -284,6 +643,138 @@ func (m *Manager) StopAll() error {
 	return errors.Join(errs...)
 }
 
+// StopAllWithTimeout stops every session concurrently and returns once all
+// stops finished or d elapsed, whichever comes first. Sessions still stopping
+// at the deadline are named in the error and keep stopping in the background.
+func (m *Manager) StopAllWithTimeout(d time.Duration) error {
+	if m == nil {
+		return errors.New("manager is nil")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	stuck, errs := m.stopAllContext(ctx)
+	if len(stuck) > 0 {
+		errs = append(errs, fmt.Errorf("gave up after %s waiting for %s to stop", d, strings.Join(stuck, ", ")))
+	}
+	return errors.Join(errs...)
+}
+
+// stopAllContext stops every session concurrently until all stops finished
+// or ctx is done. It returns the keys still stopping at that point, in key
+// order, and the errors of the stops that finished.
+func (m *Manager) stopAllContext(ctx context.Context) ([]string, []error) {
+	m.mu.RLock()
+	keys := make([]SessionKey, 0, len(m.sessions))
+	for key := range m.sessions {
+		keys = append(keys, key)
+	}
+	m.mu.RUnlock()
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	type result struct {
+		key SessionKey
+		err error
+	}
+	results := make(chan result, len(keys))
+	for _, key := range keys {
+		m.stops.Add(1)
+		go func(key SessionKey) {
+			defer m.stops.Done()
+			results <- result{key: key, err: m.Stop(key)}
+		}(key)
+	}
+
+	pending := make(map[SessionKey]struct{}, len(keys))
+	for _, key := range keys {
+		pending[key] = struct{}{}
+	}
+
+	var errs []error
+	for len(pending) > 0 {
+		select {
+		case r := <-results:
+			delete(pending, r.key)
+			if r.err != nil && !errors.Is(r.err, errSessionNotFound) {
+				errs = append(errs, r.err)
+			}
+		case <-ctx.Done():
+			stuck := make([]string, 0, len(pending))
+			for _, key := range keys {
+				if _, ok := pending[key]; ok {
+					stuck = append(stuck, string(key))
+				}
+			}
+			return stuck, errs
+		}
+	}
+	return nil, errs
+}
+
+// Close stops all sessions, releases every log subscriber and waits for the
+// per-session goroutines to exit. It is idempotent and safe for concurrent use;
+// later calls return the result of the first one. Start fails with
+// ErrManagerClosed once Close began.
+func (m *Manager) Close() error {
+	return m.CloseContext(context.Background())
+}
+
+// CloseContext is Close bounded by ctx: sessions that have not stopped
+// gracefully when ctx is done are killed along with their process group (or
+// job on Windows), so no session-manager-plugin outlives them. It then waits
+// at most closeKillWait for their Stop calls and goroutines to return. Like
+// Close, only the first call does the work.
+func (m *Manager) CloseContext(ctx context.Context) error {
+	if m == nil {
+		return errors.New("manager is nil")
+	}
+
+	m.closeOnce.Do(func() {
+		m.mu.Lock()
+		m.closed = true
+		m.mu.Unlock()
+
+		stuck, errs := m.stopAllContext(ctx)
+		if len(stuck) > 0 {
+			errs = append(errs, fmt.Errorf("gave up waiting for %s to stop: %w", strings.Join(stuck, ", "), ctx.Err()))
+		}
+
+		m.mu.Lock()
+		for key, s := range m.sessions {
+			if s != nil && s.cmd != nil {
+				_ = killSessionProcess(s.cmd)
+			}
+			if s != nil && s.cancel != nil {
+				s.cancel()
+			}
+			m.removeSessionLocked(key)
+		}
+		m.mu.Unlock()
+
+		wait := ctx
+		if len(stuck) > 0 {
+			var cancel context.CancelFunc
+			wait, cancel = context.WithTimeout(context.WithoutCancel(ctx), closeKillWait)
+			defer cancel()
+		}
+		done := make(chan struct{})
+		go func() {
+			m.stops.Wait()
+			m.workers.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-wait.Done():
+			errs = append(errs, fmt.Errorf("session goroutines did not exit: %w", ctx.Err()))
+		}
+		m.events.close()
+		m.closeErr = errors.Join(errs...)
+	})
+
+	return m.closeErr
+}
+
 // List returns snapshots ordered by key.
 func (m *Manager) List() []SessionSummary {
 	if m == nil {
@@ -304,32 +795,78 @@ func (m *Manager) List() []SessionSummary {
 		if s == nil {
 			continue
 		}
-		uptime := time.Duration(0)
-		if !s.StartTime.IsZero() {
-			uptime = now.Sub(s.StartTime)
-		}
-		out = append(out, SessionSummary{
-			Key:       s.Key,
-			Service:   s.Service,
-			Env:       s.Env,
-			Bind:      s.Bind,
-			LocalPort: s.LocalPort,
-			PID:       s.PID,
-			State:     s.State,
-			StartTime: s.StartTime,
-			Uptime:    uptime,
-			LastError: s.LastError,
-		})
+		out = append(out, m.summaryLocked(s, now))
 	}
 	m.mu.RUnlock()
 
 	return out
 }
 
-// Get returns a copy of the current session snapshot.
-func (m *Manager) Get(key SessionKey) (*Session, bool) {
+// Summary returns the current summary of one session, as List reports it.
+func (m *Manager) Summary(key SessionKey) (SessionSummary, bool) {
 	if m == nil {
-		return nil, false
+		return SessionSummary{}, false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.sessions[key]
+	if !ok || s == nil {
+		return SessionSummary{}, false
+	}
+	return m.summaryLocked(s, time.Now()), true
+}
+
+// summaryLocked builds s's summary as of now. Callers hold m.mu.
+func (m *Manager) summaryLocked(s *Session, now time.Time) SessionSummary {
+	uptime := time.Duration(0)
+	if !s.StartTime.IsZero() {
+		uptime = now.Sub(s.StartTime)
+	}
+	stoppingFor := time.Duration(0)
+	if s.State == SessionStateStopping && !s.StopRequestedAt.IsZero() {
+		stoppingFor = now.Sub(s.StopRequestedAt)
+	}
+	ttlRemaining := time.Duration(0)
+	if !s.ExpiresAt.IsZero() {
+		ttlRemaining = max(s.ExpiresAt.Sub(now), 0)
+	}
+	lastErr := s.LastError
+	if s.redactLogs {
+		lastErr = Redact(lastErr)
+	}
+	return SessionSummary{
+		Key:       s.Key,
+		Service:   s.Service,
+		Env:       s.Env,
+		Bind:      s.Bind,
+		LocalPort: s.LocalPort,
+		PID:       s.PID,
+		State:     s.State,
+		StartTime: s.StartTime,
+		Uptime:    uptime,
+		LastError: lastErr,
+
+		Reconnects:    s.Reconnects,
+		LastReconnect: s.LastReconnect,
+
+		StopRequestedAt: s.StopRequestedAt,
+		StoppingFor:     stoppingFor,
+		StopTimeout:     m.defaultStopWait,
+
+		ExpiresAt:    s.ExpiresAt,
+		TTLRemaining: ttlRemaining,
+
+		LastHealthyAt: s.LastHealthyAt,
+
+		StartupLatency: s.StartupLatency,
+	}
+}
+
+// Get returns a read-only snapshot of the session.
+func (m *Manager) Get(key SessionKey) (SessionSnapshot, bool) {
+	if m == nil {
+		return SessionSnapshot{}, false
 	}
 
 	m.mu.RLock()
@@ -337,15 +874,18 @@ func (m *Manager) Get(key SessionKey) (*Session, bool) {
 
 	s, ok := m.sessions[key]
 	if !ok || s == nil {
-		return nil, false
+		return SessionSnapshot{}, false
 	}
 
-	cp := *s
-	return &cp, true
+	snap := s.Snapshot()
+	if s.redactLogs {
+		snap.LastError = Redact(snap.LastError)
+	}
+	return snap, true
 }
 
 func (m *Manager) selectPortLocked(opts StartOptions) (int, error) {
-	if opts.LocalPort > 0 {
+	if opts.LocalPort > 0 && !opts.NoPortReuse {
 		if m.portReservedLocked(opts.Bind, opts.LocalPort) {
 			return 0, fmt.Errorf("requested port %d already used by another session", opts.LocalPort)
 		}
@@ -367,16 +907,42 @@ func (m *Manager) selectPortLocked(opts StartOptions) (int, error) {
 		return 0, fmt.Errorf("invalid port range %d-%d", min, max)
 	}
 
+	ports := make([]int, 0, max-min+1)
 	for port := min; port <= max; port++ {
+		ports = append(ports, port)
+	}
+	if opts.PortStrategy == PortStrategyRandom {
+		shufflePortsFn(len(ports), func(i, j int) {
+			ports[i], ports[j] = ports[j], ports[i]
+		})
+	}
+
+	reserved, busy := 0, 0
+	for _, port := range ports {
 		if m.portReservedLocked(opts.Bind, port) {
+			reserved++
 			continue
 		}
 		if err := portAvailableFn(opts.Bind, port); err == nil {
 			return port, nil
 		}
+		busy++
 	}
 
-	return 0, fmt.Errorf("no free port available on %s in range %d-%d", opts.Bind, min, max)
+	return 0, portRangeExhaustedError(opts.Bind, min, max, reserved, busy)
+}
+
+// portRangeExhaustedError says whether the range is held by dbx sessions or by
+// unrelated processes, so the fix (stop sessions vs widen range) is obvious.
+func portRangeExhaustedError(bind string, min, max, reserved, busy int) error {
+	hint := "widen defaults.port_range"
+	if reserved > 0 && reserved >= busy {
+		hint = "stop other dbx sessions or widen defaults.port_range"
+	}
+	return fmt.Errorf(
+		"no free port available on %s in range %d-%d: %d held by dbx sessions, %d in use by other processes (%s)",
+		bind, min, max, reserved, busy, hint,
+	)
 }
 
 func (m *Manager) portReservedLocked(bind string, port int) bool {
@@ -391,33 +957,84 @@ func (m *Manager) portReservedLocked(bind string, port int) bool {
 	return false
 }
 
-func (m *Manager) waitUntilReady(key SessionKey, bind string, port int, timeout time.Duration) error {
-	deadline := time.Now().Add(timeout)
-	for {
+// waitUntilReady waits for the local port to accept connections and, when
+// opts.ReadyBanner is set, for pipeLogs to have seen a matching log line. Each
+// failed attempt and the final attempt count go to the session log (and the
+// live log tap, if any).
+func (m *Manager) waitUntilReady(key SessionKey, opts StartOptions) error {
+	bannerOnly := opts.BannerOnly && opts.ReadyBanner != nil
+	started := time.Now()
+	deadline := started.Add(opts.StartupTimeout)
+	pollInterval := opts.ReadinessPollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultReadinessPollInterval
+	}
+
+	m.mu.RLock()
+	logSession := m.sessions[key]
+	m.mu.RUnlock()
+	note := func(line string) {
+		if logSession != nil {
+			logSession.AppendLog(line)
+		}
+		if opts.LogTap != nil {
+			opts.LogTap(line)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
 		remaining := time.Until(deadline)
 		if remaining <= 0 {
+			if opts.ReadyBanner != nil {
+				return fmt.Errorf("%s: timed out waiting for readiness banner %q", key, opts.ReadyBanner.String())
+			}
 			return fmt.Errorf("%s: timed out waiting for local port readiness", key)
 		}
+		if opts.ReadinessRetries > 0 && attempt > opts.ReadinessRetries {
+			return fmt.Errorf("%s: not ready after %d attempts", key, opts.ReadinessRetries)
+		}
 
-		interval := 500 * time.Millisecond
+		interval := pollInterval
 		if remaining < interval {
 			interval = remaining
 		}
-		if err := waitForPortFn(bind, port, interval); err == nil {
-			return nil
+
+		// With an SSM-assigned port there is nothing to probe until the
+		// plugin has reported which port it opened.
+		m.mu.RLock()
+		port := 0
+		if logSession != nil {
+			port = logSession.LocalPort
+		}
+		m.mu.RUnlock()
+		portReady := false
+		if port == 0 {
+			time.Sleep(interval)
+		} else if bannerOnly {
+			time.Sleep(min(interval, 100*time.Millisecond))
+			portReady = true
+		} else {
+			portReady = waitForPortFn(opts.Bind, port, interval) == nil
 		}
 
 		m.mu.RLock()
 		s, ok := m.sessions[key]
 		state := SessionStateStopped
 		lastErr := ""
+		bannerSeen := false
 		if ok && s != nil {
 			state = s.State
 			lastErr = s.LastError
+			bannerSeen = s.bannerSeen
 		}
 		m.mu.RUnlock()
 
+		// A process that already exited fails the start even if something
+		// answered on the port; the listener cannot be its tunnel.
 		if !ok {
+			if _, err := m.stopOutcome(key); err != nil && !errors.Is(err, errSessionNotFound) {
+				return err
+			}
 			return fmt.Errorf("%s: session no longer exists", key)
 		}
 		if state == SessionStateError {
@@ -429,9 +1046,79 @@ func (m *Manager) waitUntilReady(key SessionKey, bind string, port int, timeout
 		if state == SessionStateStopped {
 			return fmt.Errorf("%s: session stopped before readiness", key)
 		}
+
+		if portReady && (opts.ReadyBanner == nil || bannerSeen) {
+			note(fmt.Sprintf("readiness: ready after %d attempt(s) in %s", attempt, time.Since(started).Round(time.Millisecond)))
+			return nil
+		}
+		if port == 0 {
+			note(fmt.Sprintf("readiness: attempt %d: waiting for the plugin to report its local port", attempt))
+		} else if !portReady {
+			note(fmt.Sprintf("readiness: attempt %d: %s:%d not accepting connections", attempt, opts.Bind, port))
+		} else {
+			note(fmt.Sprintf("readiness: attempt %d: waiting for banner %q", attempt, opts.ReadyBanner.String()))
+		}
 	}
 }
 
+// WaitForStop blocks until the session leaves the running set, or timeout
+// passes (0 waits forever). It returns the final state, stopped or error; for
+// error the error carries the session's last error. A timeout returns the
+// current state and an error wrapping context.DeadlineExceeded.
+func (m *Manager) WaitForStop(key SessionKey, timeout time.Duration) (SessionState, error) {
+	if m == nil {
+		return "", errors.New("manager is nil")
+	}
+
+	m.mu.RLock()
+	s, ok := m.sessions[key]
+	var done chan struct{}
+	if ok && s != nil {
+		done = s.done
+	}
+	m.mu.RUnlock()
+	if done == nil {
+		// Already gone: report how it ended, if it ended recently.
+		return m.stopOutcome(key)
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-done:
+		return m.stopOutcome(key)
+	case <-expired:
+		m.mu.RLock()
+		state := s.State
+		m.mu.RUnlock()
+		return state, fmt.Errorf("%s: still %s after %s: %w", key, state, timeout, context.DeadlineExceeded)
+	}
+}
+
+// stopOutcome is the final state of key from RecentlyStopped.
+func (m *Manager) stopOutcome(key SessionKey) (SessionState, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for i := len(m.recentlyStopped) - 1; i >= 0; i-- {
+		summary := m.recentlyStopped[i]
+		if summary.Key != key {
+			continue
+		}
+		if summary.State == SessionStateError {
+			if summary.LastError == "" {
+				return summary.State, fmt.Errorf("%s: session ended in error", key)
+			}
+			return summary.State, fmt.Errorf("%s: %s", key, summary.LastError)
+		}
+		return summary.State, nil
+	}
+	return "", fmt.Errorf("%s: %w", key, errSessionNotFound)
+}
+
 func (m *Manager) waitForState(key SessionKey, desired SessionState, timeout time.Duration) bool {
 	deadline := time.Now().Add(timeout)
 	for time.Now().Before(deadline) {
@@ -450,8 +1137,14 @@ func (m *Manager) waitForState(key SessionKey, desired SessionState, timeout tim
 	return false
 }
 
-func (m *Manager) waitProcess(key SessionKey, cmd *exec.Cmd) {
+// waitProcess reaps the process once its output has been drained, so the
+// final log lines are captured before the session is marked as exited.
+func (m *Manager) waitProcess(key SessionKey, cmd *exec.Cmd, logsDone *sync.WaitGroup) {
+	defer m.workers.Done()
+
+	logsDone.Wait()
 	err := cmd.Wait()
+	releaseSessionProcess(cmd)
 
 	m.mu.Lock()
 	s, ok := m.sessions[key]
@@ -463,13 +1156,54 @@ func (m *Manager) waitProcess(key SessionKey, cmd *exec.Cmd) {
 		m.removeSessionLocked(key)
 		m.mu.Unlock()
 		return
-	} else if err != nil {
-		s.AppendLog(fmt.Sprintf("process exited: %v", err))
-	} else {
-		s.AppendLog("process exited cleanly")
 	}
+	// The exit lines are appended with m.mu released: AppendLog publishes to
+	// log subscribers, and a blocking one must not stall the whole manager.
+	if s.State == SessionStateStarting {
+		// Start is still waiting for readiness; leave the session for it to
+		// report (with logs) and clean up.
+		lastErr := "aws process exited before readiness"
+		if err != nil {
+			lastErr = fmt.Sprintf("%s: %v", lastErr, err)
+		}
+		s.State = SessionStateError
+		s.LastError = lastErr
+		m.mu.Unlock()
+		s.AppendLog(lastErr)
+		return
+	}
+	wasRunning := s.State == SessionStateRunning
+	eventType := EventSessionStopped
+	line := "process exited cleanly"
+	if err != nil {
+		line = fmt.Sprintf("process exited: %v", err)
+		eventType = EventSessionError
+		err = fmt.Errorf("process exited: %w", err)
+		s.State = SessionStateError
+		s.LastError = err.Error()
+	}
+	m.mu.Unlock()
+
+	s.AppendLog(line)
+
+	m.mu.Lock()
+	if m.sessions[key] != s {
+		// A Stop of the error state already removed it.
+		m.mu.Unlock()
+		return
+	}
+	if s.State == SessionStateStopping {
+		// A Stop arrived meanwhile; it reports the stop once this removal
+		// lets it see the session gone.
+		wasRunning = false
+	}
+	snap := s.Snapshot()
 	m.removeSessionLocked(key)
 	m.mu.Unlock()
+
+	if wasRunning {
+		m.emit(sessionEvent(eventType, snap, err))
+	}
 }
 
 func (m *Manager) waitUntilPortReleased(bind string, port int, timeout time.Duration) error {
@@ -488,7 +1222,12 @@ func (m *Manager) waitUntilPortReleased(bind string, port int, timeout time.Dura
 	}
 }
 
-func (m *Manager) pipeLogs(key SessionKey, src io.ReadCloser) {
+// pipeLogs stores each line of src tagged with source. stdout and stderr are
+// read concurrently, so their relative order is only as good as the
+// process's own flushing; the tag tells them apart.
+func (m *Manager) pipeLogs(key SessionKey, source LogSource, src io.ReadCloser, done *sync.WaitGroup) {
+	defer m.workers.Done()
+	defer done.Done()
 	defer src.Close()
 
 	scanner := bufio.NewScanner(src)
@@ -496,11 +1235,35 @@ func (m *Manager) pipeLogs(key SessionKey, src io.ReadCloser) {
 		line := scanner.Text()
 		m.mu.RLock()
 		s, ok := m.sessions[key]
+		var tap func(string)
+		if ok && s != nil {
+			tap = s.logTap
+		}
 		m.mu.RUnlock()
 		if !ok || s == nil {
 			return
 		}
-		s.AppendLog(line)
+		s.AppendLogFrom(source, line)
+		if tap != nil {
+			if s.redactLogs {
+				tap(Redact(line))
+			} else {
+				tap(line)
+			}
+		}
+		if port, ok := openedPort(line); ok {
+			m.mu.Lock()
+			if s.awaitingPort {
+				s.LocalPort = port
+				s.awaitingPort = false
+			}
+			m.mu.Unlock()
+		}
+		if s.readyBanner != nil && s.readyBanner.MatchString(line) {
+			m.mu.Lock()
+			s.bannerSeen = true
+			m.mu.Unlock()
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -535,17 +1298,23 @@ func (m *Manager) startErrorWithLogs(key SessionKey, startErr error) error {
 	if len(logs) == 0 {
 		return fmt.Errorf("%s: failed to start session: %w", key, startErr)
 	}
+	for _, line := range logs {
+		if strings.Contains(line, pluginMissingSignature) {
+			return fmt.Errorf("%s: %w; install it from %s", key, ErrPluginMissing, pluginInstallURL)
+		}
+	}
 
 	return fmt.Errorf("%s: failed to start session: %w\nrecent logs:\n%s", key, startErr, strings.Join(logs, "\n"))
 }
 
-func (m *Manager) copySessionLocked(key SessionKey) *Session {
+// snapshotLocked returns a snapshot of the session at key, or a zero
+// snapshot when there is none.
+func (m *Manager) snapshotLocked(key SessionKey) SessionSnapshot {
 	s, ok := m.sessions[key]
 	if !ok || s == nil {
-		return nil
+		return SessionSnapshot{}
 	}
-	cp := *s
-	return &cp
+	return s.Snapshot()
 }
 
 func (m *Manager) removeSession(key SessionKey) {
@@ -560,7 +1329,55 @@ func (m *Manager) removeSessionLocked(key SessionKey) {
 		delete(m.sessions, key)
 		return
 	}
+	m.recordStoppedLocked(s)
 	s.State = SessionStateStopped
 	s.CloseLogSubscribers()
+	if s.done != nil {
+		close(s.done)
+		s.done = nil
+	}
 	delete(m.sessions, key)
 }
+
+// recordStoppedLocked keeps s's final summary for RecentlyStopped. A session
+// that ended in error keeps that state; anything else is recorded as stopped.
+func (m *Manager) recordStoppedLocked(s *Session) {
+	now := time.Now()
+	summary := m.summaryLocked(s, now)
+	if summary.State != SessionStateError {
+		summary.State = SessionStateStopped
+	}
+	summary.StoppingFor = 0
+	summary.TTLRemaining = 0
+	summary.StoppedAt = now
+
+	m.recentlyStopped = append(m.recentlyStopped, summary)
+	drop := 0
+	for drop < len(m.recentlyStopped) && now.Sub(m.recentlyStopped[drop].StoppedAt) > recentlyStoppedTTL {
+		drop++
+	}
+	drop = max(drop, len(m.recentlyStopped)-recentlyStoppedLimit)
+	m.recentlyStopped = append([]SessionSummary(nil), m.recentlyStopped[drop:]...)
+}
+
+// RecentlyStopped returns the sessions that ended within recentlyStoppedTTL,
+// newest first, with their final state and last error.
+func (m *Manager) RecentlyStopped() []SessionSummary {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	out := make([]SessionSummary, 0, len(m.recentlyStopped))
+	for i := len(m.recentlyStopped) - 1; i >= 0; i-- {
+		summary := m.recentlyStopped[i]
+		if now.Sub(summary.StoppedAt) > recentlyStoppedTTL {
+			break
+		}
+		out = append(out, summary)
+	}
+	return out
+}
@@ -0,0 +1,134 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// PortOwner is a process listening on a local TCP port.
+type PortOwner struct {
+	Port    int
+	PID     int
+	Command string
+}
+
+// orphanCommands are the executables a dbx session runs; a listener owned by
+// one of them is a forward left behind by an earlier dbx.
+var orphanCommands = map[string]bool{
+	"aws":                    true,
+	"session-manager-plugin": true,
+}
+
+// dbxCommands are the executables of a live dbx: a forward descending from
+// one still has an owner, even if it is another dbx process.
+var dbxCommands = map[string]bool{
+	"dbx":                     true,
+	filepath.Base(os.Args[0]): true,
+}
+
+// sessionMarkerEnv is set to the session key in the environment of every aws
+// process dbx starts, and inherited by its session-manager-plugin. Reap only
+// considers processes carrying it, so forwards dbx did not start are never
+// killed.
+const sessionMarkerEnv = "DBX_SESSION"
+
+// maxProcessDepth bounds the walk up a process's ancestors.
+const maxProcessDepth = 16
+
+// listeningPortOwnersFn, processInfoFn and processMarkerFn are test seams
+// over the platform process lookups.
+var (
+	listeningPortOwnersFn = listeningPortOwners
+	processInfoFn         = processInfo
+	processMarkerFn       = processSessionMarker
+)
+
+// Orphans returns the aws/session-manager-plugin processes listening on a port
+// in [min, max] that a dbx started but no live dbx owns, e.g. forwards left by
+// a dbx that was killed without cleaning up. Only processes carrying the
+// DBX_SESSION marker count; of those, one is owned when it or one of its
+// ancestors is a session m tracks, this process, or another dbx, and one
+// re-parented to init has lost its owner. Only Linux (including WSL) is
+// supported.
+func (m *Manager) Orphans(min, max int) ([]PortOwner, error) {
+	if m == nil {
+		return nil, fmt.Errorf("manager is nil")
+	}
+	if min <= 0 || max < min {
+		return nil, fmt.Errorf("invalid port range %d-%d", min, max)
+	}
+
+	owners, err := listeningPortOwnersFn(min, max)
+	if err != nil {
+		return nil, err
+	}
+
+	tracked := make(map[int]bool)
+	for _, s := range m.List() {
+		if s.PID > 0 {
+			tracked[s.PID] = true
+		}
+	}
+
+	orphans := make([]PortOwner, 0, len(owners))
+	for _, owner := range owners {
+		if !orphanCommands[owner.Command] {
+			continue
+		}
+		if _, marked := processMarkerFn(owner.PID); marked && !hasLiveOwner(owner.PID, tracked) {
+			orphans = append(orphans, owner)
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		if orphans[i].Port != orphans[j].Port {
+			return orphans[i].Port < orphans[j].Port
+		}
+		return orphans[i].PID < orphans[j].PID
+	})
+	return orphans, nil
+}
+
+// hasLiveOwner walks up from pid until it finds a tracked session, this
+// process or a dbx. When pid's ancestry cannot be read the process is treated
+// as owned, so reap never kills what it cannot account for.
+func hasLiveOwner(pid int, tracked map[int]bool) bool {
+	self := os.Getpid()
+	for range maxProcessDepth {
+		if tracked[pid] || pid == self {
+			return true
+		}
+		ppid, _, ok := processInfoFn(pid)
+		if !ok {
+			return true
+		}
+		if ppid <= 1 {
+			return false
+		}
+		if tracked[ppid] || ppid == self {
+			return true
+		}
+		_, command, ok := processInfoFn(ppid)
+		if !ok {
+			return true
+		}
+		if dbxCommands[command] {
+			return true
+		}
+		pid = ppid
+	}
+	return false
+}
+
+// KillOrphan sends SIGKILL to an orphaned forward found by Orphans.
+func KillOrphan(owner PortOwner) error {
+	p, err := os.FindProcess(owner.PID)
+	if err != nil {
+		return fmt.Errorf("pid %d: %w", owner.PID, err)
+	}
+	if err := p.Kill(); err != nil {
+		return fmt.Errorf("pid %d: %w", owner.PID, err)
+	}
+	return nil
+}
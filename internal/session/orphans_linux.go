@@ -0,0 +1,149 @@
+//go:build linux
+
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tcpStateListen is the st column value of a listening socket in /proc/net/tcp.
+const tcpStateListen = "0A"
+
+// listeningPortOwners maps listening sockets on ports in [min, max] to the
+// processes holding them, by matching socket inodes from /proc/net/tcp{,6}
+// against /proc/<pid>/fd. Processes of other users are skipped silently.
+func listeningPortOwners(min, max int) ([]PortOwner, error) {
+	ports := make(map[string]int)
+	found := false
+	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		err := listeningInodes(path, min, max, ports)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("no /proc/net/tcp table available")
+	}
+	if len(ports) == 0 {
+		return nil, nil
+	}
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var owners []PortOwner
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		seen := make(map[int]bool)
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			port, ok := ports[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")]
+			if !ok || seen[port] {
+				continue
+			}
+			seen[port] = true
+			owners = append(owners, PortOwner{Port: port, PID: pid, Command: processCommand(pid)})
+		}
+	}
+	return owners, nil
+}
+
+// listeningInodes adds inode -> local port for each listening socket in path
+// whose port is in [min, max].
+func listeningInodes(path string, min, max int, into map[string]int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != tcpStateListen {
+			continue
+		}
+		_, hexPort, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		port, err := strconv.ParseUint(hexPort, 16, 16)
+		if err != nil || int(port) < min || int(port) > max {
+			continue
+		}
+		into[fields[9]] = int(port)
+	}
+	return scanner.Err()
+}
+
+// processInfo returns pid's parent pid and command. Its stat line is
+// "pid (comm) state ppid ...", where comm may itself hold spaces or parens.
+func processInfo(pid int) (int, string, bool) {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, "", false
+	}
+	end := bytes.LastIndexByte(stat, ')')
+	if end < 0 {
+		return 0, "", false
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 2 {
+		return 0, "", false
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, "", false
+	}
+	return ppid, processCommand(pid), true
+}
+
+// processSessionMarker returns the DBX_SESSION value in pid's environment,
+// which dbx sets on the aws processes it starts.
+func processSessionMarker(pid int) (string, bool) {
+	environ, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "environ"))
+	if err != nil {
+		return "", false
+	}
+	prefix := []byte(sessionMarkerEnv + "=")
+	for _, kv := range bytes.Split(environ, []byte{0}) {
+		if value, ok := bytes.CutPrefix(kv, prefix); ok {
+			return string(value), true
+		}
+	}
+	return "", false
+}
+
+// processCommand is the base name of pid's argv[0], e.g. "aws".
+func processCommand(pid int) string {
+	cmdline, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if err != nil || len(cmdline) == 0 {
+		return ""
+	}
+	argv0, _, _ := bytes.Cut(cmdline, []byte{0})
+	return filepath.Base(string(argv0))
+}
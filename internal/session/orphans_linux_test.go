@@ -0,0 +1,60 @@
+//go:build linux
+
+package session
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListeningPortOwnersFindsListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	owners, err := listeningPortOwners(port, port)
+	if err != nil {
+		t.Fatalf("owners: %v", err)
+	}
+	want := PortOwner{Port: port, PID: os.Getpid(), Command: filepath.Base(os.Args[0])}
+	if len(owners) != 1 || owners[0] != want {
+		t.Fatalf("expected %+v, got %+v", want, owners)
+	}
+
+	ppid, command, ok := processInfo(os.Getpid())
+	if !ok || ppid != os.Getppid() || command != want.Command {
+		t.Fatalf("expected parent %d and command %q, got %d %q (%v)", os.Getppid(), want.Command, ppid, command, ok)
+	}
+}
+
+func TestManagerStartMarksAwsProcess(t *testing.T) {
+	withManagerTestSeams(t, fakeLongRunningCommand)
+
+	m := NewManager()
+	m.defaultStopWait = 2 * time.Second
+	t.Cleanup(func() { _ = m.Close() })
+	s, err := m.Start(startOpts("service1", "dev", 5526))
+	if err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if key, ok := processSessionMarker(s.PID); !ok || key != "service1/dev" {
+		t.Fatalf("expected the session key as marker, got %q (%v)", key, ok)
+	}
+
+	cmd := exec.CommandContext(context.Background(), "sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start sleep: %v", err)
+	}
+	t.Cleanup(func() { _ = cmd.Process.Kill(); _ = cmd.Wait() })
+	if key, ok := processSessionMarker(cmd.Process.Pid); ok {
+		t.Fatalf("expected no marker on a process dbx did not start, got %q", key)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package session
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func listeningPortOwners(min, max int) ([]PortOwner, error) {
+	return nil, fmt.Errorf("finding port owners is not supported on %s", runtime.GOOS)
+}
+
+func processInfo(pid int) (int, string, bool) {
+	return 0, "", false
+}
+
+func processSessionMarker(pid int) (string, bool) {
+	return "", false
+}
@@ -3,8 +3,20 @@ package session
 import (
 	"fmt"
 	"net"
+	"strings"
 )
 
+// normalizeBind maps "localhost" to 127.0.0.1. localhost can resolve to ::1
+// as well, so a listen and a later dial could pick different families; an
+// explicit address keeps the availability check, the readiness dial and port
+// reservations on the same one.
+func normalizeBind(bind string) string {
+	if strings.EqualFold(strings.TrimSpace(bind), "localhost") {
+		return "127.0.0.1"
+	}
+	return bind
+}
+
 // FindFreePort returns an available TCP port bound to bind within [min, max].
 func FindFreePort(bind string, min int, max int) (int, error) {
 	if min <= 0 || max <= 0 {
@@ -28,6 +40,7 @@ func ValidatePortAvailable(bind string, port int) error {
 	if port < 1 || port > 65535 {
 		return fmt.Errorf("invalid port %d", port)
 	}
+	bind = normalizeBind(bind)
 
 	listener, err := net.Listen("tcp", net.JoinHostPort(bind, fmt.Sprintf("%d", port)))
 	if err != nil {
@@ -3,6 +3,7 @@ package session
 import (
 	"net"
 	"testing"
+	"time"
 )
 
 func TestValidatePortAvailable(t *testing.T) {
@@ -41,3 +42,19 @@ func TestFindFreePortReturnsErrorWhenRangeIsOccupied(t *testing.T) {
 		t.Fatalf("expected error when only port %d in range is occupied", port)
 	}
 }
+
+func TestLocalhostBindUsesIPv4Loopback(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	if err := ValidatePortAvailable("localhost", port); err == nil {
+		t.Fatalf("expected port %d held on 127.0.0.1 to be unavailable on localhost", port)
+	}
+	if err := WaitForPort("localhost", port, time.Second); err != nil {
+		t.Fatalf("expected localhost to reach the 127.0.0.1 listener: %v", err)
+	}
+}
@@ -17,7 +17,20 @@ func configureCommandForPlatform(cmd *exec.Cmd) {
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 }
 
-func interruptSessionProcess(cmd *exec.Cmd) error {
+// configureHookForPlatform runs a hook in its own process group and makes its
+// timeout kill the whole group, so children the hook started go with it.
+func configureHookForPlatform(cmd *exec.Cmd) {
+	configureCommandForPlatform(cmd)
+	cmd.Cancel = func() error { return killSessionProcess(cmd) }
+}
+
+// trackSessionProcess and releaseSessionProcess are no-ops: the process group
+// set up by configureCommandForPlatform already covers the plugin child.
+func trackSessionProcess(cmd *exec.Cmd) error { return nil }
+
+func releaseSessionProcess(cmd *exec.Cmd) {}
+
+func interruptSessionProcess(cmd *exec.Cmd, stopSignal StopSignal) error {
 	if cmd == nil || cmd.Process == nil {
 		return nil
 	}
@@ -27,11 +40,16 @@ func interruptSessionProcess(cmd *exec.Cmd) error {
 		return nil
 	}
 
-	if err := syscall.Kill(-pid, syscall.SIGINT); err == nil || errors.Is(err, syscall.ESRCH) {
+	sig := syscall.SIGINT
+	if stopSignal == StopSignalTerm {
+		sig = syscall.SIGTERM
+	}
+
+	if err := syscall.Kill(-pid, sig); err == nil || errors.Is(err, syscall.ESRCH) {
 		return nil
 	}
 
-	if err := cmd.Process.Signal(os.Interrupt); err == nil || errors.Is(err, os.ErrProcessDone) {
+	if err := cmd.Process.Signal(sig); err == nil || errors.Is(err, os.ErrProcessDone) {
 		return nil
 	}
 
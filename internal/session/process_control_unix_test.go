@@ -0,0 +1,95 @@
+//go:build !windows
+
+package session
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestManagerCloseContextKillsProcessGroup(t *testing.T) {
+	// The child stands in for session-manager-plugin: it shares the aws
+	// process group and ignores the graceful stop signals too.
+	withManagerTestSeams(t, func(ctx context.Context, _ string, _ ...string) *exec.Cmd {
+		return exec.CommandContext(ctx, "sh", "-c", "trap '' INT TERM; sleep 60 & echo child=$!; while :; do sleep 0.1; done")
+	})
+
+	m := NewManager()
+	m.defaultStopWait = 5 * time.Second
+	key := NewSessionKey("service1", "dev")
+	if _, err := m.Start(startOpts("service1", "dev", 5528)); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+
+	child := 0
+	deadline := time.Now().Add(2 * time.Second)
+	for child == 0 {
+		for _, line := range lastLogLines(m, key, 10) {
+			if pid, ok := strings.CutPrefix(line, "child="); ok {
+				child, _ = strconv.Atoi(pid)
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the child pid in the session log")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := m.CloseContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+
+	deadline = time.Now().Add(2 * time.Second)
+	for !processGone(child) {
+		if time.Now().After(deadline) {
+			_ = syscall.Kill(child, syscall.SIGKILL)
+			t.Fatalf("expected child %d to be killed with its process group", child)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// processGone reports whether pid has exited. A zombie counts as gone: it
+// waits on a reaper the test does not control.
+func processGone(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return true
+	}
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	_, rest, ok := strings.Cut(string(stat), ") ")
+	return ok && strings.HasPrefix(rest, "Z")
+}
+
+func TestRunHookTimeoutKillsBackgroundedChildren(t *testing.T) {
+	previous := hookTimeout
+	hookTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { hookTimeout = previous })
+
+	// The backgrounded sleep inherits the hook's stdout; without the group
+	// kill it would hold CombinedOutput open long after the timeout.
+	m := NewManager()
+	s := &Session{Key: NewSessionKey("service1", "dev"), Service: "service1", Env: "dev"}
+	started := time.Now()
+	err := m.runHook(s, "pre_connect_hook", "sleep 30 & echo started; wait")
+	if err == nil {
+		t.Fatal("expected timed-out hook to fail")
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Fatalf("expected hook to return soon after its timeout, took %v", elapsed)
+	}
+	if logs := strings.Join(s.LastLogs(10), "\n"); !strings.Contains(logs, "[pre_connect_hook] started") {
+		t.Fatalf("expected hook output in logs, got %q", logs)
+	}
+}
@@ -7,26 +7,127 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// sessionJobs holds the job object of each running session process, by pid.
+// The job groups aws with the session-manager-plugin it spawns, the way the
+// process group does on Unix, so a kill reaches both.
+var (
+	sessionJobsMu sync.Mutex
+	sessionJobs   = make(map[int]windows.Handle)
+
+	// os/exec does not expose the main thread of a child, so a suspended
+	// process is resumed as a whole.
+	procNtResumeProcess = windows.NewLazySystemDLL("ntdll.dll").NewProc("NtResumeProcess")
 )
 
 func configureCommandForPlatform(cmd *exec.Cmd) {
-	_ = cmd
+	if cmd == nil {
+		return
+	}
+	// A new process group lets CTRL_BREAK_EVENT target the session without
+	// also reaching dbx. The process starts suspended so trackSessionProcess
+	// can put it in its job before it gets to spawn the plugin.
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: windows.CREATE_NEW_PROCESS_GROUP | windows.CREATE_SUSPENDED}
 }
 
-func interruptSessionProcess(cmd *exec.Cmd) error {
+// configureHookForPlatform leaves hooks to the default cancel, which ends
+// only cmd.exe: a job object needs the suspended start that
+// CombinedOutput does not allow. cmd.WaitDelay still bounds the wait.
+func configureHookForPlatform(cmd *exec.Cmd) {}
+
+// trackSessionProcess puts a started, suspended process in a job object that
+// kills its remaining members when closed, then resumes it. Failing to set up
+// the job is not fatal: stopping then only reaches the aws process itself.
+// Failing to resume is, as the process would never run.
+func trackSessionProcess(cmd *exec.Cmd) error {
 	if cmd == nil || cmd.Process == nil {
 		return nil
 	}
 
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE|windows.PROCESS_SUSPEND_RESUME, false, uint32(cmd.Process.Pid))
+	if err != nil {
+		return fmt.Errorf("open process pid=%d: %w", cmd.Process.Pid, err)
+	}
+	defer windows.CloseHandle(process)
+
+	if job, ok := newSessionJob(process); ok {
+		sessionJobsMu.Lock()
+		sessionJobs[cmd.Process.Pid] = job
+		sessionJobsMu.Unlock()
+	}
+
+	if status, _, _ := procNtResumeProcess.Call(uintptr(process)); status != 0 {
+		return fmt.Errorf("resume process pid=%d: NTSTATUS 0x%x", cmd.Process.Pid, status)
+	}
+	return nil
+}
+
+// newSessionJob creates a kill-on-close job object holding process.
+func newSessionJob(process windows.Handle) (windows.Handle, bool) {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return 0, false
+	}
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+	info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	if _, err := windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation, uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+		_ = windows.CloseHandle(job)
+		return 0, false
+	}
+	if err := windows.AssignProcessToJobObject(job, process); err != nil {
+		_ = windows.CloseHandle(job)
+		return 0, false
+	}
+	return job, true
+}
+
+// releaseSessionProcess closes the job of a reaped process, which also ends
+// any plugin process it left behind.
+func releaseSessionProcess(cmd *exec.Cmd) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+
+	sessionJobsMu.Lock()
+	job, ok := sessionJobs[cmd.Process.Pid]
+	delete(sessionJobs, cmd.Process.Pid)
+	sessionJobsMu.Unlock()
+	if ok {
+		_ = windows.CloseHandle(job)
+	}
+}
+
+// interruptSessionProcess sends CTRL_BREAK whatever stopSignal asks for:
+// Windows has no SIGTERM to deliver to a console process group.
+func interruptSessionProcess(cmd *exec.Cmd, stopSignal StopSignal) error {
+	if cmd == nil || cmd.Process == nil {
+		return nil
+	}
+
+	pid := cmd.Process.Pid
+	if pid <= 0 {
+		return nil
+	}
+
+	if err := windows.GenerateConsoleCtrlEvent(windows.CTRL_BREAK_EVENT, uint32(pid)); err == nil {
+		return nil
+	}
+
 	if err := cmd.Process.Signal(os.Interrupt); err == nil || errors.Is(err, os.ErrProcessDone) {
 		return nil
 	}
 
-	if err := cmd.Process.Kill(); err == nil || errors.Is(err, os.ErrProcessDone) {
+	if err := killSessionProcess(cmd); err == nil {
 		return nil
 	}
 
-	return fmt.Errorf("failed to interrupt session pid=%d", cmd.Process.Pid)
+	return fmt.Errorf("failed to interrupt session pid=%d", pid)
 }
 
 func killSessionProcess(cmd *exec.Cmd) error {
@@ -34,9 +135,19 @@ func killSessionProcess(cmd *exec.Cmd) error {
 		return nil
 	}
 
+	pid := cmd.Process.Pid
+	sessionJobsMu.Lock()
+	job, ok := sessionJobs[pid]
+	sessionJobsMu.Unlock()
+	if ok {
+		if err := windows.TerminateJobObject(job, 1); err == nil {
+			return nil
+		}
+	}
+
 	if err := cmd.Process.Kill(); err == nil || errors.Is(err, os.ErrProcessDone) {
 		return nil
 	}
 
-	return fmt.Errorf("failed to kill session pid=%d", cmd.Process.Pid)
+	return fmt.Errorf("failed to kill session pid=%d", pid)
 }
@@ -9,13 +9,17 @@ import (
 
 const readinessPollInterval = 100 * time.Millisecond
 
+// defaultReadinessPollInterval is how long each Start readiness attempt waits
+// when StartOptions.ReadinessPollInterval is unset.
+const defaultReadinessPollInterval = 500 * time.Millisecond
+
 // WaitForPort waits until a TCP connection can be established to bind:port.
 func WaitForPort(bind string, port int, timeout time.Duration) error {
 	if timeout <= 0 {
 		return fmt.Errorf("invalid timeout %s", timeout)
 	}
 
-	address := net.JoinHostPort(bind, strconv.Itoa(port))
+	address := net.JoinHostPort(normalizeBind(bind), strconv.Itoa(port))
 	deadline := time.Now().Add(timeout)
 
 	for {
@@ -0,0 +1,27 @@
+package session
+
+import "regexp"
+
+const redacted = "[REDACTED]"
+
+// redactPatterns match values that must not reach the log buffer when
+// redact_logs is on. Each keeps its first group (the key or scheme) and
+// replaces the secret after it.
+var redactPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	// Access key ids: AKIA for long-term keys, ASIA for temporary ones.
+	{re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), repl: redacted},
+	{re: regexp.MustCompile(`(?i)\b(aws_secret_access_key|aws_session_token|aws_security_token)(["']?\s*[=:]\s*["']?)[^\s"',]+`), repl: "${1}${2}" + redacted},
+	{re: regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9\-._~+/]+=*`), repl: "${1}" + redacted},
+}
+
+// Redact replaces AWS access key ids, secret access keys, session tokens and
+// bearer tokens in line with [REDACTED].
+func Redact(line string) string {
+	for _, p := range redactPatterns {
+		line = p.re.ReplaceAllString(line, p.repl)
+	}
+	return line
+}
@@ -0,0 +1,125 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+type targetCacheKey struct {
+	tag     string
+	region  string
+	profile string
+}
+
+type resolvedTarget struct {
+	instanceID string
+	at         time.Time
+}
+
+// targetCache remembers the instance each tag selector resolved to, so the
+// forwards of one multi-port env or a burst of connects share one AWS call.
+type targetCache struct {
+	mu      sync.Mutex
+	entries map[targetCacheKey]resolvedTarget
+}
+
+func (c *targetCache) get(key targetCacheKey, ttl time.Duration, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || now.Sub(entry.at) >= ttl {
+		return "", false
+	}
+	return entry.instanceID, true
+}
+
+func (c *targetCache) put(key targetCacheKey, instanceID string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[targetCacheKey]resolvedTarget)
+	}
+	c.entries[key] = resolvedTarget{instanceID: instanceID, at: now}
+}
+
+// BuildDescribeTargetArgs builds args for an `aws ssm
+// describe-instance-information` call listing the IDs of the online managed
+// instances tagged tag ("Key=Value").
+func BuildDescribeTargetArgs(tag, region, profile string) ([]string, error) {
+	key, value, ok := strings.Cut(tag, "=")
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if !ok || key == "" || value == "" {
+		return nil, fmt.Errorf("target tag must look like Key=Value, got %q", tag)
+	}
+
+	args := []string{
+		"ssm",
+		"describe-instance-information",
+		"--filters", fmt.Sprintf("Key=tag:%s,Values=%s", key, value),
+		"--query", "InstanceInformationList[?PingStatus=='Online'].InstanceId",
+		"--output", "json",
+	}
+	if region != "" {
+		args = append(args, "--region", region)
+	}
+	if profile != "" {
+		args = append(args, "--profile", profile)
+	}
+	return args, nil
+}
+
+// resolveTarget returns the instance opts.TargetTag selects. Exactly one
+// online instance must match, so a half-rotated group fails loudly instead
+// of picking a target at random. A lookup younger than opts.TargetCacheTTL
+// is reused unless opts.RefreshTarget is set.
+func (m *Manager) resolveTarget(opts StartOptions) (string, error) {
+	cacheKey := targetCacheKey{tag: opts.TargetTag, region: opts.Region, profile: opts.Profile}
+	if !opts.RefreshTarget {
+		if id, ok := m.targets.get(cacheKey, opts.TargetCacheTTL, time.Now()); ok {
+			return id, nil
+		}
+	}
+
+	args, err := BuildDescribeTargetArgs(opts.TargetTag, opts.Region, opts.Profile)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.StartupTimeout)
+	defer cancel()
+
+	argv := append(append([]string(nil), opts.CommandWrapper...), "aws")
+	argv = append(argv, args...)
+	cmd := m.command(ctx, argv[0], argv[1:]...)
+	if len(opts.ProcessEnv) > 0 {
+		cmd.Env = append(cmd.Environ(), processEnv(opts.ProcessEnv)...)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("target_tag %s: describe instances: %w", opts.TargetTag, err)
+	}
+
+	var ids []string
+	if err := json.Unmarshal(out, &ids); err != nil {
+		return "", fmt.Errorf("target_tag %s: parse describe-instance-information output: %w", opts.TargetTag, err)
+	}
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("target_tag %s: no online SSM instance matches", opts.TargetTag)
+	case 1:
+	default:
+		return "", fmt.Errorf("target_tag %s: %d online SSM instances match (%s); use a more specific tag", opts.TargetTag, len(ids), strings.Join(ids, ", "))
+	}
+
+	m.targets.put(cacheKey, ids[0], time.Now())
+	return ids[0], nil
+}
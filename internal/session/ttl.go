@@ -0,0 +1,26 @@
+package session
+
+import (
+	"fmt"
+	"time"
+)
+
+// watchTTL stops the session when it reaches expiresAt, unless done is closed
+// first because the session stopped on its own.
+func (m *Manager) watchTTL(key SessionKey, s *Session, done <-chan struct{}, expiresAt time.Time) {
+	defer m.workers.Done()
+
+	timer := time.NewTimer(time.Until(expiresAt))
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return
+	case <-timer.C:
+	}
+
+	s.AppendLog("stopped: session TTL reached")
+	if err := m.Stop(key); err != nil {
+		s.AppendLog(fmt.Sprintf("TTL stop failed: %v", err))
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
+	"regexp"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -49,25 +51,197 @@ type Session struct {
 	State     SessionState
 	StartTime time.Time
 	LastError string
+	// StartedArgs is the argv of the aws process, for audit and debugging:
+	// any command_wrapper, then "aws" and its arguments. It holds no
+	// credentials, only ids, profile and region.
+	StartedArgs []string
+
+	Reconnects    int
+	LastReconnect time.Time
+
+	StopRequestedAt time.Time
+	ExpiresAt       time.Time
+	// LastHealthyAt is when the local endpoint last accepted a probe.
+	LastHealthyAt time.Time
+	// StartupLatency is how long the session took from starting the aws
+	// process to passing the readiness check; zero when readiness was skipped.
+	StartupLatency time.Duration
 
 	cmd    *exec.Cmd
 	cancel context.CancelFunc
 
+	// readyBanner is fixed at start; bannerSeen is guarded by the manager lock.
+	readyBanner *regexp.Regexp
+	bannerSeen  bool
+
+	postStopHook string
+	logTap       func(string)
+	// awaitingPort is set while an SSM-assigned LocalPort is still 0.
+	awaitingPort bool
+	// redactLogs is fixed at start; AppendLog then masks secrets with Redact.
+	redactLogs bool
+	// stopSignal is fixed at start and picks the graceful stop signal.
+	stopSignal StopSignal
+
+	// done is closed when the session is removed, ending its watchers.
+	done chan struct{}
+	// healthProbing is set while watchHealth dials the local port, so
+	// watchIdle does not take the probe for a client.
+	healthProbing atomic.Bool
+
+	// onLog, set at start, publishes each stored line on the manager's
+	// event bus.
+	onLog func(LogEntry)
+
+	// subsMu guards logBuf, and orders appends against replaying subscribes.
+	subsMu sync.RWMutex
+	logBuf *RingBuffer
+	logs   broadcaster[LogEntry]
+}
+
+// SessionSnapshot is a read-only copy of a session's state, as Manager.Get
+// returns it. Its fields do not change once taken; LastLogs and
+// LastLogEntries read the session's live log buffer.
+type SessionSnapshot struct {
+	Key     SessionKey
+	Service string
+	Env     string
+
+	Bind      string
+	LocalPort int
+
+	RemoteHost       string
+	RemotePort       int
+	TargetInstanceID string
+	Region           string
+	Profile          string
+
+	PID         int
+	State       SessionState
+	StartTime   time.Time
+	LastError   string
+	StartedArgs []string
+
+	Reconnects    int
+	LastReconnect time.Time
+
+	StopRequestedAt time.Time
+	ExpiresAt       time.Time
+	LastHealthyAt   time.Time
+	StartupLatency  time.Duration
+
+	// Reused is set on the result of a Start that returned an already
+	// running session (StartOptions.ReuseExisting) instead of starting one.
+	Reused bool
+
 	logBuf *RingBuffer
+}
+
+// LastLogs returns up to n of the session's most recent log lines.
+func (s SessionSnapshot) LastLogs(n int) []string {
+	if s.logBuf == nil {
+		return nil
+	}
+	return s.logBuf.Last(n)
+}
 
-	subsMu           sync.RWMutex
-	subscribers      map[uint64]chan string
-	nextSubscriberID uint64
+// LastLogEntries is LastLogs with each line's source kept separate.
+func (s SessionSnapshot) LastLogEntries(n int) []LogEntry {
+	if s.logBuf == nil {
+		return nil
+	}
+	return s.logBuf.LastEntries(n)
+}
+
+// SubscriberStats reports delivery counters for one log subscriber.
+type SubscriberStats struct {
+	// Dropped counts lines skipped because the subscriber's buffer was full.
+	Dropped uint64
+}
+
+// DropPolicy decides what AppendLog does when a subscriber's buffer is full.
+type DropPolicy int
+
+const (
+	// DropNewest skips the incoming line (the default).
+	DropNewest DropPolicy = iota
+	// DropOldest evicts the oldest queued line to make room.
+	DropOldest
+	// Block waits up to subscriberBlockTimeout before dropping the line.
+	Block
+)
+
+// subscriberBlockTimeout bounds how long a Block subscriber can stall AppendLog.
+const subscriberBlockTimeout = 250 * time.Millisecond
+
+func (p DropPolicy) String() string {
+	switch p {
+	case DropNewest:
+		return "drop-newest"
+	case DropOldest:
+		return "drop-oldest"
+	case Block:
+		return "block"
+	default:
+		return fmt.Sprintf("DropPolicy(%d)", int(p))
+	}
+}
+
+// stopCall lets concurrent Stop calls share the result of one in-flight stop.
+// force records whether the process was killed, so a Kill that joins a
+// graceful stop still escalates it.
+type stopCall struct {
+	done  chan struct{}
+	err   error
+	cmd   *exec.Cmd
+	force bool
 }
 
 func NewSession(service, env string) *Session {
 	return &Session{
-		Key:         NewSessionKey(service, env),
-		Service:     service,
-		Env:         env,
-		State:       SessionStateStarting,
-		logBuf:      NewRingBuffer(DefaultRingBufferLines),
-		subscribers: make(map[uint64]chan string),
+		Key:     NewSessionKey(service, env),
+		Service: service,
+		Env:     env,
+		State:   SessionStateStarting,
+		logBuf:  NewRingBuffer(DefaultRingBufferLines),
+	}
+}
+
+// Snapshot copies the state of s. Its exported fields are guarded by the
+// Manager that owns it, so the caller must hold off concurrent writers;
+// Manager.Get takes one under the manager lock.
+func (s *Session) Snapshot() SessionSnapshot {
+	if s == nil {
+		return SessionSnapshot{}
+	}
+
+	s.subsMu.RLock()
+	logBuf := s.logBuf
+	s.subsMu.RUnlock()
+
+	return SessionSnapshot{
+		Key:              s.Key,
+		Service:          s.Service,
+		Env:              s.Env,
+		Bind:             s.Bind,
+		LocalPort:        s.LocalPort,
+		RemoteHost:       s.RemoteHost,
+		RemotePort:       s.RemotePort,
+		TargetInstanceID: s.TargetInstanceID,
+		Region:           s.Region,
+		Profile:          s.Profile,
+		PID:              s.PID,
+		State:            s.State,
+		StartTime:        s.StartTime,
+		LastError:        s.LastError,
+		StartedArgs:      append([]string(nil), s.StartedArgs...),
+		Reconnects:       s.Reconnects,
+		LastReconnect:    s.LastReconnect,
+		StopRequestedAt:  s.StopRequestedAt,
+		ExpiresAt:        s.ExpiresAt,
+		LastHealthyAt:    s.LastHealthyAt,
+		StartupLatency:   s.StartupLatency,
+		logBuf:           logBuf,
 	}
 }
 
@@ -75,27 +249,34 @@ func (s *Session) ensureLogState() {
 	if s.logBuf == nil {
 		s.logBuf = NewRingBuffer(DefaultRingBufferLines)
 	}
-	if s.subscribers == nil {
-		s.subscribers = make(map[uint64]chan string)
-	}
 }
 
-// AppendLog appends a line to the ring buffer and broadcasts to subscribers.
+// AppendLog appends a dbx line to the ring buffer and broadcasts to
+// subscribers. Lines a slow subscriber cannot take are handled by its
+// DropPolicy.
 func (s *Session) AppendLog(line string) {
+	s.AppendLogFrom(LogSourceDBX, line)
+}
+
+// AppendLogFrom is AppendLog for a line read from source.
+func (s *Session) AppendLogFrom(source LogSource, line string) {
 	if s == nil {
 		return
 	}
 
+	if s.redactLogs {
+		line = Redact(line)
+	}
+	entry := LogEntry{Time: time.Now(), Source: source, Line: line}
+
 	s.subsMu.Lock()
 	defer s.subsMu.Unlock()
 
 	s.ensureLogState()
-	s.logBuf.Append(line)
-	for _, ch := range s.subscribers {
-		select {
-		case ch <- line:
-		default:
-		}
+	s.logBuf.AppendEntry(entry)
+	s.logs.publish(entry)
+	if s.onLog != nil {
+		s.onLog(entry)
 	}
 }
 
@@ -113,55 +294,71 @@ func (s *Session) LastLogs(n int) []string {
 	return s.logBuf.Last(n)
 }
 
-// SubscribeLogs registers a subscriber channel for follow mode.
-func (s *Session) SubscribeLogs(buffer int) (uint64, <-chan string) {
+// LastLogEntries is LastLogs with each line's source kept separate.
+func (s *Session) LastLogEntries(n int) []LogEntry {
 	if s == nil {
-		ch := make(chan string)
+		return nil
+	}
+
+	s.subsMu.RLock()
+	defer s.subsMu.RUnlock()
+
+	if s.logBuf == nil {
+		return nil
+	}
+	return s.logBuf.LastEntries(n)
+}
+
+// SubscribeLogs registers a subscriber channel for follow mode; policy decides
+// what happens when the buffer is full. Once the session's subscribers were
+// closed, it returns an already-closed channel.
+func (s *Session) SubscribeLogs(buffer int, policy DropPolicy) (uint64, <-chan LogEntry) {
+	if s == nil {
+		ch := make(chan LogEntry)
 		close(ch)
 		return 0, ch
 	}
-	if buffer < 0 {
-		buffer = 0
+	return s.logs.subscribe(nil, buffer, policy)
+}
+
+// SubscribeLogsWithReplay is SubscribeLogs that first queues the last n
+// buffered lines on the channel. Both happen under the subscribers lock, so
+// the replay and the live lines that follow have no gap and no duplicates.
+// The channel holds the replay plus buffer further lines.
+func (s *Session) SubscribeLogsWithReplay(n, buffer int, policy DropPolicy) (uint64, <-chan LogEntry) {
+	if s == nil {
+		ch := make(chan LogEntry)
+		close(ch)
+		return 0, ch
 	}
 
 	s.subsMu.Lock()
 	defer s.subsMu.Unlock()
 
 	s.ensureLogState()
-	s.nextSubscriberID++
-	id := s.nextSubscriberID
-	ch := make(chan string, buffer)
-	s.subscribers[id] = ch
-
-	return id, ch
+	return s.logs.subscribe(s.logBuf.LastEntries(n), buffer, policy)
 }
 
 func (s *Session) UnsubscribeLogs(id uint64) {
 	if s == nil {
 		return
 	}
+	s.logs.unsubscribe(id)
+}
 
-	s.subsMu.Lock()
-	defer s.subsMu.Unlock()
-
-	ch, ok := s.subscribers[id]
-	if !ok {
-		return
+// SubscriberStats returns the counters for subscriber id. The bool is false
+// when id is not an active subscriber.
+func (s *Session) SubscriberStats(id uint64) (SubscriberStats, bool) {
+	if s == nil {
+		return SubscriberStats{}, false
 	}
-	delete(s.subscribers, id)
-	close(ch)
+	return s.logs.stats(id)
 }
 
+// CloseLogSubscribers closes every follower channel and rejects new ones.
 func (s *Session) CloseLogSubscribers() {
 	if s == nil {
 		return
 	}
-
-	s.subsMu.Lock()
-	defer s.subsMu.Unlock()
-
-	for id, ch := range s.subscribers {
-		delete(s.subscribers, id)
-		close(ch)
-	}
+	s.logs.close()
 }
@@ -0,0 +1,223 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fredyranthun/db/internal/config"
+)
+
+// Action is a UI command that can be bound to keys via ui.keys.
+type Action string
+
+const (
+	ActionQuit           Action = "quit"
+	ActionFocusNext      Action = "focus_next"
+	ActionFocusPrev      Action = "focus_prev"
+	ActionDown           Action = "down"
+	ActionUp             Action = "up"
+	ActionJump           Action = "jump"
+	ActionConnect        Action = "connect"
+	ActionPin            Action = "pin"
+	ActionStop           Action = "stop"
+	ActionStopAll        Action = "stop_all"
+	ActionFollow         Action = "follow"
+	ActionPager          Action = "pager"
+	ActionPause          Action = "pause"
+	ActionRefreshLonger  Action = "refresh_longer"
+	ActionRefreshShorter Action = "refresh_shorter"
+	ActionEditConfig     Action = "edit_config"
+	ActionHelp           Action = "help"
+	ActionMessages       Action = "messages"
+	ActionShowStopped    Action = "show_stopped"
+	ActionWrapLogs       Action = "wrap_logs"
+)
+
+// reservedQuitKey always quits, whatever the keymap says, so a bad binding
+// can never trap the user in the UI.
+const reservedQuitKey = "ctrl+c"
+
+var defaultKeyBindings = map[Action][]string{
+	ActionQuit:           {"q"},
+	ActionFocusNext:      {"tab"},
+	ActionFocusPrev:      {"shift+tab"},
+	ActionDown:           {"j", "down"},
+	ActionUp:             {"k", "up"},
+	ActionJump:           {"enter"},
+	ActionConnect:        {"c"},
+	ActionPin:            {"p"},
+	ActionStop:           {"s"},
+	ActionStopAll:        {"S"},
+	ActionFollow:         {"l"},
+	ActionPager:          {"o"},
+	ActionPause:          {" "},
+	ActionRefreshLonger:  {"+", "="},
+	ActionRefreshShorter: {"-"},
+	ActionEditConfig:     {"e"},
+	ActionHelp:           {"?"},
+	ActionMessages:       {"m"},
+	ActionShowStopped:    {"a"},
+	ActionWrapLogs:       {"w"},
+}
+
+// actionHelp lists the actions in help-overlay order with their descriptions.
+var actionHelp = []struct {
+	action      Action
+	description string
+}{
+	{ActionDown, "move selection down"},
+	{ActionUp, "move selection up"},
+	{ActionFocusNext, "focus next pane"},
+	{ActionFocusPrev, "focus previous pane"},
+	{ActionJump, "jump between a target and its session"},
+	{ActionConnect, "connect selected target"},
+	{ActionPin, "pin or unpin selected target"},
+	{ActionStop, "stop selected session"},
+	{ActionStopAll, "stop all sessions"},
+	{ActionShowStopped, "show or hide recently stopped sessions"},
+	{ActionFollow, "toggle follow logs"},
+	{ActionPager, "open logs in $PAGER"},
+	{ActionWrapLogs, "wrap or truncate long log lines"},
+	{ActionPause, "pause or resume refresh"},
+	{ActionRefreshLonger, "lengthen refresh interval"},
+	{ActionRefreshShorter, "shorten refresh interval"},
+	{ActionEditConfig, "edit config in $EDITOR"},
+	{ActionMessages, "show recent status messages"},
+	{ActionHelp, "toggle this help"},
+	{ActionQuit, "quit (ctrl+c always quits)"},
+}
+
+// KeyMap maps key strings (as reported by tea.KeyMsg.String) to actions.
+type KeyMap struct {
+	bindings map[Action][]string
+	actions  map[string]Action
+}
+
+// DefaultKeyMap returns the built-in bindings.
+func DefaultKeyMap() KeyMap {
+	km, _ := NewKeyMap(nil)
+	return km
+}
+
+// NewKeyMap applies overrides (action name to keys, as in ui.keys) on top of
+// the defaults. It fails on unknown actions, empty keys, ctrl+c and keys bound
+// to more than one action.
+func NewKeyMap(overrides map[string][]string) (KeyMap, error) {
+	bindings := make(map[Action][]string, len(defaultKeyBindings))
+	for action, keys := range defaultKeyBindings {
+		bindings[action] = keys
+	}
+
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		action := Action(name)
+		if _, ok := defaultKeyBindings[action]; !ok {
+			return KeyMap{}, fmt.Errorf("ui.keys.%s: unknown action", name)
+		}
+		keys := make([]string, 0, len(overrides[name]))
+		for _, key := range overrides[name] {
+			key = normalizeKey(key)
+			if key == "" {
+				return KeyMap{}, fmt.Errorf("ui.keys.%s: key must not be empty", name)
+			}
+			if key == reservedQuitKey {
+				return KeyMap{}, fmt.Errorf("ui.keys.%s: %s is reserved for quit", name, reservedQuitKey)
+			}
+			keys = append(keys, key)
+		}
+		if len(keys) == 0 {
+			return KeyMap{}, fmt.Errorf("ui.keys.%s: must list at least one key", name)
+		}
+		bindings[action] = keys
+	}
+
+	actions := make([]Action, 0, len(bindings))
+	for action := range bindings {
+		actions = append(actions, action)
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i] < actions[j] })
+
+	km := KeyMap{bindings: bindings, actions: make(map[string]Action)}
+	for _, action := range actions {
+		for _, key := range bindings[action] {
+			if other, ok := km.actions[key]; ok && other != action {
+				return KeyMap{}, fmt.Errorf("ui.keys: %q is bound to both %s and %s", displayKey(key), other, action)
+			}
+			km.actions[key] = action
+		}
+	}
+	return km, nil
+}
+
+// keyMapFor builds the keymap from cfg's ui.keys. The config has already been
+// validated on load, so a bad keymap only falls back to the defaults.
+func keyMapFor(cfg *config.Config) KeyMap {
+	if cfg == nil {
+		return DefaultKeyMap()
+	}
+	km, err := NewKeyMap(cfg.UI.Keys)
+	if err != nil {
+		return DefaultKeyMap()
+	}
+	return km
+}
+
+// Lookup returns the action bound to key. A zero KeyMap uses the defaults.
+func (km KeyMap) Lookup(key string) (Action, bool) {
+	if key == reservedQuitKey {
+		return ActionQuit, true
+	}
+	if km.actions == nil {
+		km = DefaultKeyMap()
+	}
+	action, ok := km.actions[key]
+	return action, ok
+}
+
+// Help is the first key bound to action, for the help bar.
+func (km KeyMap) Help(action Action) string {
+	if km.bindings == nil {
+		km = DefaultKeyMap()
+	}
+	keys := km.bindings[action]
+	if len(keys) == 0 {
+		return ""
+	}
+	return displayKey(keys[0])
+}
+
+// Keys lists every key bound to action, for the help overlay.
+func (km KeyMap) Keys(action Action) []string {
+	if km.bindings == nil {
+		km = DefaultKeyMap()
+	}
+	keys := make([]string, 0, len(km.bindings[action]))
+	for _, key := range km.bindings[action] {
+		keys = append(keys, displayKey(key))
+	}
+	return keys
+}
+
+// normalizeKey maps config spellings to tea.KeyMsg.String values.
+func normalizeKey(key string) string {
+	if key == " " {
+		return key
+	}
+	key = strings.TrimSpace(key)
+	if key == "space" {
+		return " "
+	}
+	return key
+}
+
+func displayKey(key string) string {
+	if key == " " {
+		return "space"
+	}
+	return key
+}
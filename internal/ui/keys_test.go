@@ -0,0 +1,43 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewKeyMapOverridesAndConflicts(t *testing.T) {
+	km, err := NewKeyMap(map[string][]string{
+		"focus_next": {"tab", "L"},
+		"focus_prev": {"H"},
+		"pause":      {"space", "P"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for key, want := range map[string]Action{"L": ActionFocusNext, "tab": ActionFocusNext, "H": ActionFocusPrev, " ": ActionPause, "P": ActionPause, "j": ActionDown, "ctrl+c": ActionQuit} {
+		if got, ok := km.Lookup(key); !ok || got != want {
+			t.Fatalf("Lookup(%q) = %q, %t; want %q", key, got, ok, want)
+		}
+	}
+	if _, ok := km.Lookup("shift+tab"); ok {
+		t.Fatal("expected the overridden default shift+tab to be unbound")
+	}
+
+	for _, tt := range []struct {
+		name      string
+		overrides map[string][]string
+		want      string
+	}{
+		{name: "conflict with default", overrides: map[string][]string{"focus_next": {"l"}}, want: `"l" is bound to both focus_next and follow`},
+		{name: "unknown action", overrides: map[string][]string{"explode": {"x"}}, want: "ui.keys.explode: unknown action"},
+		{name: "empty list", overrides: map[string][]string{"quit": nil}, want: "ui.keys.quit: must list at least one key"},
+		{name: "blank key", overrides: map[string][]string{"quit": {"  "}}, want: "ui.keys.quit: key must not be empty"},
+		{name: "reserved ctrl+c", overrides: map[string][]string{"stop": {"ctrl+c"}}, want: "reserved for quit"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKeyMap(tt.overrides); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
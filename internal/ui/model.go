@@ -1,17 +1,40 @@
 package ui
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"os/exec"
 	"sort"
+	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/fredyranthun/db/internal/config"
 	"github.com/fredyranthun/db/internal/session"
+	"github.com/fredyranthun/db/internal/uistate"
 )
 
 const defaultRefreshInterval = 1 * time.Second
 
+// statusHistoryLimit bounds how many status messages the messages overlay keeps.
+const statusHistoryLimit = 100
+
+// refreshIntervals are the steps `+` and `-` move through.
+var refreshIntervals = []time.Duration{
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2 * time.Second,
+	5 * time.Second,
+}
+
+var (
+	lookPathFn     = exec.LookPath
+	pagerFallback  = []string{"less", "more"}
+	editorFallback = []string{"vi", "nano"}
+)
+
 type Pane string
 
 type statusLevel string
@@ -29,6 +52,13 @@ const (
 	statusError   statusLevel = "error"
 )
 
+// statusEntry is one status message kept for the messages overlay.
+type statusEntry struct {
+	at    time.Time
+	level statusLevel
+	text  string
+}
+
 type Target struct {
 	Service string
 	Env     string
@@ -37,11 +67,15 @@ type Target struct {
 
 type refreshTickMsg struct {
 	sessions []session.SessionSummary
+	stopped  []session.SessionSummary
 }
 
 type connectResultMsg struct {
 	key      session.SessionKey
 	endpoint string
+	// sessions are the summaries of the sessions just started, so the
+	// sessions pane shows them without waiting for the next refresh.
+	sessions []session.SessionSummary
 	err      error
 }
 
@@ -54,21 +88,49 @@ type stopAllResultMsg struct {
 	err error
 }
 
+type pagerClosedMsg struct {
+	key session.SessionKey
+	err error
+}
+
+type editorClosedMsg struct {
+	err error
+}
+
+// ReloadConfigMsg asks a running UI to re-read and re-validate its config,
+// e.g. on SIGHUP. It is ignored when the model has no reload hook.
+type ReloadConfigMsg struct{}
+
+// WarningMsg shows Text as a warning in the status line. It carries messages
+// from outside the UI, such as a failed webhook delivery, that would corrupt
+// the screen if written to stderr.
+type WarningMsg struct {
+	Text string
+}
+
+type configReloadedMsg struct {
+	cfg *config.Config
+	err error
+}
+
 type logLineMsg struct {
 	key    session.SessionKey
 	subID  uint64
-	line   string
+	entry  session.LogEntry
 	closed bool
 }
 
 type sessionManager interface {
 	List() []session.SessionSummary
-	Start(opts session.StartOptions) (*session.Session, error)
+	RecentlyStopped() []session.SessionSummary
+	Summary(key session.SessionKey) (session.SessionSummary, bool)
+	Start(opts session.StartOptions) (session.SessionSnapshot, error)
 	Stop(key session.SessionKey) error
 	StopAll() error
-	LastLogs(key session.SessionKey, n int) ([]string, error)
-	SubscribeLogs(key session.SessionKey, buffer int) (uint64, <-chan string, error)
+	LastLogs(key session.SessionKey, n int) ([]session.LogEntry, error)
+	SubscribeLogsWithReplay(key session.SessionKey, n, buffer int, policy session.DropPolicy) (uint64, <-chan session.LogEntry, error)
 	UnsubscribeLogs(key session.SessionKey, id uint64)
+	SubscriberStats(key session.SessionKey, id uint64) (session.SubscriberStats, error)
 }
 
 type Model struct {
@@ -77,6 +139,8 @@ type Model struct {
 
 	targets             []Target
 	sessions            []session.SessionSummary
+	stoppedSessions     []session.SessionSummary
+	showStopped         bool
 	targetSelected      int
 	targetViewportStart int
 	sessionSelected     int
@@ -86,19 +150,32 @@ type Model struct {
 	manager             sessionManager
 	cfg                 *config.Config
 	defaults            config.Defaults
+	keys                KeyMap
 	refreshIn           time.Duration
+	paused              bool
+	showHelp            bool
+	showMessages        bool
+	statusHistory       []statusEntry
 	logFollow           bool
+	logWrap             bool
 	logLines            int
 	logKey              session.SessionKey
-	logBuffer           []string
+	logBuffer           []session.LogEntry
 	logSubKey           session.SessionKey
 	logSubID            uint64
-	logSubCh            <-chan string
+	logSubCh            <-chan session.LogEntry
+	logDropped          uint64
 	logReadActive       bool
+	configPath          string
+	reloadConfig        func() (*config.Config, error)
+	allowPublicBind     bool
+	envFileVars         map[string]string
+	statePath           string
+	pinned              map[session.SessionKey]bool
 }
 
 func NewModel(manager sessionManager, cfg *config.Config) Model {
-	targets := configuredTargets(cfg)
+	targets := configuredTargets(cfg, nil)
 	defaults := config.Defaults{}
 	if cfg != nil {
 		defaults = cfg.EffectiveDefaults()
@@ -119,11 +196,67 @@ func NewModel(manager sessionManager, cfg *config.Config) Model {
 		manager:     manager,
 		cfg:         cfg,
 		defaults:    defaults,
+		keys:        keyMapFor(cfg),
 		refreshIn:   defaultRefreshInterval,
 		logLines:    50,
+		logWrap:     cfg != nil && cfg.UI.LogWrapEnabled(),
 	}
 }
 
+// WithConfigReload enables the `e` key: it opens path in $EDITOR and calls
+// reload afterwards, swapping in the new config only when reload succeeds.
+func (m Model) WithConfigReload(path string, reload func() (*config.Config, error)) Model {
+	m.configPath = path
+	m.reloadConfig = reload
+	return m
+}
+
+// WithEnvFile passes the variables of --env-file to every aws process the UI
+// starts, over the config's env.
+func (m Model) WithEnvFile(vars map[string]string) Model {
+	m.envFileVars = vars
+	return m
+}
+
+// WithStateFile restores pinned targets, the focused pane, the selected
+// target and log follow from the UI state file at path, and saves them back
+// there when `p` toggles a pin and on quit. A saved target that is no longer
+// configured is ignored.
+func (m Model) WithStateFile(path string) Model {
+	m.statePath = path
+	state, err := uistate.Load(path)
+	if err != nil {
+		m.setStatus(statusWarn, fmt.Sprintf("ui state: %v", err))
+		return m
+	}
+	m.pinned = make(map[session.SessionKey]bool, len(state.Pinned))
+	for _, key := range state.Pinned {
+		m.pinned[session.SessionKey(key)] = true
+	}
+	m.targets = configuredTargets(m.cfg, m.pinned)
+
+	switch focused := Pane(state.Focused); focused {
+	case PaneTargets, PaneSessions, PaneLogs:
+		m.focused = focused
+	}
+	for i, t := range m.targets {
+		if string(t.Key) == state.SelectedTarget {
+			m.targetSelected = i
+			break
+		}
+	}
+	m.syncTargetViewport()
+	m.logFollow = state.Follow
+	return m
+}
+
+// WithPublicBind lets `c` connect targets whose bind is not a loopback
+// address. Without it such connects are refused.
+func (m Model) WithPublicBind(allowed bool) Model {
+	m.allowPublicBind = allowed
+	return m
+}
+
 func (m Model) Init() tea.Cmd {
 	return m.refreshCmd()
 }
@@ -138,35 +271,62 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.handleKey(msg)
 	case refreshTickMsg:
 		m.sessions = msg.sessions
+		m.stoppedSessions = msg.stopped
 		m.clampSelections()
 		m.syncTargetViewport()
 		m.syncLogs(false)
 		return m, m.refreshCmd()
 	case connectResultMsg:
 		if msg.err != nil {
-			m.statusLevel = statusError
-			m.status = fmt.Sprintf("%s: connect failed: %v", msg.key, msg.err)
+			m.setStatus(statusError, fmt.Sprintf("%s: connect failed: %v", msg.key, msg.err))
 		} else {
-			m.statusLevel = statusSuccess
-			m.status = fmt.Sprintf("%s: connected (%s)", msg.key, msg.endpoint)
+			m.setStatus(statusSuccess, fmt.Sprintf("%s: connected (%s)", msg.key, msg.endpoint))
+			m.mergeSessions(msg.sessions)
 		}
 		return m, m.refreshNowCmd()
 	case stopResultMsg:
 		if msg.err != nil {
-			m.statusLevel = statusError
-			m.status = fmt.Sprintf("%s: stop failed: %v", msg.key, msg.err)
+			m.setStatus(statusError, fmt.Sprintf("%s: stop failed: %v", msg.key, msg.err))
 		} else {
-			m.statusLevel = statusSuccess
-			m.status = fmt.Sprintf("%s: stopped", msg.key)
+			m.setStatus(statusSuccess, fmt.Sprintf("%s: stopped", msg.key))
 		}
 		return m, m.refreshNowCmd()
+	case pagerClosedMsg:
+		if msg.err != nil {
+			m.setStatus(statusError, fmt.Sprintf("%s: pager failed: %v", msg.key, msg.err))
+		} else {
+			m.setStatus(statusInfo, fmt.Sprintf("%s: pager closed", msg.key))
+		}
+		return m, m.refreshNowCmd()
+	case editorClosedMsg:
+		if msg.err != nil {
+			m.setStatus(statusError, fmt.Sprintf("editor failed: %v", msg.err))
+			return m, nil
+		}
+		return m, m.reloadConfigCmd()
+	case ReloadConfigMsg:
+		if m.reloadConfig == nil {
+			return m, nil
+		}
+		m.setStatus(statusInfo, "reloading config...")
+		return m, m.reloadConfigCmd()
+	case WarningMsg:
+		m.setStatus(statusWarn, msg.Text)
+		return m, nil
+	case configReloadedMsg:
+		if msg.err != nil {
+			m.setStatus(statusError, fmt.Sprintf("config reload failed, keeping previous config: %v", msg.err))
+			return m, nil
+		}
+		m.applyConfig(msg.cfg)
+		m.setStatus(statusSuccess, fmt.Sprintf("config reloaded (%d targets)", len(m.targets)))
+		m.syncLogs(true)
+		return m, m.ensureLogReaderCmd()
 	case stopAllResultMsg:
 		if msg.err != nil {
-			m.statusLevel = statusError
-			m.status = fmt.Sprintf("stop all failed: %v", msg.err)
+			m.setStatus(statusError, fmt.Sprintf("stop all failed: %v", msg.err))
 		} else {
-			m.statusLevel = statusSuccess
-			m.status = "stopped all sessions"
+			m.setStatus(statusSuccess, "stopped all sessions")
 		}
 		return m, m.refreshNowCmd()
 	case logLineMsg:
@@ -179,10 +339,13 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.logReadActive = false
 			return m, nil
 		}
-		m.logBuffer = append(m.logBuffer, msg.line)
+		m.logBuffer = append(m.logBuffer, msg.entry)
 		if len(m.logBuffer) > session.DefaultRingBufferLines {
 			m.logBuffer = m.logBuffer[len(m.logBuffer)-session.DefaultRingBufferLines:]
 		}
+		if stats, err := m.manager.SubscriberStats(msg.key, msg.subID); err == nil {
+			m.logDropped = stats.Dropped
+		}
 		return m, m.logReadCmd(msg.key, msg.subID, m.logSubCh)
 	}
 
@@ -201,7 +364,12 @@ func (m Model) refreshNowCmd() tea.Cmd {
 	return m.refreshWithDelay(0)
 }
 
+// refreshWithDelay polls the manager after delay. While paused only immediate
+// (delay 0) refreshes run, so the periodic tick loop stops until resumed.
 func (m Model) refreshWithDelay(delay time.Duration) tea.Cmd {
+	if m.paused && delay > 0 {
+		return nil
+	}
 	return func() tea.Msg {
 		if delay > 0 {
 			time.Sleep(delay)
@@ -209,86 +377,236 @@ func (m Model) refreshWithDelay(delay time.Duration) tea.Cmd {
 		if m.manager == nil {
 			return refreshTickMsg{}
 		}
-		return refreshTickMsg{sessions: m.manager.List()}
+		return refreshTickMsg{sessions: m.manager.List(), stopped: m.manager.RecentlyStopped()}
 	}
 }
 
 func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "q", "ctrl+c":
+	action, ok := m.keys.Lookup(msg.String())
+	if m.showHelp || m.showMessages {
+		// Overlays swallow keys; their own key, esc and q close them, ctrl+c
+		// still quits.
+		switch {
+		case msg.String() == reservedQuitKey:
+		case msg.String() == "esc", action == ActionHelp, action == ActionMessages, action == ActionQuit:
+			m.showHelp, m.showMessages = false, false
+			return m, nil
+		default:
+			return m, nil
+		}
+	}
+	if !ok {
+		return m, nil
+	}
+
+	switch action {
+	case ActionQuit:
 		m.closeLogSubscription()
+		// Best effort: there is no UI left to report a failed save on.
+		_ = m.saveState()
 		return m, tea.Quit
-	case "tab":
-		m.cycleFocus()
-		m.statusLevel = statusInfo
-		m.status = fmt.Sprintf("focus: %s", m.focused)
+	case ActionFocusNext, ActionFocusPrev:
+		if action == ActionFocusNext {
+			m.cycleFocus(1)
+		} else {
+			m.cycleFocus(-1)
+		}
+		m.setStatus(statusInfo, fmt.Sprintf("focus: %s", m.focused))
 		m.syncLogs(true)
 		return m, m.ensureLogReaderCmd()
-	case "j", "down":
+	case ActionDown:
 		m.moveSelection(1)
 		m.syncLogs(true)
 		return m, m.ensureLogReaderCmd()
-	case "k", "up":
+	case ActionUp:
 		m.moveSelection(-1)
 		m.syncLogs(true)
 		return m, m.ensureLogReaderCmd()
-	case "c":
+	case ActionJump:
+		if !m.jumpToCounterpart() {
+			return m, nil
+		}
+		m.syncLogs(true)
+		return m, m.ensureLogReaderCmd()
+	case ActionConnect:
 		cmd := m.connectSelectedCmd()
 		if cmd == nil {
 			if len(m.targets) == 0 {
-				m.statusLevel = statusWarn
-				m.status = "no target selected"
+				m.setStatus(statusWarn, "no target selected")
 			}
 			return m, nil
 		}
-		m.statusLevel = statusInfo
-		m.status = fmt.Sprintf("%s: connecting...", m.currentTargetKey())
+		m.setStatus(statusInfo, fmt.Sprintf("%s: connecting...", m.currentTargetKey()))
 		return m, cmd
-	case "s":
+	case ActionStop:
 		cmd := m.stopSelectedCmd()
 		if cmd == nil {
 			if len(m.sessions) == 0 {
-				m.statusLevel = statusWarn
-				m.status = "no running session selected"
+				m.setStatus(statusWarn, "no running session selected")
 			}
 			return m, nil
 		}
-		m.statusLevel = statusInfo
-		m.status = fmt.Sprintf("%s: stopping...", m.currentSessionKey())
+		m.setStatus(statusInfo, fmt.Sprintf("%s: stopping...", m.currentSessionKey()))
 		return m, cmd
-	case "S":
+	case ActionStopAll:
 		if m.manager == nil {
-			m.statusLevel = statusError
-			m.status = "session manager unavailable"
+			m.setStatus(statusError, "session manager unavailable")
 			return m, nil
 		}
-		m.statusLevel = statusInfo
-		m.status = "stopping all sessions..."
+		m.setStatus(statusInfo, "stopping all sessions...")
 		return m, m.stopAllCmd()
-	case "l":
+	case ActionShowStopped:
+		m.showStopped = !m.showStopped
+		return m, nil
+	case ActionPin:
+		m.togglePin()
+		return m, nil
+	case ActionWrapLogs:
+		m.logWrap = !m.logWrap
+		if m.logWrap {
+			m.setStatus(statusInfo, "long log lines wrap")
+		} else {
+			m.setStatus(statusInfo, "long log lines are truncated")
+		}
+		return m, nil
+	case ActionFollow:
 		m.logFollow = !m.logFollow
-		m.statusLevel = statusInfo
 		if m.logFollow {
-			m.status = "log follow enabled"
+			m.setStatus(statusInfo, "log follow enabled")
 		} else {
-			m.status = "log follow disabled"
+			m.setStatus(statusInfo, "log follow disabled")
 		}
 		m.syncLogs(true)
 		return m, m.ensureLogReaderCmd()
+	case ActionPager:
+		key, ok := m.currentLogKey()
+		if !ok || !m.hasSessionForKey(key) || m.manager == nil {
+			m.setStatus(statusWarn, "no running session selected")
+			return m, nil
+		}
+		cmd, err := m.openPagerCmd(key)
+		if err != nil {
+			m.setStatus(statusError, fmt.Sprintf("%s: pager failed: %v", key, err))
+			return m, nil
+		}
+		m.setStatus(statusInfo, fmt.Sprintf("%s: opening logs in pager...", key))
+		return m, cmd
+	case ActionPause:
+		m.paused = !m.paused
+		if m.paused {
+			m.setStatus(statusInfo, "refresh paused")
+			return m, nil
+		}
+		m.setStatus(statusInfo, "refresh resumed")
+		return m, m.refreshNowCmd()
+	case ActionRefreshLonger:
+		m.stepRefreshInterval(1)
+		return m, nil
+	case ActionRefreshShorter:
+		m.stepRefreshInterval(-1)
+		return m, nil
+	case ActionHelp:
+		m.showHelp = true
+		return m, nil
+	case ActionMessages:
+		m.showMessages = true
+		return m, nil
+	case ActionEditConfig:
+		if m.configPath == "" || m.reloadConfig == nil {
+			m.setStatus(statusWarn, "config editing unavailable")
+			return m, nil
+		}
+		argv, err := editorCommand(os.Getenv("VISUAL"), os.Getenv("EDITOR"))
+		if err != nil {
+			m.setStatus(statusError, fmt.Sprintf("editor failed: %v", err))
+			return m, nil
+		}
+		m.setStatus(statusInfo, fmt.Sprintf("editing %s...", m.configPath))
+		cmd := exec.Command(argv[0], append(argv[1:], m.configPath)...)
+		return m, tea.ExecProcess(cmd, func(err error) tea.Msg {
+			return editorClosedMsg{err: err}
+		})
 	}
 
 	return m, nil
 }
 
-func (m *Model) cycleFocus() {
+// setStatus shows text in the status bar and records it for the messages
+// overlay, keeping the newest statusHistoryLimit entries.
+func (m *Model) setStatus(level statusLevel, text string) {
+	m.statusLevel = level
+	m.status = text
+	m.statusHistory = append(m.statusHistory, statusEntry{at: time.Now(), level: level, text: text})
+	if len(m.statusHistory) > statusHistoryLimit {
+		m.statusHistory = m.statusHistory[len(m.statusHistory)-statusHistoryLimit:]
+	}
+}
+
+// stepRefreshInterval moves refreshIn to the next longer (delta > 0) or
+// shorter interval, clamped to the ends of refreshIntervals. The new interval
+// applies from the next tick.
+func (m *Model) stepRefreshInterval(delta int) {
+	i := 0
+	for i < len(refreshIntervals)-1 && refreshIntervals[i] < m.refreshIn {
+		i++
+	}
+	i += delta
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(refreshIntervals) {
+		i = len(refreshIntervals) - 1
+	}
+	m.refreshIn = refreshIntervals[i]
+	m.setStatus(statusInfo, fmt.Sprintf("refresh every %s", m.refreshIn))
+}
+
+// cycleFocus moves focus to the next (delta > 0) or previous pane, wrapping.
+func (m *Model) cycleFocus(delta int) {
+	panes := []Pane{PaneTargets, PaneSessions, PaneLogs}
+	i := 0
+	for i < len(panes) && panes[i] != m.focused {
+		i++
+	}
+	m.focused = panes[(i+delta%len(panes)+len(panes))%len(panes)]
+}
+
+// jumpToCounterpart moves focus from the selected target to its session, or
+// from the selected session back to its target. It reports whether focus
+// moved; otherwise the status says why.
+func (m *Model) jumpToCounterpart() bool {
 	switch m.focused {
 	case PaneTargets:
-		m.focused = PaneSessions
+		if len(m.targets) == 0 {
+			return false
+		}
+		target := m.targets[m.targetSelected].Key
+		for i, s := range m.sessions {
+			if targetOwnsSession(target, s.Key) {
+				m.focused = PaneSessions
+				m.sessionSelected = i
+				m.setStatus(statusInfo, fmt.Sprintf("%s: jumped to session", s.Key))
+				return true
+			}
+		}
+		m.setStatus(statusWarn, fmt.Sprintf("%s: no session", target))
 	case PaneSessions:
-		m.focused = PaneLogs
-	default:
-		m.focused = PaneTargets
+		if len(m.sessions) == 0 {
+			return false
+		}
+		key := m.sessions[m.sessionSelected].Key
+		for i, t := range m.targets {
+			if targetOwnsSession(t.Key, key) {
+				m.focused = PaneTargets
+				m.targetSelected = i
+				m.syncTargetViewport()
+				m.setStatus(statusInfo, fmt.Sprintf("%s: jumped to target", t.Key))
+				return true
+			}
+		}
+		m.setStatus(statusWarn, fmt.Sprintf("%s: target no longer configured", key))
 	}
+	return false
 }
 
 func (m *Model) moveSelection(delta int) {
@@ -321,6 +639,27 @@ func (m *Model) moveSelection(delta int) {
 	}
 }
 
+// mergeSessions adds or replaces sessions in the list, keeping it sorted by
+// key as List returns it, and resyncs the panes.
+func (m *Model) mergeSessions(summaries []session.SessionSummary) {
+	if len(summaries) == 0 {
+		return
+	}
+	for _, summary := range summaries {
+		i := sort.Search(len(m.sessions), func(i int) bool { return m.sessions[i].Key >= summary.Key })
+		if i < len(m.sessions) && m.sessions[i].Key == summary.Key {
+			m.sessions[i] = summary
+			continue
+		}
+		m.sessions = append(m.sessions, session.SessionSummary{})
+		copy(m.sessions[i+1:], m.sessions[i:])
+		m.sessions[i] = summary
+	}
+	m.clampSelections()
+	m.syncTargetViewport()
+	m.syncLogs(false)
+}
+
 func (m *Model) clampSelections() {
 	if len(m.targets) == 0 {
 		m.targetSelected = 0
@@ -446,40 +785,56 @@ func (m *Model) syncLogs(force bool) {
 		return
 	}
 
-	lines, err := m.manager.LastLogs(key, m.logLines)
-	if err != nil {
-		m.closeLogSubscription()
-		m.logBuffer = nil
-		m.statusLevel = statusError
-		m.status = fmt.Sprintf("%s: failed to load logs: %v", key, err)
-		return
-	}
-	m.logBuffer = lines
-
-	if !m.logFollow {
+	if m.logFollow {
+		if m.logSubID != 0 && m.logSubKey == key && m.logSubCh != nil {
+			return
+		}
 		m.closeLogSubscription()
+		m.followLogs(key)
 		return
 	}
 
-	if m.logSubID != 0 && m.logSubKey == key && m.logSubCh != nil {
+	m.closeLogSubscription()
+	lines, err := m.manager.LastLogs(key, m.logLines)
+	if err != nil {
+		m.logBuffer = nil
+		m.setStatus(statusError, fmt.Sprintf("%s: failed to load logs: %v", key, err))
 		return
 	}
+	m.logBuffer = lines
+}
 
-	m.closeLogSubscription()
-
-	subID, ch, err := m.manager.SubscribeLogs(key, 64)
+// followLogs subscribes to key with a replay of the last logLines lines and
+// moves whatever is already queued into the log buffer, so the pane fills at
+// once and the reader only sees lines that follow.
+func (m *Model) followLogs(key session.SessionKey) {
+	subID, ch, err := m.manager.SubscribeLogsWithReplay(key, m.logLines, 64, session.DropNewest)
 	if err != nil {
+		m.logBuffer = nil
 		m.logSubKey = ""
 		m.logSubID = 0
 		m.logSubCh = nil
-		m.statusLevel = statusError
-		m.status = fmt.Sprintf("%s: failed to follow logs: %v", key, err)
+		m.setStatus(statusError, fmt.Sprintf("%s: failed to follow logs: %v", key, err))
 		return
 	}
 
+	m.logBuffer = nil
 	m.logSubKey = key
 	m.logSubID = subID
 	m.logSubCh = ch
+	for {
+		select {
+		case entry, ok := <-ch:
+			if !ok {
+				m.logSubID = 0
+				m.logSubCh = nil
+				return
+			}
+			m.logBuffer = append(m.logBuffer, entry)
+		default:
+			return
+		}
+	}
 }
 
 func (m *Model) hasSessionForKey(key session.SessionKey) bool {
@@ -491,6 +846,42 @@ func (m *Model) hasSessionForKey(key session.SessionKey) bool {
 	return false
 }
 
+// targetOwnsSession reports whether a session key belongs to a target: the
+// target's own key, or one of its named forwards ("svc/env:db").
+func targetOwnsSession(target, key session.SessionKey) bool {
+	return key == target || strings.HasPrefix(string(key), string(target)+":")
+}
+
+// targetState is the state of the target's sessions, the most urgent one
+// winning for multi-port envs (error, then starting, then running). ok is
+// false when the target has no session.
+func (m Model) targetState(target session.SessionKey) (session.SessionState, bool) {
+	state, ok := session.SessionState(""), false
+	for _, s := range m.sessions {
+		if !targetOwnsSession(target, s.Key) {
+			continue
+		}
+		if !ok || stateUrgency(s.State) > stateUrgency(state) {
+			state = s.State
+		}
+		ok = true
+	}
+	return state, ok
+}
+
+func stateUrgency(state session.SessionState) int {
+	switch state {
+	case session.SessionStateError:
+		return 3
+	case session.SessionStateStarting:
+		return 2
+	case session.SessionStateRunning:
+		return 1
+	default:
+		return 0
+	}
+}
+
 func (m Model) connectSelectedCmd() tea.Cmd {
 	if m.manager == nil || len(m.targets) == 0 {
 		return nil
@@ -504,33 +895,94 @@ func (m Model) connectSelectedCmd() tea.Cmd {
 		}
 	}
 
-	opts := session.StartOptions{
-		Service:          target.Service,
-		Env:              target.Env,
-		Bind:             m.defaults.Bind,
-		TargetInstanceID: envCfg.TargetInstanceID,
-		RemoteHost:       envCfg.RemoteHost,
-		RemotePort:       envCfg.RemotePort,
-		Region:           m.defaults.Region,
-		Profile:          m.defaults.Profile,
-		StartupTimeout:   time.Duration(m.defaults.StartupTimeoutSeconds) * time.Second,
+	readyBanner, err := m.defaults.ReadyBannerPattern()
+	if err != nil {
+		return func() tea.Msg {
+			return connectResultMsg{key: target.Key, err: fmt.Errorf("defaults.ready_banner: %w", err)}
+		}
 	}
-	if envCfg.LocalPort > 0 {
-		opts.LocalPort = envCfg.LocalPort
+
+	if bind := envCfg.BindAddress(m.defaults); !config.IsLoopbackBind(bind) && !m.allowPublicBind {
+		return func() tea.Msg {
+			return connectResultMsg{key: target.Key, err: fmt.Errorf("bind %s is not a loopback address; restart with --allow-public-bind to proceed", bind)}
+		}
 	}
-	if len(m.defaults.PortRange) == 2 {
-		opts.PortMin = m.defaults.PortRange[0]
-		opts.PortMax = m.defaults.PortRange[1]
+
+	forwards := envCfg.Forwards()
+	preHook, postHook := envCfg.Hooks(m.defaults)
+	optsList := make([]session.StartOptions, 0, len(forwards))
+	for i, fwd := range forwards {
+		opts := session.StartOptions{
+			Service:               target.Service,
+			Env:                   fwd.EnvName(target.Env),
+			Bind:                  envCfg.BindAddress(m.defaults),
+			TargetInstanceID:      envCfg.TargetInstanceID,
+			TargetTag:             envCfg.TargetTag,
+			TargetCacheTTL:        m.defaults.TargetCacheTTLDuration(),
+			RemoteHost:            envCfg.RemoteHost,
+			RemotePort:            fwd.RemotePort,
+			Region:                m.defaults.Region,
+			Profile:               m.defaults.Profile,
+			StartupTimeout:        m.defaults.StartupTimeout(),
+			ReadinessPollInterval: m.defaults.ReadyPollIntervalDuration(),
+			ReadinessRetries:      m.defaults.ReadyRetryLimit(),
+			SSMAssignedPort:       m.defaults.AutoPort == config.AutoPortSSM,
+			SkipReadiness:         m.cfg != nil && m.defaults.StartupTimeout() == 0,
+			ReadyBanner:           readyBanner,
+			BannerOnly:            m.defaults.ReadyCheck == config.ReadyCheckBanner,
+			NoPortReuse:           m.defaults.PortReuseDisabled(),
+			PortStrategy:          session.PortStrategy(m.defaults.PortStrategy),
+			IdleTimeout:           m.defaults.IdleTimeoutDuration(),
+			TTL:                   envCfg.TTL(m.defaults),
+			ProcessEnv:            envCfg.ProcessEnv(m.defaults, m.envFileVars),
+			RedactLogs:            m.defaults.LogRedactionEnabled(),
+			CommandWrapper:        m.defaults.CommandWrapper,
+			StopSignal:            session.StopSignal(m.defaults.StopSignal),
+			// Pressing c on a connected target is usually an accident, so
+			// it just reports the existing endpoint.
+			ReuseExisting: true,
+		}
+		// Hooks belong to the env, so only its first forward runs them.
+		if i == 0 {
+			opts.PreConnectHook = preHook
+			opts.PostStopHook = postHook
+		}
+		if fwd.LocalPort > 0 {
+			opts.LocalPort = fwd.LocalPort
+		}
+		if len(m.defaults.PortRange) == 2 {
+			opts.PortMin = m.defaults.PortRange[0]
+			opts.PortMax = m.defaults.PortRange[1]
+		}
+		optsList = append(optsList, opts)
 	}
 
 	return func() tea.Msg {
-		s, err := m.manager.Start(opts)
-		if err != nil {
-			return connectResultMsg{key: target.Key, err: err}
+		endpoints := make([]string, 0, len(optsList))
+		started := make([]session.SessionKey, 0, len(optsList))
+		summaries := make([]session.SessionSummary, 0, len(optsList))
+		for _, opts := range optsList {
+			s, err := m.manager.Start(opts)
+			if err != nil {
+				for _, key := range started {
+					_ = m.manager.Stop(key)
+				}
+				return connectResultMsg{key: target.Key, err: err}
+			}
+			// Only roll back what this connect started, not sessions
+			// that were already running.
+			if !s.Reused {
+				started = append(started, s.Key)
+			}
+			endpoints = append(endpoints, fmt.Sprintf("%s:%d", s.Bind, s.LocalPort))
+			if summary, ok := m.manager.Summary(s.Key); ok {
+				summaries = append(summaries, summary)
+			}
 		}
 		return connectResultMsg{
 			key:      target.Key,
-			endpoint: fmt.Sprintf("%s:%d", s.Bind, s.LocalPort),
+			endpoint: strings.Join(endpoints, ", "),
+			sessions: summaries,
 		}
 	}
 }
@@ -549,6 +1001,97 @@ func (m Model) stopSelectedCmd() tea.Cmd {
 	}
 }
 
+func (m Model) openPagerCmd(key session.SessionKey) (tea.Cmd, error) {
+	entries, err := m.manager.LastLogs(key, session.DefaultRingBufferLines)
+	if err != nil {
+		return nil, err
+	}
+	// The pager has no colors, so stderr is told apart by its [err] tag.
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		lines = append(lines, entry.String())
+	}
+
+	argv, err := pagerCommand(os.Getenv("PAGER"))
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.CreateTemp("", "dbx-logs-*.log")
+	if err != nil {
+		return nil, fmt.Errorf("create temp file: %w", err)
+	}
+	path := f.Name()
+	content := strings.Join(lines, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	if _, err := f.WriteString(content); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return nil, fmt.Errorf("write temp file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(path)
+		return nil, fmt.Errorf("write temp file: %w", err)
+	}
+
+	cmd := exec.Command(argv[0], append(argv[1:], path)...)
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		_ = os.Remove(path)
+		return pagerClosedMsg{key: key, err: err}
+	}), nil
+}
+
+// pagerCommand resolves the pager argv from $PAGER, falling back to less, then more.
+func pagerCommand(pagerEnv string) ([]string, error) {
+	argv, ok := resolveCommand([]string{pagerEnv}, pagerFallback)
+	if !ok {
+		return nil, errors.New("no pager found; set $PAGER or install less")
+	}
+	return argv, nil
+}
+
+// editorCommand resolves the editor argv from $VISUAL or $EDITOR, falling back to vi, then nano.
+func editorCommand(visualEnv, editorEnv string) ([]string, error) {
+	argv, ok := resolveCommand([]string{visualEnv, editorEnv}, editorFallback)
+	if !ok {
+		return nil, errors.New("no editor found; set $EDITOR")
+	}
+	return argv, nil
+}
+
+func resolveCommand(envValues []string, fallbacks []string) ([]string, bool) {
+	for _, value := range envValues {
+		if fields := strings.Fields(value); len(fields) > 0 {
+			return fields, true
+		}
+	}
+	for _, name := range fallbacks {
+		if path, err := lookPathFn(name); err == nil {
+			return []string{path}, true
+		}
+	}
+	return nil, false
+}
+
+func (m Model) reloadConfigCmd() tea.Cmd {
+	reload := m.reloadConfig
+	return func() tea.Msg {
+		cfg, err := reload()
+		return configReloadedMsg{cfg: cfg, err: err}
+	}
+}
+
+func (m *Model) applyConfig(cfg *config.Config) {
+	m.cfg = cfg
+	m.defaults = cfg.EffectiveDefaults()
+	m.keys = keyMapFor(cfg)
+	m.logWrap = cfg.UI.LogWrapEnabled()
+	m.targets = configuredTargets(cfg, m.pinned)
+	m.clampSelections()
+}
+
 func (m Model) stopAllCmd() tea.Cmd {
 	return func() tea.Msg {
 		return stopAllResultMsg{err: m.manager.StopAll()}
@@ -575,7 +1118,7 @@ func (m Model) currentLogKey() (session.SessionKey, bool) {
 		if len(m.targets) == 0 {
 			return "", false
 		}
-		return m.targets[m.targetSelected].Key, true
+		return m.targetLogKey(m.targets[m.targetSelected].Key), true
 	case PaneSessions:
 		if len(m.sessions) == 0 {
 			return "", false
@@ -586,12 +1129,28 @@ func (m Model) currentLogKey() (session.SessionKey, bool) {
 			return m.sessions[m.sessionSelected].Key, true
 		}
 		if len(m.targets) > 0 {
-			return m.targets[m.targetSelected].Key, true
+			return m.targetLogKey(m.targets[m.targetSelected].Key), true
 		}
 	}
 	return "", false
 }
 
+// targetLogKey is the session whose logs a target shows: the target's own
+// session, or the first of its named forwards for a multi-port env.
+func (m Model) targetLogKey(target session.SessionKey) session.SessionKey {
+	for _, s := range m.sessions {
+		if s.Key == target {
+			return target
+		}
+	}
+	for _, s := range m.sessions {
+		if targetOwnsSession(target, s.Key) {
+			return s.Key
+		}
+	}
+	return target
+}
+
 func (m *Model) closeLogSubscription() {
 	if m.logSubID != 0 && m.manager != nil {
 		m.manager.UnsubscribeLogs(m.logSubKey, m.logSubID)
@@ -599,19 +1158,20 @@ func (m *Model) closeLogSubscription() {
 	m.logSubKey = ""
 	m.logSubID = 0
 	m.logSubCh = nil
+	m.logDropped = 0
 	m.logReadActive = false
 }
 
-func (m Model) logReadCmd(key session.SessionKey, subID uint64, ch <-chan string) tea.Cmd {
+func (m Model) logReadCmd(key session.SessionKey, subID uint64, ch <-chan session.LogEntry) tea.Cmd {
 	if ch == nil || subID == 0 {
 		return nil
 	}
 	return func() tea.Msg {
-		line, ok := <-ch
+		entry, ok := <-ch
 		if !ok {
 			return logLineMsg{key: key, subID: subID, closed: true}
 		}
-		return logLineMsg{key: key, subID: subID, line: line}
+		return logLineMsg{key: key, subID: subID, entry: entry}
 	}
 }
 
@@ -640,25 +1200,69 @@ func findEnvConfig(cfg *config.Config, serviceName, envName string) (config.EnvC
 	return config.EnvConfig{}, fmt.Errorf("%s/%s: service not found in config", serviceName, envName)
 }
 
-func configuredTargets(cfg *config.Config) []Target {
-	if cfg == nil {
-		return nil
+// configuredTargets lists the targets of cfg in key order, with pinned ones
+// first.
+func configuredTargets(cfg *config.Config, pinned map[session.SessionKey]bool) []Target {
+	var targets []Target
+	for _, t := range cfg.Targets() {
+		targets = append(targets, Target{
+			Service: t.Service,
+			Env:     t.Env,
+			Key:     session.NewSessionKey(t.Service, t.Env),
+		})
 	}
+	sort.SliceStable(targets, func(i, j int) bool {
+		return pinned[targets[i].Key] && !pinned[targets[j].Key]
+	})
+	return targets
+}
 
-	targets := make([]Target, 0, len(cfg.Services))
-	for _, svc := range cfg.Services {
-		for envName := range svc.Envs {
-			targets = append(targets, Target{
-				Service: svc.Name,
-				Env:     envName,
-				Key:     session.NewSessionKey(svc.Name, envName),
-			})
+// togglePin pins or unpins the selected target, keeps it selected at its new
+// position and saves the pins to the state file.
+func (m *Model) togglePin() {
+	key := m.currentTargetKey()
+	if key == "" {
+		m.setStatus(statusWarn, "no target selected")
+		return
+	}
+	if m.pinned == nil {
+		m.pinned = make(map[session.SessionKey]bool)
+	}
+	if m.pinned[key] {
+		delete(m.pinned, key)
+	} else {
+		m.pinned[key] = true
+	}
+
+	m.targets = configuredTargets(m.cfg, m.pinned)
+	for i, t := range m.targets {
+		if t.Key == key {
+			m.targetSelected = i
+			break
 		}
 	}
+	m.syncTargetViewport()
 
-	sort.Slice(targets, func(i, j int) bool {
-		return targets[i].Key < targets[j].Key
-	})
+	if err := m.saveState(); err != nil {
+		m.setStatus(statusWarn, fmt.Sprintf("%s: pin not saved: %v", key, err))
+		return
+	}
+	if m.pinned[key] {
+		m.setStatus(statusInfo, fmt.Sprintf("%s: pinned", key))
+	} else {
+		m.setStatus(statusInfo, fmt.Sprintf("%s: unpinned", key))
+	}
+}
 
-	return targets
+func (m Model) saveState() error {
+	state := uistate.State{
+		Focused:        string(m.focused),
+		SelectedTarget: string(m.currentTargetKey()),
+		Follow:         m.logFollow,
+	}
+	for key := range m.pinned {
+		state.Pinned = append(state.Pinned, string(key))
+	}
+	sort.Strings(state.Pinned)
+	return uistate.Save(m.statePath, state)
 }
@@ -1,25 +1,32 @@
 package ui
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/fredyranthun/db/internal/config"
 	"github.com/fredyranthun/db/internal/session"
+	"github.com/fredyranthun/db/internal/uistate"
 )
 
 type fakeManager struct {
 	listSessions []session.SessionSummary
+	stopped      []session.SessionSummary
 	logs         map[session.SessionKey][]string
 
 	startCalls []session.StartOptions
 	stopCalls  []session.SessionKey
+	started    map[session.SessionKey]session.SessionSummary
 
 	nextSubID uint64
-	subs      map[session.SessionKey]map[uint64]chan string
+	subs      map[session.SessionKey]map[uint64]chan session.LogEntry
 	unsubbed  map[session.SessionKey][]uint64
+	dropped   map[session.SessionKey]uint64
 }
 
 type strictManager struct {
@@ -33,8 +40,9 @@ func newStrictManager() *strictManager {
 func newFakeManager() *fakeManager {
 	return &fakeManager{
 		logs:     map[session.SessionKey][]string{},
-		subs:     map[session.SessionKey]map[uint64]chan string{},
+		subs:     map[session.SessionKey]map[uint64]chan session.LogEntry{},
 		unsubbed: map[session.SessionKey][]uint64{},
+		dropped:  map[session.SessionKey]uint64{},
 	}
 }
 
@@ -44,7 +52,21 @@ func (f *fakeManager) List() []session.SessionSummary {
 	return out
 }
 
-func (f *fakeManager) Start(opts session.StartOptions) (*session.Session, error) {
+func (f *fakeManager) RecentlyStopped() []session.SessionSummary {
+	return f.stopped
+}
+
+func (f *fakeManager) Summary(key session.SessionKey) (session.SessionSummary, bool) {
+	for _, s := range f.listSessions {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	s, ok := f.started[key]
+	return s, ok
+}
+
+func (f *fakeManager) Start(opts session.StartOptions) (session.SessionSnapshot, error) {
 	f.startCalls = append(f.startCalls, opts)
 	s := session.NewSession(opts.Service, opts.Env)
 	s.Bind = opts.Bind
@@ -53,7 +75,11 @@ func (f *fakeManager) Start(opts session.StartOptions) (*session.Session, error)
 	} else {
 		s.LocalPort = opts.LocalPort
 	}
-	return s, nil
+	if f.started == nil {
+		f.started = map[session.SessionKey]session.SessionSummary{}
+	}
+	f.started[s.Key] = session.SessionSummary{Key: s.Key, Service: s.Service, Env: s.Env, Bind: s.Bind, LocalPort: s.LocalPort, State: session.SessionStateRunning}
+	return s.Snapshot(), nil
 }
 
 func (f *fakeManager) Stop(key session.SessionKey) error {
@@ -65,7 +91,7 @@ func (f *fakeManager) StopAll() error {
 	return nil
 }
 
-func (f *fakeManager) LastLogs(key session.SessionKey, n int) ([]string, error) {
+func (f *fakeManager) LastLogs(key session.SessionKey, n int) ([]session.LogEntry, error) {
 	lines := f.logs[key]
 	if n <= 0 || len(lines) == 0 {
 		return nil, nil
@@ -73,21 +99,27 @@ func (f *fakeManager) LastLogs(key session.SessionKey, n int) ([]string, error)
 	if n > len(lines) {
 		n = len(lines)
 	}
-	out := make([]string, n)
-	copy(out, lines[len(lines)-n:])
+	out := make([]session.LogEntry, 0, n)
+	for _, line := range lines[len(lines)-n:] {
+		out = append(out, session.LogEntry{Source: session.LogSourceStdout, Line: line})
+	}
 	return out, nil
 }
 
-func (f *fakeManager) SubscribeLogs(key session.SessionKey, buffer int) (uint64, <-chan string, error) {
+func (f *fakeManager) SubscribeLogsWithReplay(key session.SessionKey, n, buffer int, policy session.DropPolicy) (uint64, <-chan session.LogEntry, error) {
+	replay, _ := f.LastLogs(key, n)
 	if buffer < 0 {
 		buffer = 0
 	}
 	f.nextSubID++
 	id := f.nextSubID
 	if _, ok := f.subs[key]; !ok {
-		f.subs[key] = map[uint64]chan string{}
+		f.subs[key] = map[uint64]chan session.LogEntry{}
+	}
+	ch := make(chan session.LogEntry, len(replay)+buffer)
+	for _, entry := range replay {
+		ch <- entry
 	}
-	ch := make(chan string, buffer)
 	f.subs[key][id] = ch
 	return id, ch, nil
 }
@@ -106,6 +138,13 @@ func (f *fakeManager) UnsubscribeLogs(key session.SessionKey, id uint64) {
 	f.unsubbed[key] = append(f.unsubbed[key], id)
 }
 
+func (f *fakeManager) SubscriberStats(key session.SessionKey, id uint64) (session.SubscriberStats, error) {
+	if _, ok := f.subs[key][id]; !ok {
+		return session.SubscriberStats{}, fmt.Errorf("%s: subscriber %d not found", key, id)
+	}
+	return session.SubscriberStats{Dropped: f.dropped[key]}, nil
+}
+
 func (f *fakeManager) activeSubscriptions() int {
 	total := 0
 	for _, byKey := range f.subs {
@@ -114,7 +153,7 @@ func (f *fakeManager) activeSubscriptions() int {
 	return total
 }
 
-func (f *fakeManager) firstActive(key session.SessionKey) (uint64, chan string, bool) {
+func (f *fakeManager) firstActive(key session.SessionKey) (uint64, chan session.LogEntry, bool) {
 	byKey, ok := f.subs[key]
 	if !ok {
 		return 0, nil, false
@@ -125,18 +164,18 @@ func (f *fakeManager) firstActive(key session.SessionKey) (uint64, chan string,
 	return 0, nil, false
 }
 
-func (s *strictManager) LastLogs(key session.SessionKey, n int) ([]string, error) {
+func (s *strictManager) LastLogs(key session.SessionKey, n int) ([]session.LogEntry, error) {
 	if !s.hasSession(key) {
 		return nil, fmt.Errorf("%s: session not found", key)
 	}
 	return s.fakeManager.LastLogs(key, n)
 }
 
-func (s *strictManager) SubscribeLogs(key session.SessionKey, buffer int) (uint64, <-chan string, error) {
+func (s *strictManager) SubscribeLogsWithReplay(key session.SessionKey, n, buffer int, policy session.DropPolicy) (uint64, <-chan session.LogEntry, error) {
 	if !s.hasSession(key) {
 		return 0, nil, fmt.Errorf("%s: session not found", key)
 	}
-	return s.fakeManager.SubscribeLogs(key, buffer)
+	return s.fakeManager.SubscribeLogsWithReplay(key, n, buffer, policy)
 }
 
 func (s *strictManager) hasSession(key session.SessionKey) bool {
@@ -153,7 +192,7 @@ func testConfig() *config.Config {
 		Defaults: config.Defaults{
 			Bind:                  "127.0.0.1",
 			PortRange:             []int{5500, 5599},
-			StartupTimeoutSeconds: 5,
+			StartupTimeoutSeconds: config.Int(5),
 		},
 		Services: []config.Service{
 			{
@@ -186,7 +225,7 @@ func manyTargetsConfig(total int) *config.Config {
 		Defaults: config.Defaults{
 			Bind:                  "127.0.0.1",
 			PortRange:             []int{5500, 5599},
-			StartupTimeoutSeconds: 5,
+			StartupTimeoutSeconds: config.Int(5),
 		},
 		Services: []config.Service{
 			{
@@ -211,6 +250,15 @@ func keyMsg(v string) tea.KeyMsg {
 	if v == "tab" {
 		return tea.KeyMsg(tea.Key{Type: tea.KeyTab})
 	}
+	if v == " " {
+		return tea.KeyMsg(tea.Key{Type: tea.KeySpace, Runes: []rune(v)})
+	}
+	if v == "enter" {
+		return tea.KeyMsg(tea.Key{Type: tea.KeyEnter})
+	}
+	if v == "esc" {
+		return tea.KeyMsg(tea.Key{Type: tea.KeyEsc})
+	}
 	return tea.KeyMsg(tea.Key{Type: tea.KeyRunes, Runes: []rune(v)})
 }
 
@@ -248,6 +296,151 @@ func TestModelKeyHandlingFocusAndSelection(t *testing.T) {
 	}
 }
 
+func TestModelPinSortsTargetsAndPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ui-state.json")
+	m := NewModel(newFakeManager(), testConfig()).WithStateFile(path)
+
+	m, _ = updateModel(t, m, keyMsg("j"))
+	m, _ = updateModel(t, m, keyMsg("p"))
+	if m.targets[0].Key != "service2/qa" || m.targetSelected != 0 {
+		t.Fatalf("expected pinned service2/qa first and still selected, got %v (selected %d)", m.targets, m.targetSelected)
+	}
+	if !strings.Contains(RenderPlain(m), "service2/qa ★") {
+		t.Fatalf("expected a pin marker, got:\n%s", RenderPlain(m))
+	}
+
+	state, err := uistate.Load(path)
+	if err != nil || len(state.Pinned) != 1 || state.Pinned[0] != "service2/qa" {
+		t.Fatalf("expected the pin to be saved, got %+v (%v)", state, err)
+	}
+
+	reopened := NewModel(newFakeManager(), testConfig()).WithStateFile(path)
+	if reopened.targets[0].Key != "service2/qa" {
+		t.Fatalf("expected the pin to survive a restart, got %v", reopened.targets)
+	}
+
+	m, _ = updateModel(t, m, keyMsg("p"))
+	if m.targets[0].Key != "service1/dev" || m.targetSelected != 1 {
+		t.Fatalf("expected unpinned target back in key order and still selected, got %v (selected %d)", m.targets, m.targetSelected)
+	}
+}
+
+func TestModelRestoresFocusSelectionAndFollow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ui-state.json")
+	m := NewModel(newFakeManager(), testConfig()).WithStateFile(path)
+	m, _ = updateModel(t, m, keyMsg("j"))
+	m, _ = updateModel(t, m, keyMsg("l"))
+	m, _ = updateModel(t, m, keyMsg("tab"))
+	m, _ = updateModel(t, m, keyMsg("q"))
+
+	reopened := NewModel(newFakeManager(), testConfig()).WithStateFile(path)
+	if reopened.focused != PaneSessions || reopened.currentTargetKey() != "service2/qa" || !reopened.logFollow {
+		t.Fatalf("expected sessions focus, service2/qa selected and follow on, got %s, %s, %t", reopened.focused, reopened.currentTargetKey(), reopened.logFollow)
+	}
+
+	if err := uistate.Save(path, uistate.State{Focused: "bogus", SelectedTarget: "gone/prod"}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	stale := NewModel(newFakeManager(), testConfig()).WithStateFile(path)
+	if stale.focused != PaneTargets || stale.targetSelected != 0 {
+		t.Fatalf("expected defaults for an unknown pane and target, got %s, %d", stale.focused, stale.targetSelected)
+	}
+}
+
+func TestModelEnterJumpsBetweenTargetAndSession(t *testing.T) {
+	m := NewModel(newFakeManager(), testConfig())
+	m.sessions = []session.SessionSummary{
+		{Key: session.NewSessionKey("service1", "dev"), State: session.SessionStateRunning},
+		{Key: session.NewSessionKey("service2", "qa"), State: session.SessionStateRunning},
+	}
+
+	m, _ = updateModel(t, m, keyMsg("j"))
+	m, _ = updateModel(t, m, keyMsg("enter"))
+	if m.focused != PaneSessions || m.sessionSelected != 1 {
+		t.Fatalf("expected jump to session 1, got focus=%s selected=%d", m.focused, m.sessionSelected)
+	}
+
+	m, _ = updateModel(t, m, keyMsg("k"))
+	m, _ = updateModel(t, m, keyMsg("enter"))
+	if m.focused != PaneTargets || m.targetSelected != 0 {
+		t.Fatalf("expected jump back to target 0, got focus=%s selected=%d", m.focused, m.targetSelected)
+	}
+
+	m.sessions = m.sessions[1:]
+	m, _ = updateModel(t, m, keyMsg("enter"))
+	if m.focused != PaneTargets || m.statusLevel != statusWarn || !strings.Contains(m.status, "no session") {
+		t.Fatalf("expected a warning for a target without a session, got focus=%s status=%q", m.focused, m.status)
+	}
+}
+
+func TestModelHandleKeyUsesConfiguredKeys(t *testing.T) {
+	cfg := testConfig()
+	cfg.UI.Keys = map[string][]string{"down": {"n"}, "focus_next": {"L"}}
+	m := NewModel(newFakeManager(), cfg)
+
+	m, _ = updateModel(t, m, keyMsg("j"))
+	if m.targetSelected != 0 {
+		t.Fatalf("expected j to be unbound, got selection %d", m.targetSelected)
+	}
+	m, _ = updateModel(t, m, keyMsg("n"))
+	if m.targetSelected != 1 {
+		t.Fatalf("expected n to move down, got selection %d", m.targetSelected)
+	}
+	m, _ = updateModel(t, m, keyMsg("L"))
+	if m.focused != PaneSessions {
+		t.Fatalf("expected L to focus sessions, got %s", m.focused)
+	}
+	if !strings.Contains(renderHelpBar(m, 200), "n/k move") {
+		t.Fatalf("expected help bar to show the configured key, got %q", renderHelpBar(m, 200))
+	}
+}
+
+func TestModelHelpOverlayToggles(t *testing.T) {
+	m := NewModel(newFakeManager(), testConfig())
+
+	for _, closeKey := range []string{"?", "esc", "q"} {
+		m, _ = updateModel(t, m, keyMsg("?"))
+		if !m.showHelp {
+			t.Fatal("expected ? to open the help overlay")
+		}
+		m, _ = updateModel(t, m, keyMsg("j"))
+		if m.targetSelected != 0 {
+			t.Fatalf("expected the overlay to swallow j, got selection %d", m.targetSelected)
+		}
+		var cmd tea.Cmd
+		m, cmd = updateModel(t, m, keyMsg(closeKey))
+		if m.showHelp || cmd != nil {
+			t.Fatalf("expected %q to close the overlay without a command, got showHelp=%t cmd=%v", closeKey, m.showHelp, cmd != nil)
+		}
+	}
+}
+
+func TestModelKeepsBoundedStatusHistory(t *testing.T) {
+	m := NewModel(newFakeManager(), testConfig())
+
+	m, _ = updateModel(t, m, connectResultMsg{key: session.NewSessionKey("service1", "dev"), err: errors.New("boom")})
+	m, _ = updateModel(t, m, keyMsg("tab"))
+	if len(m.statusHistory) != 2 || !strings.Contains(m.statusHistory[0].text, "connect failed: boom") || m.statusHistory[0].level != statusError {
+		t.Fatalf("expected the overwritten connect error to be kept, got %+v", m.statusHistory)
+	}
+
+	for i := 0; i < statusHistoryLimit+5; i++ {
+		m.setStatus(statusInfo, fmt.Sprintf("msg-%d", i))
+	}
+	if len(m.statusHistory) != statusHistoryLimit || m.statusHistory[0].text != "msg-5" {
+		t.Fatalf("expected the oldest entries to be dropped, got %d entries starting %q", len(m.statusHistory), m.statusHistory[0].text)
+	}
+
+	m, _ = updateModel(t, m, keyMsg("m"))
+	if !m.showMessages || !strings.Contains(RenderView(m), "msg-104") {
+		t.Fatalf("expected m to open the messages overlay with the newest message")
+	}
+	m, _ = updateModel(t, m, keyMsg("esc"))
+	if m.showMessages {
+		t.Fatal("expected esc to close the messages overlay")
+	}
+}
+
 func TestModelTargetViewportScrollsWithSelection(t *testing.T) {
 	m := NewModel(newFakeManager(), manyTargetsConfig(15))
 	m.width = 120
@@ -316,6 +509,9 @@ func TestModelConnectAndStopDispatch(t *testing.T) {
 	if fm.startCalls[0].LocalPort != 55432 {
 		t.Fatalf("expected configured local port 55432, got %d", fm.startCalls[0].LocalPort)
 	}
+	if !fm.startCalls[0].ReuseExisting {
+		t.Fatal("expected UI connects to reuse an existing session")
+	}
 	if !strings.Contains(m.status, "connected") {
 		t.Fatalf("expected connected status, got %q", m.status)
 	}
@@ -334,6 +530,67 @@ func TestModelConnectAndStopDispatch(t *testing.T) {
 	}
 }
 
+func TestModelConnectShowsStartedSessionBeforeRefresh(t *testing.T) {
+	fm := newFakeManager()
+	existing := session.NewSessionKey("service2", "qa")
+	fm.listSessions = []session.SessionSummary{{Key: existing, State: session.SessionStateRunning}}
+
+	m := NewModel(fm, testConfig())
+	m, _ = updateModel(t, m, refreshTickMsg{sessions: fm.List()})
+
+	_, cmd := updateModel(t, m, keyMsg("c"))
+	m, _ = updateModel(t, m, cmd())
+
+	key := session.NewSessionKey("service1", "dev")
+	if len(m.sessions) != 2 || m.sessions[0].Key != key || m.sessions[1].Key != existing {
+		t.Fatalf("expected the started session merged in key order, got %+v", m.sessions)
+	}
+	if m.sessions[0].LocalPort != 55432 || m.sessions[0].State != session.SessionStateRunning {
+		t.Fatalf("expected the started session's summary, got %+v", m.sessions[0])
+	}
+}
+
+func TestModelShowsRecentlyStoppedSessionsWhenToggled(t *testing.T) {
+	fm := newFakeManager()
+	fm.listSessions = []session.SessionSummary{{Key: session.NewSessionKey("service1", "dev"), Bind: "127.0.0.1", LocalPort: 5501, State: session.SessionStateRunning}}
+	fm.stopped = []session.SessionSummary{{Key: session.NewSessionKey("service2", "qa"), Bind: "127.0.0.1", LocalPort: 5502, State: session.SessionStateError, LastError: "process exited: exit status 255", StoppedAt: time.Now().Add(-time.Minute)}}
+
+	m := NewModel(fm, testConfig())
+	m, _ = updateModel(t, m, m.refreshNowCmd()())
+	if strings.Contains(renderSessionsPane(m, 200), "service2/qa") {
+		t.Fatal("expected stopped sessions hidden by default")
+	}
+
+	m, _ = updateModel(t, m, keyMsg("a"))
+	view := renderSessionsPane(m, 200)
+	if !strings.Contains(view, "service2/qa") || !strings.Contains(view, "ended 1m") || !strings.Contains(view, "exit status 255") {
+		t.Fatalf("expected the stopped session with its error, got:\n%s", view)
+	}
+	if len(m.sessions) != 1 {
+		t.Fatalf("expected stopped sessions to stay out of the selectable list, got %+v", m.sessions)
+	}
+}
+
+func TestSessionsPaneShowsLastErrorOfSelectedSession(t *testing.T) {
+	fm := newFakeManager()
+	fm.listSessions = []session.SessionSummary{
+		{Key: session.NewSessionKey("service1", "dev"), State: session.SessionStateError, LastError: "TargetNotConnected"},
+		{Key: session.NewSessionKey("service2", "qa"), State: session.SessionStateError, LastError: "AccessDenied"},
+	}
+
+	m := NewModel(fm, testConfig())
+	m, _ = updateModel(t, m, refreshTickMsg{sessions: fm.List()})
+	m.sessionSelected = 1
+
+	view := renderSessionsPane(m, 120)
+	if !strings.Contains(view, "error: AccessDenied") {
+		t.Fatalf("expected the selected session's error, got:\n%s", view)
+	}
+	if strings.Contains(view, "TargetNotConnected") {
+		t.Fatalf("expected only the selected session's error, got:\n%s", view)
+	}
+}
+
 func TestModelConnectWithoutConfiguredLocalPortUsesRangePath(t *testing.T) {
 	fm := newFakeManager()
 	m := NewModel(fm, testConfig())
@@ -390,9 +647,9 @@ func TestModelFollowToggleAndSubscriptionLifecycle(t *testing.T) {
 	if !ok {
 		t.Fatalf("expected active subscription for %s", key1)
 	}
-	subCh <- "live-line"
+	subCh <- session.LogEntry{Line: "live-line"}
 	m, cmd = updateModel(t, m, cmd())
-	if got := m.logBuffer[len(m.logBuffer)-1]; got != "live-line" {
+	if got := m.logBuffer[len(m.logBuffer)-1].Line; got != "live-line" {
 		t.Fatalf("expected live log line appended, got %q", got)
 	}
 	if cmd == nil {
@@ -482,3 +739,292 @@ func TestModelFollowNoSessionDoesNotSetErrorOrSubscribe(t *testing.T) {
 		t.Fatalf("expected no subscriptions without active session, got %d", sm.activeSubscriptions())
 	}
 }
+
+func TestPagerCommandFallbacks(t *testing.T) {
+	prevLookPath := lookPathFn
+	defer func() { lookPathFn = prevLookPath }()
+
+	argv, err := pagerCommand("less -R")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(argv, " ") != "less -R" {
+		t.Fatalf("expected $PAGER argv to be used, got %v", argv)
+	}
+
+	lookPathFn = func(name string) (string, error) {
+		if name == "more" {
+			return "/bin/more", nil
+		}
+		return "", fmt.Errorf("%s not found", name)
+	}
+	argv, err = pagerCommand("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(argv) != 1 || argv[0] != "/bin/more" {
+		t.Fatalf("expected fallback to more, got %v", argv)
+	}
+
+	lookPathFn = func(name string) (string, error) {
+		return "", fmt.Errorf("%s not found", name)
+	}
+	if _, err := pagerCommand(""); err == nil {
+		t.Fatal("expected error when no pager is available")
+	}
+}
+
+func TestModelOpenPagerRequiresSession(t *testing.T) {
+	fm := newFakeManager()
+	m := NewModel(fm, testConfig())
+
+	m, cmd := updateModel(t, m, keyMsg("o"))
+	if cmd != nil {
+		t.Fatal("expected no pager cmd without a running session")
+	}
+	if m.statusLevel != statusWarn {
+		t.Fatalf("expected warn status, got %s (%q)", m.statusLevel, m.status)
+	}
+
+	key := session.NewSessionKey("service1", "dev")
+	fm.listSessions = []session.SessionSummary{{Key: key, State: session.SessionStateRunning}}
+	fm.logs[key] = []string{"a1"}
+	m, _ = updateModel(t, m, refreshTickMsg{sessions: fm.List()})
+	t.Setenv("PAGER", "cat")
+	t.Setenv("TMPDIR", t.TempDir())
+
+	m, cmd = updateModel(t, m, keyMsg("o"))
+	if cmd == nil {
+		t.Fatalf("expected pager cmd, status %q", m.status)
+	}
+	m, _ = updateModel(t, m, pagerClosedMsg{key: key})
+	if !strings.Contains(m.status, "pager closed") {
+		t.Fatalf("expected pager closed status, got %q", m.status)
+	}
+}
+
+func TestModelEditConfigReloadKeepsPreviousOnError(t *testing.T) {
+	m := NewModel(newFakeManager(), testConfig())
+
+	m, cmd := updateModel(t, m, keyMsg("e"))
+	if cmd != nil || m.statusLevel != statusWarn {
+		t.Fatalf("expected edit to be unavailable without reload hook, got %q", m.status)
+	}
+
+	reloaded := manyTargetsConfig(3)
+	var reloadErr error
+	m = m.WithConfigReload("/tmp/dbx-config.yml", func() (*config.Config, error) {
+		if reloadErr != nil {
+			return nil, reloadErr
+		}
+		return reloaded, nil
+	})
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "true")
+
+	m, cmd = updateModel(t, m, keyMsg("e"))
+	if cmd == nil {
+		t.Fatalf("expected editor cmd, status %q", m.status)
+	}
+
+	reloadErr = fmt.Errorf("services[0].name: must not be empty")
+	m, cmd = updateModel(t, m, editorClosedMsg{})
+	m, _ = updateModel(t, m, cmd())
+	if m.statusLevel != statusError || !strings.Contains(m.status, "keeping previous config") {
+		t.Fatalf("expected reload error status, got %s (%q)", m.statusLevel, m.status)
+	}
+	if len(m.targets) != 2 {
+		t.Fatalf("expected previous targets to stay active, got %d", len(m.targets))
+	}
+
+	reloadErr = nil
+	m, cmd = updateModel(t, m, editorClosedMsg{})
+	m, _ = updateModel(t, m, cmd())
+	if m.statusLevel != statusSuccess {
+		t.Fatalf("expected reload success, got %s (%q)", m.statusLevel, m.status)
+	}
+	if len(m.targets) != 3 {
+		t.Fatalf("expected reloaded targets, got %d", len(m.targets))
+	}
+}
+
+func TestModelWarningMsgSetsStatus(t *testing.T) {
+	m := NewModel(newFakeManager(), testConfig())
+	m, cmd := updateModel(t, m, WarningMsg{Text: "webhook for session.stop service1/dev failed: 500"})
+	if cmd != nil {
+		t.Fatal("expected no command for a warning")
+	}
+	if m.statusLevel != statusWarn || !strings.Contains(m.status, "webhook for session.stop") {
+		t.Fatalf("expected the warning in the status line, got %s %q", m.statusLevel, m.status)
+	}
+}
+
+func TestModelReloadConfigMsgSwapsTargetsAndKeepsSessions(t *testing.T) {
+	fm := newFakeManager()
+	key := session.NewSessionKey("service1", "dev")
+	fm.listSessions = []session.SessionSummary{{Key: key, State: session.SessionStateRunning}}
+
+	m := NewModel(fm, testConfig())
+	m, _ = updateModel(t, m, refreshTickMsg{sessions: fm.List()})
+
+	if _, cmd := updateModel(t, m, ReloadConfigMsg{}); cmd != nil {
+		t.Fatal("expected reload to be ignored without a reload hook")
+	}
+
+	m = m.WithConfigReload("/tmp/dbx-config.yml", func() (*config.Config, error) {
+		return manyTargetsConfig(4), nil
+	})
+	m, cmd := updateModel(t, m, ReloadConfigMsg{})
+	if cmd == nil {
+		t.Fatal("expected reload cmd")
+	}
+	m, _ = updateModel(t, m, cmd())
+
+	if len(m.targets) != 4 {
+		t.Fatalf("expected reloaded targets, got %d", len(m.targets))
+	}
+	if len(m.sessions) != 1 || m.sessions[0].Key != key {
+		t.Fatalf("expected running sessions to be untouched, got %v", m.sessions)
+	}
+	if len(fm.stopCalls) != 0 {
+		t.Fatalf("expected no stop calls on reload, got %v", fm.stopCalls)
+	}
+}
+
+func TestModelLogsPaneShowsDroppedLines(t *testing.T) {
+	fm := newFakeManager()
+	key := session.NewSessionKey("service1", "dev")
+	fm.listSessions = []session.SessionSummary{{Key: key, State: session.SessionStateRunning}}
+
+	m := NewModel(fm, testConfig())
+	m, _ = updateModel(t, m, refreshTickMsg{sessions: fm.List()})
+	m, cmd := updateModel(t, m, keyMsg("l"))
+
+	_, subCh, ok := fm.firstActive(key)
+	if !ok {
+		t.Fatalf("expected active subscription for %s", key)
+	}
+	fm.dropped[key] = 7
+	subCh <- session.LogEntry{Line: "live-line"}
+	m, _ = updateModel(t, m, cmd())
+
+	if m.logDropped != 7 {
+		t.Fatalf("expected 7 dropped lines, got %d", m.logDropped)
+	}
+	if view := RenderView(m); !strings.Contains(view, "(7 lines dropped)") {
+		t.Fatalf("expected dropped indicator in logs pane, got:\n%s", view)
+	}
+
+	m, _ = updateModel(t, m, keyMsg("l"))
+	if m.logDropped != 0 {
+		t.Fatalf("expected dropped counter reset when follow stops, got %d", m.logDropped)
+	}
+}
+
+func TestModelTargetShowsLogsOfFirstForward(t *testing.T) {
+	fm := newFakeManager()
+	fm.listSessions = []session.SessionSummary{
+		{Key: "service1/dev:db", State: session.SessionStateRunning},
+		{Key: "service1/dev:metrics", State: session.SessionStateRunning},
+	}
+	fm.logs["service1/dev:db"] = []string{"db-line"}
+
+	m := NewModel(fm, testConfig())
+	m, _ = updateModel(t, m, refreshTickMsg{sessions: fm.List()})
+
+	if key, _ := m.currentLogKey(); key != "service1/dev:db" {
+		t.Fatalf("expected the target to resolve to its first forward, got %q", key)
+	}
+	if len(m.logBuffer) != 1 || m.logBuffer[0].Line != "db-line" {
+		t.Fatalf("expected the forward's logs, got %+v", m.logBuffer)
+	}
+}
+
+func TestModelRefreshIntervalKeysClampToBounds(t *testing.T) {
+	m := NewModel(newFakeManager(), testConfig())
+
+	m, _ = updateModel(t, m, keyMsg("+"))
+	if m.refreshIn != 2*time.Second {
+		t.Fatalf("expected 2s after +, got %s", m.refreshIn)
+	}
+	for i := 0; i < 5; i++ {
+		m, _ = updateModel(t, m, keyMsg("+"))
+	}
+	if m.refreshIn != 5*time.Second {
+		t.Fatalf("expected interval clamped at 5s, got %s", m.refreshIn)
+	}
+	for i := 0; i < 10; i++ {
+		m, _ = updateModel(t, m, keyMsg("-"))
+	}
+	if m.refreshIn != 250*time.Millisecond {
+		t.Fatalf("expected interval clamped at 250ms, got %s", m.refreshIn)
+	}
+	if view := RenderView(m); !strings.Contains(view, "refresh=250ms") {
+		t.Fatalf("expected refresh interval in header, got:\n%s", view)
+	}
+}
+
+func TestModelSpacePausesPeriodicRefresh(t *testing.T) {
+	fm := newFakeManager()
+	key := session.NewSessionKey("service1", "dev")
+	fm.listSessions = []session.SessionSummary{{Key: key, State: session.SessionStateRunning}}
+
+	m := NewModel(fm, testConfig())
+	m, _ = updateModel(t, m, keyMsg(" "))
+	if !m.paused {
+		t.Fatal("expected refresh paused")
+	}
+	if view := RenderView(m); !strings.Contains(view, "refresh=PAUSED") {
+		t.Fatalf("expected PAUSED in header, got:\n%s", view)
+	}
+	if cmd := m.refreshCmd(); cmd != nil {
+		t.Fatal("expected no periodic refresh while paused")
+	}
+
+	m, cmd := updateModel(t, m, stopResultMsg{key: key})
+	if cmd == nil {
+		t.Fatal("expected a one-shot refresh after stop while paused")
+	}
+	m, cmd = updateModel(t, m, cmd())
+	if len(m.sessions) != 1 {
+		t.Fatalf("expected sessions from one-shot refresh, got %d", len(m.sessions))
+	}
+	if cmd != nil {
+		t.Fatal("expected the tick loop to stay stopped while paused")
+	}
+
+	m, cmd = updateModel(t, m, keyMsg(" "))
+	if m.paused || cmd == nil {
+		t.Fatalf("expected resume to refresh immediately, paused=%t", m.paused)
+	}
+	if _, cmd = updateModel(t, m, cmd()); cmd == nil {
+		t.Fatal("expected the tick loop to restart after resume")
+	}
+}
+
+func TestModelRefusesPublicBindUnlessAllowed(t *testing.T) {
+	cfg := testConfig()
+	env := cfg.Services[0].Envs["dev"]
+	env.Bind = "0.0.0.0"
+	cfg.Services[0].Envs["dev"] = env
+
+	fm := newFakeManager()
+	m := NewModel(fm, cfg)
+	_, cmd := updateModel(t, m, keyMsg("c"))
+	msg := cmd().(connectResultMsg)
+	if msg.err == nil || !strings.Contains(msg.err.Error(), "--allow-public-bind") {
+		t.Fatalf("expected public bind to be refused, got %v", msg.err)
+	}
+	if len(fm.startCalls) != 0 {
+		t.Fatalf("expected no start calls, got %d", len(fm.startCalls))
+	}
+
+	m = m.WithPublicBind(true)
+	_, cmd = updateModel(t, m, keyMsg("c"))
+	if msg := cmd().(connectResultMsg); msg.err != nil {
+		t.Fatalf("expected allowed public bind to connect, got %v", msg.err)
+	}
+	if len(fm.startCalls) != 1 || fm.startCalls[0].Bind != "0.0.0.0" {
+		t.Fatalf("expected a start on 0.0.0.0, got %+v", fm.startCalls)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/fredyranthun/db/internal/config"
 	"github.com/fredyranthun/db/internal/session"
 )
 
@@ -13,6 +15,14 @@ const (
 	defaultWidth           = 120
 	minWidth               = 72
 	narrowLayoutBreakpoint = 110
+	// minHeight fits the header, a short targets pane, the minimum logs
+	// pane and the status and help bars of the wide layout. Narrower
+	// terminals stack the panes and may need to scroll.
+	minHeight = 18
+	// paneChromeLines is the border and title around a pane's lines.
+	paneChromeLines = 3
+	// minLogLines keeps the logs pane usable on short terminals.
+	minLogLines = 6
 )
 
 var (
@@ -30,6 +40,9 @@ var (
 	mutedStyle          = lipgloss.NewStyle().Foreground(lipgloss.Color("245"))
 	selectionStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("117")).Bold(true)
 	helpKeyStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color("39")).Bold(true)
+	publicBindStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Bold(true)
+	stderrStyle         = lipgloss.NewStyle().Foreground(lipgloss.Color("203"))
+	pinStyle            = lipgloss.NewStyle().Foreground(lipgloss.Color("220"))
 
 	statusInfoStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("230")).Background(lipgloss.Color("31")).Padding(0, 1)
 	statusOKStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("231")).Background(lipgloss.Color("28")).Padding(0, 1)
@@ -38,13 +51,16 @@ var (
 )
 
 func RenderView(m Model) string {
+	// A size of 0 means the terminal has not reported one yet.
+	if (m.width > 0 && m.width < minWidth) || (m.height > 0 && m.height < minHeight) {
+		msg := fmt.Sprintf("terminal too small (need at least %dx%d)", minWidth, minHeight)
+		return lipgloss.Place(max(m.width, 1), max(m.height, 1), lipgloss.Center, lipgloss.Center, mutedStyle.Render(msg))
+	}
+
 	width := m.width
 	if width <= 0 {
 		width = defaultWidth
 	}
-	if width < minWidth {
-		width = minWidth
-	}
 
 	height := m.height
 	if height <= 0 {
@@ -52,45 +68,60 @@ func RenderView(m Model) string {
 	}
 
 	header := renderHeader(m, width)
-	body := renderBody(m, width, height)
+	if m.showHelp {
+		return lipgloss.JoinVertical(lipgloss.Left, header, renderHelpOverlay(m, width))
+	}
+	if m.showMessages {
+		return lipgloss.JoinVertical(lipgloss.Left, header, renderMessagesOverlay(m, width, height-3))
+	}
 	status := renderStatusBar(m, width)
-	help := renderHelpBar(width)
+	help := renderHelpBar(m, width)
+	bodyHeight := height - lipgloss.Height(header) - lipgloss.Height(status) - lipgloss.Height(help)
+	body := renderBody(m, width, bodyHeight)
 
 	return lipgloss.JoinVertical(lipgloss.Left, header, body, status, help)
 }
 
+// RenderPlain is RenderView without styling: the same layout, borders and
+// text with every ANSI escape code removed, for tests and snapshot tooling.
+func RenderPlain(m Model) string {
+	return ansi.Strip(RenderView(m))
+}
+
 func renderHeader(m Model, width int) string {
 	title := appTitleStyle.Render("dbx ui")
-	summary := summaryStyle.Render(fmt.Sprintf("focus=%s  targets=%d  running=%d  follow=%t", m.focused, len(m.targets), runningCount(m.sessions), m.logFollow))
+	refresh := m.refreshIn.String()
+	if m.paused {
+		refresh = "PAUSED"
+	}
+	summary := summaryStyle.Render(fmt.Sprintf("focus=%s  targets=%d  running=%d  follow=%t  refresh=%s", m.focused, len(m.targets), runningCount(m.sessions), m.logFollow, refresh))
 
 	content := lipgloss.JoinVertical(lipgloss.Left, title, summary)
 	return lipgloss.NewStyle().Width(width).Padding(0, 0, 1, 0).Render(content)
 }
 
+// renderBody lays out the targets, sessions and logs panes in height lines;
+// the logs pane gets whatever the other two leave, measured as rendered.
 func renderBody(m Model, width, height int) string {
-	narrow := width < narrowLayoutBreakpoint
-	if narrow {
-		paneWidth := width
-		return lipgloss.JoinVertical(
+	var top string
+	if width < narrowLayoutBreakpoint {
+		top = lipgloss.JoinVertical(
 			lipgloss.Left,
-			renderTargetsPane(m, paneWidth),
-			renderSessionsPane(m, paneWidth),
-			renderLogsPane(m, paneWidth, max(6, height/3)),
+			renderTargetsPane(m, width),
+			renderSessionsPane(m, width),
+		)
+	} else {
+		leftWidth := (width - 1) / 2
+		rightWidth := width - leftWidth - 1
+		top = lipgloss.JoinHorizontal(
+			lipgloss.Top,
+			renderTargetsPane(m, leftWidth),
+			renderSessionsPane(m, rightWidth),
 		)
 	}
 
-	leftWidth := (width - 1) / 2
-	rightWidth := width - leftWidth - 1
-	top := lipgloss.JoinHorizontal(
-		lipgloss.Top,
-		renderTargetsPane(m, leftWidth),
-		renderSessionsPane(m, rightWidth),
-	)
-
-	logsHeight := max(8, height-17)
-	logs := renderLogsPane(m, width, logsHeight)
-
-	return lipgloss.JoinVertical(lipgloss.Left, top, logs)
+	logLines := max(minLogLines, height-lipgloss.Height(top)-paneChromeLines)
+	return lipgloss.JoinVertical(lipgloss.Left, top, renderLogsPane(m, width, logLines))
 }
 
 func renderTargetsPane(m Model, width int) string {
@@ -105,7 +136,10 @@ func renderTargetsPane(m Model, width int) string {
 		}
 		for i := start; i < end; i++ {
 			t := m.targets[i]
-			line := fmt.Sprintf("%s", t.Key)
+			line := fmt.Sprintf("%s %s", targetMarker(m, t), t.Key)
+			if m.pinned[t.Key] {
+				line += " " + pinStyle.Render("★")
+			}
 			if i == m.targetSelected {
 				line = selectionStyle.Render("› " + line)
 			} else {
@@ -122,20 +156,31 @@ func renderTargetsPane(m Model, width int) string {
 
 func renderSessionsPane(m Model, width int) string {
 	title := paneTitle("sessions", m.focused == PaneSessions, fmt.Sprintf("running %d", runningCount(m.sessions)))
-	lines := make([]string, 0, len(m.sessions)+2)
-	if len(m.sessions) == 0 {
+	stopped := []session.SessionSummary(nil)
+	if m.showStopped {
+		stopped = m.stoppedSessions
+	}
+	lines := make([]string, 0, len(m.sessions)+len(stopped)+2)
+	if len(m.sessions) == 0 && len(stopped) == 0 {
 		lines = append(lines, mutedStyle.Render("No active sessions"))
 	} else {
-		head := mutedStyle.Render("KEY                      STATE      ENDPOINT              UPTIME")
+		head := mutedStyle.Render("KEY                      STATE      RESTARTS ENDPOINT              HEALTH           UPTIME")
 		lines = append(lines, head)
+		now := time.Now()
 		for i, s := range m.sessions {
-			row := fmt.Sprintf("%-24s %-10s %-21s %s", s.Key, stateBadge(s.State), fmt.Sprintf("%s:%d", s.Bind, s.LocalPort), formatDuration(s.Uptime))
+			row := fmt.Sprintf("%-24s %-10s %s %s %-16s %s", s.Key, stateBadge(s.State), restartsBadge(s.Reconnects), endpointLabel(s), healthLabel(s, now), sessionTiming(s))
 			if i == m.sessionSelected {
 				row = selectionStyle.Render("› " + row)
 			} else {
 				row = "  " + row
 			}
 			lines = append(lines, row)
+			if i == m.sessionSelected && s.State == session.SessionStateError && s.LastError != "" {
+				lines = append(lines, stateStyle(s.State).Render("    error: "+s.LastError))
+			}
+		}
+		for _, s := range stopped {
+			lines = append(lines, mutedStyle.Render("  "+stoppedRow(s, now)))
 		}
 	}
 	return renderPane(title, m.focused == PaneSessions, width, lines)
@@ -150,24 +195,53 @@ func renderLogsPane(m Model, width, maxLines int) string {
 	if m.logKey != "" {
 		sessionLabel = string(m.logKey)
 	}
-	title := paneTitle("logs", m.focused == PaneLogs, fmt.Sprintf("%s | follow %s", sessionLabel, followLabel))
+	right := fmt.Sprintf("%s | follow %s", sessionLabel, followLabel)
+	if m.logWrap {
+		right += " | wrap"
+	}
+	if m.logDropped > 0 {
+		right += fmt.Sprintf(" | (%d lines dropped)", m.logDropped)
+	}
+	title := paneTitle("logs", m.focused == PaneLogs, right)
 
 	lines := make([]string, 0, maxLines)
 	if len(m.logBuffer) == 0 {
 		lines = append(lines, mutedStyle.Render("No logs for selected session yet"))
 	} else {
-		start := 0
-		if len(m.logBuffer) > maxLines {
-			start = len(m.logBuffer) - maxLines
+		// Walk back from the newest entry until the pane is full; a wrapped
+		// entry takes several rows, and only its last rows may fit.
+		innerWidth := max(1, width-4)
+		for i := len(m.logBuffer) - 1; i >= 0 && len(lines) < maxLines; i-- {
+			lines = append(logRows(m.logBuffer[i], innerWidth, m.logWrap), lines...)
 		}
-		for _, line := range m.logBuffer[start:] {
-			lines = append(lines, line)
+		if len(lines) > maxLines {
+			lines = lines[len(lines)-maxLines:]
 		}
 	}
+	// Pad so the pane fills the height it was given.
+	for len(lines) < maxLines {
+		lines = append(lines, "")
+	}
 
 	return renderPane(title, m.focused == PaneLogs, width, lines)
 }
 
+// logRows renders one log entry as display rows of at most width cells:
+// wrapped over several rows when wrap is set, truncated to one otherwise.
+// stderr rows are styled after wrapping so the escape codes stay intact.
+func logRows(entry session.LogEntry, width int, wrap bool) []string {
+	rows := []string{truncate(entry.Line, width)}
+	if wrap {
+		rows = strings.Split(ansi.Wrap(entry.Line, width, ""), "\n")
+	}
+	if entry.Source == session.LogSourceStderr {
+		for i, row := range rows {
+			rows[i] = stderrStyle.Render(row)
+		}
+	}
+	return rows
+}
+
 func renderPane(title string, focused bool, width int, lines []string) string {
 	if width < 24 {
 		width = 24
@@ -221,20 +295,73 @@ func renderStatusBar(m Model, width int) string {
 	return style.Width(width).Render("status: " + msg)
 }
 
-func renderHelpBar(width int) string {
+func renderHelpBar(m Model, width int) string {
+	key := func(action Action) string {
+		return helpKeyStyle.Render(m.keys.Help(action))
+	}
+	pair := func(a, b Action) string {
+		return helpKeyStyle.Render(m.keys.Help(a) + "/" + m.keys.Help(b))
+	}
 	parts := []string{
-		helpKeyStyle.Render("j/k") + " move",
-		helpKeyStyle.Render("tab") + " focus",
-		helpKeyStyle.Render("c") + " connect",
-		helpKeyStyle.Render("s") + " stop",
-		helpKeyStyle.Render("S") + " stop-all",
-		helpKeyStyle.Render("l") + " follow",
-		helpKeyStyle.Render("q") + " quit",
+		pair(ActionDown, ActionUp) + " move",
+		key(ActionFocusNext) + " focus",
+		key(ActionJump) + " jump",
+		key(ActionConnect) + " connect",
+		key(ActionStop) + " stop",
+		key(ActionStopAll) + " stop-all",
+		key(ActionShowStopped) + " stopped",
+		key(ActionFollow) + " follow",
+		key(ActionPager) + " pager",
+		key(ActionEditConfig) + " edit config",
+		pair(ActionRefreshLonger, ActionRefreshShorter) + " refresh",
+		key(ActionPause) + " pause",
+		key(ActionMessages) + " messages",
+		key(ActionHelp) + " help",
+		key(ActionQuit) + " quit",
 	}
 	line := strings.Join(parts, "  ")
 	return lipgloss.NewStyle().Width(width).Foreground(lipgloss.Color("246")).Render(line)
 }
 
+// renderHelpOverlay lists every action with its keys from the keymap.
+func renderHelpOverlay(m Model, width int) string {
+	title := paneTitle("help", true, "? / esc / q to close")
+	lines := make([]string, 0, len(actionHelp))
+	for _, h := range actionHelp {
+		keys := strings.Join(m.keys.Keys(h.action), ", ")
+		lines = append(lines, fmt.Sprintf("%s %s", helpKeyStyle.Render(fmt.Sprintf("%-16s", keys)), h.description))
+	}
+	return renderPane(title, true, width, lines)
+}
+
+// renderMessagesOverlay lists recent status messages, newest first.
+func renderMessagesOverlay(m Model, width, maxLines int) string {
+	title := paneTitle("messages", true, fmt.Sprintf("%d | %s / esc / q to close", len(m.statusHistory), m.keys.Help(ActionMessages)))
+	lines := make([]string, 0, len(m.statusHistory))
+	if len(m.statusHistory) == 0 {
+		lines = append(lines, mutedStyle.Render("No status messages yet"))
+	}
+	for i := len(m.statusHistory) - 1; i >= 0 && len(lines) < max(1, maxLines); i-- {
+		e := m.statusHistory[i]
+		lines = append(lines, fmt.Sprintf("%s %s %s", mutedStyle.Render(e.at.Format("15:04:05")), statusLevelLabel(e.level), e.text))
+	}
+	return renderPane(title, true, width, lines)
+}
+
+func statusLevelLabel(level statusLevel) string {
+	text := fmt.Sprintf("%-7s", level)
+	switch level {
+	case statusSuccess:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("41")).Render(text)
+	case statusWarn:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Render(text)
+	case statusError:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Render(text)
+	default:
+		return mutedStyle.Render(text)
+	}
+}
+
 func truncate(s string, width int) string {
 	if width <= 0 || lipgloss.Width(s) <= width {
 		return s
@@ -257,17 +384,83 @@ func formatDuration(d time.Duration) string {
 }
 
 func stateBadge(state session.SessionState) string {
-	text := string(state)
+	return stateStyle(state).Render(string(state))
+}
+
+func stateStyle(state session.SessionState) lipgloss.Style {
 	switch state {
 	case session.SessionStateRunning:
-		return lipgloss.NewStyle().Foreground(lipgloss.Color("41")).Render(text)
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("41"))
 	case session.SessionStateStarting:
-		return lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Render(text)
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
 	case session.SessionStateError:
-		return lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Render(text)
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
 	default:
-		return mutedStyle.Render(text)
+		return mutedStyle
+	}
+}
+
+// targetMarker is a dot colored by the state of the target's session, or a
+// blank when the target is not connected.
+func targetMarker(m Model, t Target) string {
+	state, ok := m.targetState(t.Key)
+	if !ok {
+		return " "
+	}
+	return stateStyle(state).Render("●")
+}
+
+func restartsBadge(restarts int) string {
+	text := fmt.Sprintf("%-8d", restarts)
+	if restarts > 0 {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Render(text)
+	}
+	return text
+}
+
+// endpointLabel is bind:port, flagged when the bind exposes the session to the
+// network.
+func endpointLabel(s session.SessionSummary) string {
+	endpoint := fmt.Sprintf("%s:%d", s.Bind, s.LocalPort)
+	if config.IsLoopbackBind(s.Bind) {
+		return fmt.Sprintf("%-21s", endpoint)
+	}
+	return publicBindStyle.Render(fmt.Sprintf("%-21s", endpoint+" PUBLIC"))
+}
+
+// stoppedRow is a plain sessions-pane row for a recently stopped session,
+// rendered greyed out after the live ones: how long ago it ended and its last
+// error instead of health and uptime.
+func stoppedRow(s session.SessionSummary, now time.Time) string {
+	row := fmt.Sprintf("%-24s %-10s %-8d %-21s ended %s ago", s.Key, s.State, s.Reconnects, fmt.Sprintf("%s:%d", s.Bind, s.LocalPort), formatDuration(now.Sub(s.StoppedAt)))
+	if s.LastError != "" {
+		row += ": " + s.LastError
+	}
+	return row
+}
+
+// healthLabel says how long ago the session's endpoint last answered a probe.
+func healthLabel(s session.SessionSummary, now time.Time) string {
+	if s.LastHealthyAt.IsZero() {
+		return "-"
+	}
+	return fmt.Sprintf("healthy %s ago", formatDuration(now.Sub(s.LastHealthyAt)))
+}
+
+// sessionTiming shows uptime (plus the time left when a TTL is set), or for a
+// stopping session how long the stop has been running and when it will be
+// force-killed.
+func sessionTiming(s session.SessionSummary) string {
+	if s.State != session.SessionStateStopping || s.StopRequestedAt.IsZero() {
+		if !s.ExpiresAt.IsZero() {
+			return fmt.Sprintf("%s, ttl %s", formatDuration(s.Uptime), formatDuration(s.TTLRemaining.Round(time.Second)))
+		}
+		return formatDuration(s.Uptime)
+	}
+	if remaining := s.StopTimeout - s.StoppingFor; remaining > 0 {
+		return fmt.Sprintf("stopping %s, kill in %s", formatDuration(s.StoppingFor), formatDuration(remaining.Round(time.Second)))
 	}
+	return fmt.Sprintf("stopping %s, killing", formatDuration(s.StoppingFor))
 }
 
 func runningCount(sessions []session.SessionSummary) int {
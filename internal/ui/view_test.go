@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/charmbracelet/x/ansi"
 	"github.com/fredyranthun/db/internal/session"
 )
 
@@ -32,7 +34,7 @@ func TestRenderViewIncludesCoreSections(t *testing.T) {
 			LocalPort: 5500,
 			State:     session.SessionStateRunning,
 		}},
-		logBuffer: []string{"line-1"},
+		logBuffer: []session.LogEntry{{Line: "line-1"}},
 		status:    "ok",
 	}
 
@@ -71,7 +73,7 @@ func TestRenderViewNarrowLayoutStillShowsAllPanes(t *testing.T) {
 			LocalPort: 5500,
 			State:     session.SessionStateRunning,
 		}},
-		logBuffer: []string{"line-1", "line-2"},
+		logBuffer: []session.LogEntry{{Line: "line-1"}, {Line: "line-2"}},
 		status:    "ok",
 	}
 
@@ -105,3 +107,178 @@ func TestRenderViewTargetsViewportShowsIndicators(t *testing.T) {
 		t.Fatalf("expected output not to contain offscreen target service/env00\n%s", out)
 	}
 }
+
+func TestSessionTimingShowsStopCountdown(t *testing.T) {
+	running := session.SessionSummary{State: session.SessionStateRunning, Uptime: 90 * time.Second}
+	if got := sessionTiming(running); got != "1m30s" {
+		t.Fatalf("expected uptime for running session, got %q", got)
+	}
+
+	running.ExpiresAt = time.Now().Add(10 * time.Minute)
+	running.TTLRemaining = 10 * time.Minute
+	if got := sessionTiming(running); got != "1m30s, ttl 10m0s" {
+		t.Fatalf("expected remaining TTL for running session, got %q", got)
+	}
+
+	stopping := session.SessionSummary{
+		State:           session.SessionStateStopping,
+		StopRequestedAt: time.Now().Add(-2 * time.Second),
+		StoppingFor:     2 * time.Second,
+		StopTimeout:     5 * time.Second,
+	}
+	if got := sessionTiming(stopping); got != "stopping 2s, kill in 3s" {
+		t.Fatalf("expected stop countdown, got %q", got)
+	}
+
+	stopping.StoppingFor = 6 * time.Second
+	if got := sessionTiming(stopping); got != "stopping 6s, killing" {
+		t.Fatalf("expected force-kill label, got %q", got)
+	}
+}
+
+func TestHealthLabel(t *testing.T) {
+	now := time.Now()
+	if got := healthLabel(session.SessionSummary{}, now); got != "-" {
+		t.Fatalf("expected placeholder without a probe, got %q", got)
+	}
+	s := session.SessionSummary{LastHealthyAt: now.Add(-3 * time.Second)}
+	if got := healthLabel(s, now); got != "healthy 3s ago" {
+		t.Fatalf("expected healthy 3s ago, got %q", got)
+	}
+}
+
+func TestEndpointLabelFlagsPublicBind(t *testing.T) {
+	if got := endpointLabel(session.SessionSummary{Bind: "127.0.0.1", LocalPort: 5500}); strings.Contains(got, "PUBLIC") {
+		t.Fatalf("expected no badge for loopback, got %q", got)
+	}
+	if got := endpointLabel(session.SessionSummary{Bind: "0.0.0.0", LocalPort: 5500}); !strings.Contains(got, "0.0.0.0:5500 PUBLIC") {
+		t.Fatalf("expected PUBLIC badge, got %q", got)
+	}
+}
+
+func TestRenderTargetsPaneMarksConnectedTargets(t *testing.T) {
+	m := Model{
+		focused: PaneTargets,
+		targets: []Target{
+			{Key: session.NewSessionKey("service1", "dev")},
+			{Key: session.NewSessionKey("service1", "qa")},
+			{Key: session.NewSessionKey("service2", "dev")},
+		},
+		sessions: []session.SessionSummary{
+			{Key: session.NewSessionKey("service1", "dev"), State: session.SessionStateRunning},
+			{Key: session.NewSessionKey("service2", "dev:db"), State: session.SessionStateRunning},
+			{Key: session.NewSessionKey("service2", "dev:metrics"), State: session.SessionStateError},
+		},
+	}
+
+	out := renderTargetsPane(m, 60)
+	for _, want := range []string{"● service1/dev", "  service1/qa", "● service2/dev"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected targets pane to contain %q, got:\n%s", want, out)
+		}
+	}
+	if state, ok := m.targetState(session.NewSessionKey("service2", "dev")); !ok || state != session.SessionStateError {
+		t.Fatalf("expected the error forward to win for a multi-port target, got %q, %t", state, ok)
+	}
+	if _, ok := m.targetState(session.NewSessionKey("service1", "qa")); ok {
+		t.Fatal("expected no state for a target without a session")
+	}
+}
+
+func TestRenderViewHelpOverlayListsKeymap(t *testing.T) {
+	km, err := NewKeyMap(map[string][]string{"follow": {"f"}})
+	if err != nil {
+		t.Fatalf("keymap: %v", err)
+	}
+	m := Model{focused: PaneTargets, keys: km, showHelp: true, width: 120}
+
+	out := RenderView(m)
+	for _, want := range []string{"HELP", "toggle follow logs", "stop all sessions", "space"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected help overlay to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "SESSIONS") {
+		t.Fatalf("expected the overlay to replace the panes, got:\n%s", out)
+	}
+	if !strings.Contains(out, "f                toggle follow logs") {
+		t.Fatalf("expected the configured follow key, got:\n%s", out)
+	}
+}
+
+func TestRenderPlainHasNoEscapeCodes(t *testing.T) {
+	m := Model{
+		focused: PaneSessions,
+		targets: []Target{{Key: session.NewSessionKey("service1", "dev")}},
+		sessions: []session.SessionSummary{{
+			Key:       session.NewSessionKey("service1", "dev"),
+			Bind:      "127.0.0.1",
+			LocalPort: 5500,
+			State:     session.SessionStateRunning,
+		}},
+		logBuffer: []session.LogEntry{{Source: session.LogSourceStderr, Line: "An error occurred"}},
+		status:    "ok",
+		width:     200,
+	}
+
+	out := RenderPlain(m)
+	if strings.Contains(out, "\x1b") {
+		t.Fatalf("expected no escape codes, got %q", out)
+	}
+	for _, want := range []string{"dbx ui", "service1/dev", "127.0.0.1:5500", "An error occurred", "status: ok"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected plain output to contain %q\n%s", want, out)
+		}
+	}
+}
+
+func TestRenderViewLogsPaneFillsTerminalHeight(t *testing.T) {
+	for _, size := range []struct{ width, height int }{{120, 40}, {120, 70}, {90, 60}} {
+		m := Model{
+			targets:   []Target{{Key: session.NewSessionKey("service1", "dev")}},
+			logBuffer: []session.LogEntry{{Line: "line-1"}},
+			width:     size.width,
+			height:    size.height,
+		}
+		if got := strings.Count(RenderPlain(m), "\n") + 1; got != size.height {
+			t.Fatalf("%dx%d: expected the view to fill %d lines, got %d", size.width, size.height, size.height, got)
+		}
+	}
+}
+
+func TestRenderViewTooSmallShowsMessage(t *testing.T) {
+	for _, size := range []struct{ width, height int }{{60, 40}, {120, 10}} {
+		m := Model{targets: makeTargets(3), width: size.width, height: size.height}
+		out := RenderPlain(m)
+		if !strings.Contains(out, "terminal too small (need at least 72x18)") {
+			t.Fatalf("%dx%d: expected the size message, got:\n%s", size.width, size.height, out)
+		}
+		if strings.Contains(out, "TARGETS") {
+			t.Fatalf("%dx%d: expected no panes, got:\n%s", size.width, size.height, out)
+		}
+	}
+
+	m := Model{targets: makeTargets(3), width: minWidth, height: minHeight}
+	if out := RenderPlain(m); strings.Contains(out, "terminal too small") {
+		t.Fatalf("expected the full view at %dx%d, got:\n%s", minWidth, minHeight, out)
+	}
+}
+
+func TestRenderLogsPaneWrapsLongLines(t *testing.T) {
+	long := "connection reset by peer while reading the response from ssm.sa-east-1.amazonaws.com"
+	m := Model{logBuffer: []session.LogEntry{{Line: "older line"}, {Line: long}}}
+
+	truncated := ansi.Strip(renderLogsPane(m, 40, 3))
+	if !strings.Contains(truncated, "older line") || !strings.Contains(truncated, "…") || strings.Contains(truncated, "amazonaws.com") {
+		t.Fatalf("expected the long line truncated, got:\n%s", truncated)
+	}
+
+	m.logWrap = true
+	wrapped := ansi.Strip(renderLogsPane(m, 40, 3))
+	if !strings.Contains(wrapped, "amazonaws.com") || strings.Contains(wrapped, "…") {
+		t.Fatalf("expected the end of the long line wrapped into view, got:\n%s", wrapped)
+	}
+	if strings.Contains(wrapped, "older line") {
+		t.Fatalf("expected the wrapped line to push the older one out of 3 rows, got:\n%s", wrapped)
+	}
+}
@@ -0,0 +1,80 @@
+package uistate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// State is what the UI remembers between runs.
+type State struct {
+	Pinned         []string `json:"pinned,omitempty"`
+	Focused        string   `json:"focused,omitempty"`
+	SelectedTarget string   `json:"selected_target,omitempty"`
+	Follow         bool     `json:"follow,omitempty"`
+}
+
+// DefaultPath returns ~/.dbx/ui-state.json.
+func DefaultPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".dbx", "ui-state.json"), nil
+}
+
+// Load reads the state file. A missing file, or an empty path, yields an
+// empty state.
+func Load(path string) (State, error) {
+	if path == "" {
+		return State{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, fmt.Errorf("read ui state %q: %w", path, err)
+	}
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return State{}, fmt.Errorf("parse ui state %q: %w", path, err)
+	}
+	return s, nil
+}
+
+// Save writes the state file, creating its directory when missing. The file
+// is replaced atomically so a crash never leaves it half written.
+func Save(path string, s State) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode ui state: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create ui state directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".ui-state-*.json")
+	if err != nil {
+		return fmt.Errorf("write ui state %q: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write ui state %q: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write ui state %q: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write ui state %q: %w", path, err)
+	}
+	return nil
+}
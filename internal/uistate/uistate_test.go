@@ -0,0 +1,43 @@
+package uistate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "ui-state.json")
+
+	if s, err := Load(path); err != nil || len(s.Pinned) != 0 {
+		t.Fatalf("expected empty state for missing file, got %+v (%v)", s, err)
+	}
+
+	want := State{Pinned: []string{"service1/dev", "service2/prod"}}
+	if err := Save(path, want); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("expected mode 0600, got %o", perm)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected an error for a malformed state file")
+	}
+}
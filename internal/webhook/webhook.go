@@ -0,0 +1,154 @@
+// Package webhook posts session lifecycle events to a configured URL.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/fredyranthun/db/internal/session"
+)
+
+const (
+	defaultTimeout    = 5 * time.Second
+	defaultRetryDelay = time.Second
+	defaultAttempts   = 2
+)
+
+// Payload is the JSON body posted for each event.
+type Payload struct {
+	Event    string    `json:"event"`
+	User     string    `json:"user"`
+	Key      string    `json:"key"`
+	Service  string    `json:"service"`
+	Env      string    `json:"env"`
+	Endpoint string    `json:"endpoint,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"timestamp"`
+}
+
+// Notifier delivers events in the background. Delivery failures are passed to
+// OnError and never reach the session operation that triggered them.
+type Notifier struct {
+	// OnError, when set, is called once per event that could not be delivered.
+	OnError func(session.Event, error)
+
+	mu     sync.RWMutex
+	url    string
+	user   string
+	client *http.Client
+
+	retryDelay time.Duration
+	attempts   int
+	inflight   sync.WaitGroup
+}
+
+// NewNotifier returns a Notifier with no URL; events are dropped until
+// SetURL is called with a non-empty URL.
+func NewNotifier() *Notifier {
+	return &Notifier{
+		user:       currentUser(),
+		client:     &http.Client{Timeout: defaultTimeout},
+		retryDelay: defaultRetryDelay,
+		attempts:   defaultAttempts,
+	}
+}
+
+// SetURL changes the target URL; an empty URL disables delivery.
+func (n *Notifier) SetURL(url string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.url = url
+}
+
+// Handle posts e asynchronously. It matches session.EventHandler.
+func (n *Notifier) Handle(e session.Event) {
+	n.mu.RLock()
+	url := n.url
+	n.mu.RUnlock()
+	if url == "" {
+		return
+	}
+
+	n.inflight.Add(1)
+	go func() {
+		defer n.inflight.Done()
+		if err := n.deliver(url, e); err != nil && n.OnError != nil {
+			n.OnError(e, err)
+		}
+	}()
+}
+
+// Wait blocks until in-flight deliveries finish or timeout elapses, so a
+// short-lived command does not exit before its events are sent.
+func (n *Notifier) Wait(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		n.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+func (n *Notifier) deliver(url string, e session.Event) error {
+	body, err := json.Marshal(Payload{
+		Event:    string(e.Type),
+		User:     n.user,
+		Key:      string(e.Key),
+		Service:  e.Service,
+		Env:      e.Env,
+		Endpoint: e.Endpoint,
+		Error:    e.Error,
+		Time:     e.Time,
+	})
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = n.post(url, body)
+		if err == nil || attempt >= n.attempts {
+			return err
+		}
+		time.Sleep(n.retryDelay)
+	}
+}
+
+func (n *Notifier) post(url string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
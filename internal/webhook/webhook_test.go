@@ -0,0 +1,82 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fredyranthun/db/internal/session"
+)
+
+func TestNotifierPostsPayload(t *testing.T) {
+	got := make(chan Payload, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p Payload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		got <- p
+	}))
+	defer srv.Close()
+
+	n := NewNotifier()
+	n.SetURL(srv.URL)
+	n.Handle(session.Event{
+		Type:     session.EventSessionReady,
+		Key:      session.NewSessionKey("service1", "dev"),
+		Service:  "service1",
+		Env:      "dev",
+		Endpoint: "127.0.0.1:5500",
+		Time:     time.Now(),
+	})
+	n.Wait(time.Second)
+
+	select {
+	case p := <-got:
+		if p.Event != "connect" || p.Key != "service1/dev" || p.Endpoint != "127.0.0.1:5500" {
+			t.Fatalf("unexpected payload: %+v", p)
+		}
+	default:
+		t.Fatal("expected webhook to be delivered")
+	}
+}
+
+func TestNotifierRetriesThenReportsError(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	reported := make(chan error, 1)
+	n := NewNotifier()
+	n.retryDelay = time.Millisecond
+	n.OnError = func(_ session.Event, err error) { reported <- err }
+	n.SetURL(srv.URL)
+
+	n.Handle(session.Event{Type: session.EventSessionStopped, Key: "service1/dev"})
+	n.Wait(time.Second)
+
+	if got := calls.Load(); got != defaultAttempts {
+		t.Fatalf("expected %d attempts, got %d", defaultAttempts, got)
+	}
+	select {
+	case err := <-reported:
+		if err == nil {
+			t.Fatal("expected delivery error")
+		}
+	default:
+		t.Fatal("expected OnError to be called")
+	}
+}
+
+func TestNotifierWithoutURLDoesNothing(t *testing.T) {
+	n := NewNotifier()
+	n.OnError = func(_ session.Event, err error) { t.Fatalf("unexpected error: %v", err) }
+	n.Handle(session.Event{Type: session.EventSessionReady})
+	n.Wait(10 * time.Millisecond)
+}
@@ -0,0 +1,124 @@
+// Package sessiontest provides an in-process SSM simulator for testing code
+// built on session.Manager without the aws CLI. It lives outside internal/
+// and depends only on the standard library, so other modules can import it
+// too: FakeExecutor.Command fits any hook that builds the aws command from a
+// context, a name and its args.
+//
+// FakeExecutor re-runs the current test binary in a helper mode that mimics
+// `aws ssm start-session`: it listens on the requested local port so readiness
+// checks pass, prints the usual plugin banner lines, and exits cleanly on
+// SIGINT or SIGTERM. Helper mode is entered from this package's init, so
+// importing sessiontest in a _test.go file is all the setup needed.
+package sessiontest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+const (
+	helperEnv = "DBX_SESSIONTEST_HELPER"
+	linesEnv  = "DBX_SESSIONTEST_LINES"
+	exitEnv   = "DBX_SESSIONTEST_EXIT_CODE"
+)
+
+// DefaultLines mirror what the Session Manager plugin prints on start. "%d"
+// is replaced with the local port.
+var DefaultLines = []string{
+	"Starting session with SessionId: sessiontest-0000",
+	"Port %d opened for sessionId sessiontest-0000.",
+	"Waiting for connections...",
+}
+
+var localPortPattern = regexp.MustCompile(`localPortNumber=\["(\d+)"\]`)
+
+// FakeExecutor implements session.Executor with a simulated SSM session.
+type FakeExecutor struct {
+	// Lines are printed to stdout once the listener is up; nil means
+	// DefaultLines. "%d" in a line is replaced with the local port.
+	Lines []string
+	// ExitCode, when non-zero, makes the fake print Lines and exit with
+	// that code instead of listening, simulating a failing session.
+	ExitCode int
+}
+
+// Command returns a command that runs the simulator for the aws args built by
+// session.BuildSSMPortForwardArgs.
+func (f FakeExecutor) Command(ctx context.Context, _ string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, os.Args[0], append([]string{"-test.run=^$", "--"}, args...)...)
+	lines := f.Lines
+	if lines == nil {
+		lines = DefaultLines
+	}
+	cmd.Env = append(os.Environ(),
+		helperEnv+"=1",
+		linesEnv+"="+strings.Join(lines, "\n"),
+		fmt.Sprintf("%s=%d", exitEnv, f.ExitCode),
+	)
+	return cmd
+}
+
+func init() {
+	if os.Getenv(helperEnv) != "1" {
+		return
+	}
+	os.Exit(runHelper(os.Args[1:]))
+}
+
+func runHelper(args []string) int {
+	lines := strings.Split(os.Getenv(linesEnv), "\n")
+
+	port := 0
+	if m := localPortPattern.FindStringSubmatch(strings.Join(args, " ")); m != nil {
+		fmt.Sscanf(m[1], "%d", &port)
+	}
+
+	if code := os.Getenv(exitEnv); code != "" && code != "0" {
+		printLines(lines, port)
+		var exitCode int
+		fmt.Sscanf(code, "%d", &exitCode)
+		return exitCode
+	}
+
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sessiontest: listen on port %d: %v\n", port, err)
+		return 1
+	}
+	defer ln.Close()
+	// localPortNumber 0 lets the plugin pick; report the port it got.
+	port = ln.Addr().(*net.TCPAddr).Port
+
+	printLines(lines, port)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	<-sigCh
+	return 0
+}
+
+func printLines(lines []string, port int) {
+	for _, line := range lines {
+		if strings.Contains(line, "%d") {
+			line = fmt.Sprintf(line, port)
+		}
+		fmt.Println(line)
+	}
+}
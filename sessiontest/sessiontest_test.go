@@ -0,0 +1,93 @@
+package sessiontest
+
+import (
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fredyranthun/db/internal/session"
+)
+
+func startOpts(t *testing.T) session.StartOptions {
+	t.Helper()
+
+	port, err := session.FindFreePort("127.0.0.1", 20000, 40000)
+	if err != nil {
+		t.Fatalf("find free port: %v", err)
+	}
+	return session.StartOptions{
+		Service:          "service1",
+		Env:              "dev",
+		Bind:             "127.0.0.1",
+		LocalPort:        port,
+		TargetInstanceID: "i-123",
+		RemoteHost:       "db.internal",
+		RemotePort:       5432,
+		StartupTimeout:   5 * time.Second,
+	}
+}
+
+func TestFakeExecutorSimulatesSession(t *testing.T) {
+	m := session.NewManager()
+	m.SetExecutor(FakeExecutor{})
+	t.Cleanup(func() { _ = m.Close() })
+
+	opts := startOpts(t)
+	opts.ReadyBanner = regexp.MustCompile(`Waiting for connections`)
+	s, err := m.Start(opts)
+	if err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(s.Bind, strconv.Itoa(s.LocalPort)), time.Second)
+	if err != nil {
+		t.Fatalf("expected fake listener on %d: %v", s.LocalPort, err)
+	}
+	conn.Close()
+
+	logs := s.LastLogs(10)
+	if want := "Port " + strconv.Itoa(s.LocalPort) + " opened"; !strings.Contains(strings.Join(logs, "\n"), want) {
+		t.Fatalf("expected %q in logs, got %v", want, logs)
+	}
+
+	if err := m.Stop(s.Key); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+}
+
+func TestFakeExecutorFailingSession(t *testing.T) {
+	m := session.NewManager()
+	m.SetExecutor(FakeExecutor{Lines: []string{"An error occurred (TargetNotConnected)"}, ExitCode: 254})
+	t.Cleanup(func() { _ = m.Close() })
+
+	_, err := m.Start(startOpts(t))
+	if err == nil || !strings.Contains(err.Error(), "TargetNotConnected") {
+		t.Fatalf("expected start to fail with the fake's output, got %v", err)
+	}
+}
+
+func TestFakeExecutorSSMAssignedPort(t *testing.T) {
+	m := session.NewManager()
+	m.SetExecutor(FakeExecutor{})
+	t.Cleanup(func() { _ = m.Close() })
+
+	opts := startOpts(t)
+	opts.LocalPort = 0
+	opts.SSMAssignedPort = true
+	s, err := m.Start(opts)
+	if err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if s.LocalPort == 0 {
+		t.Fatal("expected the port reported by the plugin to be recorded")
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(s.Bind, strconv.Itoa(s.LocalPort)), time.Second)
+	if err != nil {
+		t.Fatalf("expected fake listener on %d: %v", s.LocalPort, err)
+	}
+	conn.Close()
+}